@@ -1,10 +1,17 @@
 import accountSchema from "./schemas/account.schema.json"
 import actionSchema from "./schemas/action.schema.json"
+import addressIndexSchema from "./schemas/address_index.schema.json"
+import chainEventSchema from "./schemas/chain_event.schema.json"
+import decodedEventSchema from "./schemas/decoded_event.schema.json"
 import eventSchema from "./schemas/event.schema.json"
 import nonceSchema from "./schemas/nonce.schema.json"
 import operatorSchema from "./schemas/operator.schema.json"
+import poolSchema from "./schemas/pool.schema.json"
+import rewardSchema from "./schemas/reward.schema.json"
+import snapshotSchema from "./schemas/snapshot.schema.json"
 import userAccountSchema from "./schemas/user_account.schema.json"
 import userSchema from "./schemas/user.schema.json"
+import validatorSchema from "./schemas/validator.schema.json"
 import { Postgres } from "../../../services/users/src/providers/postgres"
 import { JsonType, GlueType, PostgresType, Schema } from "./providers/schema"
 import { JsonSchema } from "./interfaces/JsonSchema"
@@ -12,11 +19,18 @@ import { JsonSchema } from "./interfaces/JsonSchema"
 export {
     accountSchema,
     actionSchema,
+    addressIndexSchema,
+    chainEventSchema,
+    decodedEventSchema,
     eventSchema,
     nonceSchema,
     operatorSchema,
+    poolSchema,
+    rewardSchema,
+    snapshotSchema,
     userAccountSchema,
     userSchema,
+    validatorSchema,
     Postgres,
     Schema
 }
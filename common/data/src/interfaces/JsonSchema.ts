@@ -7,6 +7,9 @@ export interface JsonSchema {
         [key: string]: {
             type: string,
             description: string,
+            items?: {
+                type: string
+            },
             default?: string | number | boolean | null
         }
     },
@@ -43,6 +43,12 @@ export class Schema {
 
             if (name == "timestamp") type = glue.Schema.TIMESTAMP
 
+            /** Arrays need their item type, e.g. pool ids as array<int> */
+            if (property.type == "array" && property.items) {
+                const itemKey = property.items.type.toUpperCase() as keyof glue.Schema
+                type = glue.Schema.array(glue.Schema[itemKey] as GlueType)
+            }
+
             const comment = property.description
             return { name, type, comment }
         })
@@ -2,7 +2,7 @@ import { Construct } from "constructs"
 import * as cdk from "aws-cdk-lib"
 import * as s3 from "aws-cdk-lib/aws-s3"
 import * as glue from "@aws-cdk/aws-glue-alpha"
-import { Schema, eventSchema } from "@casimir/data"
+import { Schema, actionSchema, chainEventSchema, eventSchema, snapshotSchema, rewardSchema, poolSchema, validatorSchema, addressIndexSchema, decodedEventSchema } from "@casimir/data"
 import { kebabCase, pascalCase, snakeCase } from "@casimir/format"
 import { Config } from "./config"
 import { AnalyticsStackProps } from "../interfaces/StackProps"
@@ -19,7 +19,15 @@ export class AnalyticsStack extends cdk.Stack {
 
         const config = new Config()
 
+        const chainEventColumns = new Schema(chainEventSchema).getGlueColumns()
         const eventColumns = new Schema(eventSchema).getGlueColumns()
+        const actionColumns = new Schema(actionSchema).getGlueColumns()
+        const snapshotColumns = new Schema(snapshotSchema).getGlueColumns()
+        const rewardColumns = new Schema(rewardSchema).getGlueColumns()
+        const poolColumns = new Schema(poolSchema).getGlueColumns()
+        const validatorColumns = new Schema(validatorSchema).getGlueColumns()
+        const addressIndexColumns = new Schema(addressIndexSchema).getGlueColumns()
+        const decodedEventColumns = new Schema(decodedEventSchema).getGlueColumns()
 
         const database = new glue.Database(this, config.getFullStackResourceName(this.name, "database", config.dataVersion), {
             databaseName: snakeCase(config.getFullStackResourceName(this.name, "database", config.dataVersion)),
@@ -49,8 +57,114 @@ export class AnalyticsStack extends cdk.Stack {
             database: database,
             tableName: snakeCase(config.getFullStackResourceName(this.name, "event-table", config.dataVersion)),
             bucket: eventBucket,
+            columns: chainEventColumns,
+            dataFormat: glue.DataFormat.JSON,
+            // The crawler can upload gzip (.ndjson.gz) or zstd (.ndjson.zst) objects, Athena decompresses by extension
+            compressed: true,
+        })
+
+        const actionBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "action-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "action-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "action-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "action-table", config.dataVersion)),
+            bucket: actionBucket,
+            columns: actionColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const snapshotBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "snapshot-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "snapshot-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "snapshot-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "snapshot-table", config.dataVersion)),
+            bucket: snapshotBucket,
+            columns: snapshotColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const rewardBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "reward-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "reward-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "reward-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "reward-table", config.dataVersion)),
+            bucket: rewardBucket,
+            columns: rewardColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const poolBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "pool-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "pool-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "pool-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "pool-table", config.dataVersion)),
+            bucket: poolBucket,
+            columns: poolColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const contractEventBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "contract-event-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "contract-event-bucket", config.dataVersion))
+        })
+
+        /** Decoded contract logs follow the event schema, block and transaction events follow the chain event schema */
+        new glue.Table(this, config.getFullStackResourceName(this.name, "contract-event-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "contract-event-table", config.dataVersion)),
+            bucket: contractEventBucket,
             columns: eventColumns,
             dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const validatorBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "validator-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "validator-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "validator-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "validator-table", config.dataVersion)),
+            bucket: validatorBucket,
+            columns: validatorColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
+        })
+
+        const addressIndexBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "address-index-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "address-index-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "address-index-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "address-index-table", config.dataVersion)),
+            bucket: addressIndexBucket,
+            columns: addressIndexColumns,
+            dataFormat: glue.DataFormat.JSON,
+        })
+
+        const decodedEventBucket = new s3.Bucket(this, config.getFullStackResourceName(this.name, "decoded-event-bucket", config.dataVersion), {
+            bucketName: kebabCase(config.getFullStackResourceName(this.name, "decoded-event-bucket", config.dataVersion))
+        })
+
+        new glue.Table(this, config.getFullStackResourceName(this.name, "decoded-event-table", config.dataVersion), {
+            database: database,
+            tableName: snakeCase(config.getFullStackResourceName(this.name, "decoded-event-table", config.dataVersion)),
+            bucket: decodedEventBucket,
+            columns: decodedEventColumns,
+            dataFormat: glue.DataFormat.JSON,
+            compressed: true,
         })
     }
 }
\ No newline at end of file
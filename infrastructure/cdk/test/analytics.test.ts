@@ -2,7 +2,7 @@ import * as cdk from "aws-cdk-lib"
 import * as assertions from "aws-cdk-lib/assertions"
 import { Config } from "../src/providers/config"
 import { AnalyticsStack } from "../src/providers/analytics"
-import { Schema, eventSchema, } from "@casimir/data"
+import { Schema, chainEventSchema, eventSchema } from "@casimir/data"
 
 test("Analytics stack created", () => {
     const config = new Config()
@@ -17,17 +17,24 @@ test("Analytics stack created", () => {
 
     const resource = analyticsTemplate.findResources("AWS::Glue::Table")
 
-    const eventTable = Object.keys(resource).filter(key => key.includes("EventTable"))
-    const eventColumns = resource[eventTable[0]].Properties.TableInput.StorageDescriptor.Columns
-    const eventGlueSchema = new Schema(eventSchema).getGlueColumns()
+    const tables = [
+        { name: "AnalyticsEventTable", schema: chainEventSchema },
+        { name: "ContractEventTable", schema: eventSchema }
+    ]
 
-    for (const column of eventColumns) {
-        const { Name: name, Type: type } = column
-        const columnName = Object.keys(eventSchema.properties).filter(key => key === name)[0]
-        const columnType = eventGlueSchema.filter(key => key.name === name)[0].type.inputString
+    for (const { name: tableName, schema } of tables) {
+        const table = Object.keys(resource).filter(key => key.includes(tableName))
+        const columns = resource[table[0]].Properties.TableInput.StorageDescriptor.Columns
+        const glueSchema = new Schema(schema).getGlueColumns()
 
-        expect(columnType).toEqual(type)
-        expect(columnName).toEqual(name)
+        for (const column of columns) {
+            const { Name: name, Type: type } = column
+            const columnName = Object.keys(schema.properties).filter(key => key === name)[0]
+            const columnType = glueSchema.filter(key => key.name === name)[0].type.inputString
+
+            expect(columnType).toEqual(type)
+            expect(columnName).toEqual(name)
+        }
     }
 
     const workgroup = analyticsTemplate.findResources("AWS::Athena::WorkGroup")
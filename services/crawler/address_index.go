@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// hex characters of the address after 0x used to bucket the index, 256 buckets
+	AddressPrefixLength = 2
+	// buckets with fewer files are left as they are by a compaction
+	DefaultCompactMinFiles = 2
+)
+
+// AddressIndexEntry points at an action of an address by its block, transaction and row in the action partition
+type AddressIndexEntry struct {
+	Address   string      `json:"address"`
+	Network   NetworkType `json:"network"`
+	Height    uint64      `json:"height"`
+	BlockHash string      `json:"block_hash"`
+	TxHash    string      `json:"tx_hash"`
+	// position of the transaction in the block, -1 when the transaction isn't in the block events
+	TxIndex int `json:"tx_index"`
+	// action partition key and row of the action in it
+	Partition string `json:"partition"`
+	Row       int    `json:"row"`
+}
+
+// AddressPrefix returns the bucket of an address, the first hex characters after 0x lowercased
+func AddressPrefix(address string) string {
+	hex := strings.TrimPrefix(strings.ToLower(address), "0x")
+
+	if len(hex) < AddressPrefixLength {
+		return strings.Repeat("0", AddressPrefixLength-len(hex)) + hex
+	}
+
+	return hex[:AddressPrefixLength]
+}
+
+// AddressIndexPrefix returns the key prefix of the index files of a bucket
+func AddressIndexPrefix(network NetworkType, prefix string) string {
+	return fmt.Sprintf("chain=%s/network=%s/prefix=%s/", Ethereum, network, prefix)
+}
+
+// AddressIndexKey returns the key of the index file written at ingest for a bucket and block
+func AddressIndexKey(network NetworkType, prefix string, height uint64) string {
+	return fmt.Sprintf("%sblock=%d.ndjson", AddressIndexPrefix(network, prefix), height)
+}
+
+// CompactedIndexKey returns the key of the compacted index file of a bucket covering the range
+func CompactedIndexKey(network NetworkType, prefix string, r BlockRange) string {
+	return fmt.Sprintf("%sblocks=%s.ndjson", AddressIndexPrefix(network, prefix), r)
+}
+
+// BuildAddressIndex returns the index entries of the actions of a block grouped by address prefix
+func BuildAddressIndex(result *BlockEventsResult, actionPartition string) map[string][]AddressIndexEntry {
+	txIndex := make(map[string]int)
+	blockHash := ""
+
+	for _, event := range result.Events {
+		switch event.Type {
+		case Block:
+			blockHash = event.Block
+		case Transaction:
+			if _, ok := txIndex[event.Transaction]; !ok {
+				txIndex[event.Transaction] = len(txIndex)
+			}
+		}
+	}
+
+	entries := make(map[string][]AddressIndexEntry)
+
+	for row, action := range result.Action {
+		if action.Address == "" {
+			continue
+		}
+
+		position, ok := txIndex[action.Hash]
+
+		if !ok {
+			position = -1
+		}
+
+		address := strings.ToLower(action.Address)
+		prefix := AddressPrefix(address)
+
+		entries[prefix] = append(entries[prefix], AddressIndexEntry{
+			Address:   address,
+			Network:   action.Network,
+			Height:    result.ActionPartitionKey.Block,
+			BlockHash: blockHash,
+			TxHash:    action.Hash,
+			TxIndex:   position,
+			Partition: actionPartition,
+			Row:       row,
+		})
+	}
+
+	return entries
+}
+
+// MergeIndexFiles merges the entries of the index files of a bucket by key. Files written at ingest replace the
+// entries of their block in compacted files, so a block crawled again after a compaction isn't listed twice.
+// Entries are sorted by address, height, transaction and row.
+func MergeIndexFiles(files map[string][]AddressIndexEntry) []AddressIndexEntry {
+	ingested := make(map[uint64]bool)
+
+	for key := range files {
+		if height, ok := PartitionHeight(key); ok {
+			ingested[height] = true
+		}
+	}
+
+	seen := make(map[AddressIndexEntry]bool)
+
+	var merged []AddressIndexEntry
+
+	for key, entries := range files {
+		_, isBlock := PartitionHeight(key)
+
+		for _, entry := range entries {
+			if !isBlock && ingested[entry.Height] {
+				continue
+			}
+
+			if seen[entry] {
+				continue
+			}
+
+			seen[entry] = true
+			merged = append(merged, entry)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		a, b := merged[i], merged[j]
+
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+
+		if a.TxIndex != b.TxIndex {
+			return a.TxIndex < b.TxIndex
+		}
+
+		return a.Row < b.Row
+	})
+
+	return merged
+}
+
+// AddressIndex writes the address index to its bucket and keeps the index files compact
+type AddressIndex struct {
+	*Logger
+	S3     *S3Service
+	Bucket string
+}
+
+// StaleIndexKeys returns the index file keys of the block in every prefix without entries, a block crawled again
+// (e.g. after a reorg) may have left files in prefixes its new actions don't use
+func StaleIndexKeys(network NetworkType, height uint64, entries map[string][]AddressIndexEntry) []string {
+	var keys []string
+
+	for i := 0; i < 1<<(4*AddressPrefixLength); i++ {
+		prefix := fmt.Sprintf("%0*x", AddressPrefixLength, i)
+
+		if _, ok := entries[prefix]; !ok {
+			keys = append(keys, AddressIndexKey(network, prefix, height))
+		}
+	}
+
+	return keys
+}
+
+// Write deletes the block's index files of the prefixes without entries and uploads one index file per address
+// prefix of the block
+func (a *AddressIndex) Write(network NetworkType, height uint64, entries map[string][]AddressIndexEntry) error {
+	_, err := a.S3.DeleteKeys(a.Bucket, StaleIndexKeys(network, height, entries))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete stale address index files of block=%d: %s", height, err.Error())
+	}
+
+	for prefix, rows := range entries {
+		encoded, err := NDJSON[AddressIndexEntry](rows)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = a.S3.UploadObject(a.Bucket, AddressIndexKey(network, prefix, height), encoded, NewObjectMeta(encoded.Bytes(), rows[0].BlockHash))
+
+		if err != nil {
+			return fmt.Errorf("failed to upload address index of prefix=%s block=%d: %s", prefix, height, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// CompactionReport counts the files merged by a compaction
+type CompactionReport struct {
+	Network  NetworkType `json:"network"`
+	Prefixes int         `json:"prefixes"`
+	Merged   int         `json:"merged"`
+	Written  int         `json:"written"`
+}
+
+// Compact merges the index files of every prefix with at least minFiles files into one file covering their
+// blocks. Only the listed files are deleted, files written during the compaction are merged by the next one.
+func (a *AddressIndex) Compact(network NetworkType, minFiles int) (*CompactionReport, error) {
+	l := a.Logger.Sugar()
+
+	keys, err := a.S3.ListObjects(a.Bucket, fmt.Sprintf("chain=%s/network=%s/", Ethereum, network))
+
+	if err != nil {
+		return nil, err
+	}
+
+	byPrefix := make(map[string][]string)
+
+	for _, key := range *keys {
+		prefix, ok := indexPrefixOf(key)
+
+		if !ok {
+			continue
+		}
+
+		byPrefix[prefix] = append(byPrefix[prefix], key)
+	}
+
+	report := &CompactionReport{Network: network, Prefixes: len(byPrefix)}
+
+	for prefix, keys := range byPrefix {
+		if len(keys) < minFiles || len(keys) < 2 {
+			continue
+		}
+
+		files := make(map[string][]AddressIndexEntry)
+
+		for _, key := range keys {
+			buf, err := a.S3.Get(a.Bucket, key)
+
+			if err != nil {
+				return report, err
+			}
+
+			entries, err := ReadNDJSON[AddressIndexEntry](buf)
+
+			if err != nil {
+				return report, fmt.Errorf("failed to decode address index=%s: %s", key, err.Error())
+			}
+
+			files[key] = entries
+		}
+
+		merged := MergeIndexFiles(files)
+
+		if len(merged) == 0 {
+			continue
+		}
+
+		covered := BlockRange{From: merged[0].Height, To: merged[0].Height}
+
+		for _, entry := range merged {
+			if entry.Height < covered.From {
+				covered.From = entry.Height
+			}
+
+			if entry.Height > covered.To {
+				covered.To = entry.Height
+			}
+		}
+
+		compacted := CompactedIndexKey(network, prefix, covered)
+
+		encoded, err := NDJSON[AddressIndexEntry](merged)
+
+		if err != nil {
+			return report, err
+		}
+
+		_, err = a.S3.UploadObject(a.Bucket, compacted, encoded, NewObjectMeta(encoded.Bytes(), ""))
+
+		if err != nil {
+			return report, err
+		}
+
+		var stale []string
+
+		for _, key := range keys {
+			if key != compacted {
+				stale = append(stale, key)
+			}
+		}
+
+		_, err = a.S3.DeleteKeys(a.Bucket, stale)
+
+		if err != nil {
+			return report, err
+		}
+
+		l.Infof("compacted %d index files of prefix=%s into %s", len(keys), prefix, compacted)
+
+		report.Merged += len(keys)
+		report.Written++
+	}
+
+	return report, nil
+}
+
+// LookupAddress reads the index files of the address prefix and returns the entries of the address
+func LookupAddress(source PartitionSource, table string, network NetworkType, address string) ([]AddressIndexEntry, error) {
+	address = strings.ToLower(address)
+
+	objects, err := source.List(table, AddressIndexPrefix(network, AddressPrefix(address)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]AddressIndexEntry)
+
+	for _, object := range objects {
+		key := object.Key
+
+		entries, err := readPartition[AddressIndexEntry](source, table, key)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read address index=%s: %s", key, err.Error())
+		}
+
+		var matched []AddressIndexEntry
+
+		for _, entry := range entries {
+			if entry.Address == address {
+				matched = append(matched, entry)
+			}
+		}
+
+		files[key] = matched
+	}
+
+	return MergeIndexFiles(files), nil
+}
+
+// UploadAddressIndex writes the address index of the actions of a block, skipped when the index table doesn't exist
+func (c *EthereumCrawler) UploadAddressIndex(result *BlockEventsResult, actionPartition string) error {
+	if c.AddressIndex == nil {
+		return nil
+	}
+
+	return c.AddressIndex.Write(c.Config.Network, result.ActionPartitionKey.Block, BuildAddressIndex(result, actionPartition))
+}
+
+func indexPrefixOf(key string) (string, bool) {
+	for _, part := range strings.Split(key, "/") {
+		if strings.HasPrefix(part, "prefix=") {
+			return strings.TrimPrefix(part, "prefix="), true
+		}
+	}
+
+	return "", false
+}
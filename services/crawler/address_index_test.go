@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddressPrefix(t *testing.T) {
+	for address, expected := range map[string]string{"0xABcd01": "ab", "0x7": "07", "": "00"} {
+		if AddressPrefix(address) != expected {
+			t.Errorf("expected: %s, got: %s", expected, AddressPrefix(address))
+		}
+	}
+}
+
+func TestBuildAddressIndex(t *testing.T) {
+	result := &BlockEventsResult{
+		Events: []Event{
+			{Type: Block, Height: 7, Block: "0xb7"},
+			{Type: Transaction, Height: 7, Block: "0xb7", Transaction: "0xt1"},
+			{Type: Transaction, Height: 7, Block: "0xb7", Transaction: "0xt2"},
+		},
+		Action: []Action{
+			{Network: EthereumGoerli, Address: "0xAB01", Hash: "0xt1"},
+			{Network: EthereumGoerli, Address: "0xcd02", Hash: "0xt1"},
+			{Network: EthereumGoerli, Address: "0xab03", Hash: "0xt2"},
+			{Network: EthereumGoerli, Address: "0xab01", Hash: "0xinternal"},
+		},
+		ActionPartitionKey: Partition{Network: EthereumGoerli, Block: 7},
+	}
+
+	entries := BuildAddressIndex(result, "actions/block=7.ndjson")
+
+	if len(entries) != 2 || len(entries["ab"]) != 3 || len(entries["cd"]) != 1 {
+		t.Fatalf("expected 3 entries in ab and 1 in cd, got: %v", entries)
+	}
+
+	expected := AddressIndexEntry{
+		Address:   "0xab03",
+		Network:   EthereumGoerli,
+		Height:    7,
+		BlockHash: "0xb7",
+		TxHash:    "0xt2",
+		TxIndex:   1,
+		Partition: "actions/block=7.ndjson",
+		Row:       2,
+	}
+
+	if entries["ab"][1] != expected {
+		t.Errorf("expected: %v, got: %v", expected, entries["ab"][1])
+	}
+
+	if entries["ab"][2].TxIndex != -1 {
+		t.Errorf("expected: %d, got: %d", -1, entries["ab"][2].TxIndex)
+	}
+}
+
+func TestMergeIndexFiles(t *testing.T) {
+	compacted := CompactedIndexKey(EthereumGoerli, "ab", BlockRange{From: 1, To: 2})
+
+	files := map[string][]AddressIndexEntry{
+		compacted: {
+			{Address: "0xab01", Height: 1, BlockHash: "0x1", Row: 0},
+			{Address: "0xab01", Height: 2, BlockHash: "0x2-stale", Row: 0},
+		},
+		// left behind by a compaction that failed before deleting its inputs
+		CompactedIndexKey(EthereumGoerli, "ab", BlockRange{From: 1, To: 1}): {
+			{Address: "0xab01", Height: 1, BlockHash: "0x1", Row: 0},
+		},
+		// block 2 crawled again after the compaction
+		AddressIndexKey(EthereumGoerli, "ab", 2): {
+			{Address: "0xab01", Height: 2, BlockHash: "0x2", Row: 1},
+		},
+		AddressIndexKey(EthereumGoerli, "ab", 3): {
+			{Address: "0xab99", Height: 3, BlockHash: "0x3", Row: 0},
+			{Address: "0xab01", Height: 3, BlockHash: "0x3", Row: 4},
+		},
+	}
+
+	merged := MergeIndexFiles(files)
+
+	expected := []string{"0xab01@1:0x1", "0xab01@2:0x2", "0xab01@3:0x3", "0xab99@3:0x3"}
+
+	if len(merged) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, merged)
+	}
+
+	for i, entry := range merged {
+		got := fmt.Sprintf("%s@%d:%s", entry.Address, entry.Height, entry.BlockHash)
+
+		if got != expected[i] {
+			t.Errorf("expected: %v, got: %v", expected[i], got)
+		}
+	}
+}
+
+func TestLookupAddress(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string][]AddressIndexEntry{
+		CompactedIndexKey(EthereumGoerli, "ab", BlockRange{From: 1, To: 5}): {
+			{Address: "0xab01", Height: 1, Partition: "p1", Row: 0},
+			{Address: "0xab02", Height: 5, Partition: "p5", Row: 0},
+		},
+		AddressIndexKey(EthereumGoerli, "ab", 9): {
+			{Address: "0xab01", Height: 9, Partition: "p9", Row: 3},
+		},
+		AddressIndexKey(EthereumGoerli, "cd", 9): {
+			{Address: "0xcd01", Height: 9, Partition: "p9", Row: 0},
+		},
+	}
+
+	for key, entries := range files {
+		encoded, err := NDJSON[AddressIndexEntry](entries)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := filepath.Join(dir, "address_index", filepath.FromSlash(key))
+
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(file, encoded.Bytes(), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := LookupAddress(&DirSource{Dir: dir}, "address_index", EthereumGoerli, "0xAB01")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Partition != "p1" || entries[1].Partition != "p9" || entries[1].Row != 3 {
+		t.Errorf("expected the entries of blocks 1 and 9, got: %v", entries)
+	}
+}
+
+func TestStaleIndexKeys(t *testing.T) {
+	keys := StaleIndexKeys(EthereumGoerli, 7, map[string][]AddressIndexEntry{"ab": {{Address: "0xab01"}}})
+
+	if len(keys) != 255 {
+		t.Fatalf("expected: %d, got: %d", 255, len(keys))
+	}
+
+	for _, key := range keys {
+		if key == AddressIndexKey(EthereumGoerli, "ab", 7) {
+			t.Errorf("expected the written prefix to be kept")
+		}
+	}
+
+	if keys[0] != AddressIndexKey(EthereumGoerli, "00", 7) || keys[254] != AddressIndexKey(EthereumGoerli, "ff", 7) {
+		t.Errorf("unexpected keys: %s ... %s", keys[0], keys[254])
+	}
+}
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAPIAddr = ":8080"
+	// events are read partition by partition, wider ranges are rejected
+	MaxAPIBlockRange = 1000
+	DefaultPageSize  = 100
+	MaxPageSize      = 1000
+)
+
+// PartitionSource reads partitions back from a sink, tables are bucket names in s3 and directories locally
+type PartitionSource interface {
+	List(table, prefix string) ([]PartitionObject, error)
+	Open(table, key string) (io.ReadCloser, error)
+}
+
+// PartitionObject is a listed partition and the time it was last written
+type PartitionObject struct {
+	Key      string
+	Modified time.Time
+}
+
+// S3Source reads partitions from s3
+type S3Source struct {
+	S3 *S3Service
+}
+
+func (s *S3Source) List(table, prefix string) ([]PartitionObject, error) {
+	return s.S3.ListPartitionObjects(table, prefix)
+}
+
+func (s *S3Source) Open(table, key string) (io.ReadCloser, error) {
+	buf, err := s.S3.Get(table, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(buf), nil
+}
+
+// DirSource reads partitions from a local mirror of the buckets, one directory per table (e.g. aws s3 sync s3://<bucket> <dir>/<bucket>)
+type DirSource struct {
+	Dir string
+}
+
+func (d *DirSource) List(table, prefix string) ([]PartitionObject, error) {
+	root := filepath.Join(d.Dir, table)
+
+	var objects []PartitionObject
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, PartitionObject{Key: key, Modified: info.ModTime()})
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (d *DirSource) Open(table, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.Dir, table, filepath.FromSlash(key)))
+}
+
+// APITables are the tables the read api serves
+type APITables struct {
+	Events         string
+	Actions        string
+	ContractEvents string
+	// actions of an address are looked up in the address index instead of being indexed in memory when set
+	AddressIndex string
+}
+
+// RowRef points at a row of a partition
+type RowRef struct {
+	Height   uint64
+	Key      string
+	Position int
+}
+
+type networkIndex struct {
+	events    map[uint64]string
+	latest    uint64
+	addresses map[string][]RowRef
+	// contract event rows by event name
+	contractEvents map[string][]RowRef
+}
+
+// ReadIndex is the in-process index of the partitions in a sink, rows are only read when queried
+type ReadIndex struct {
+	mu       sync.RWMutex
+	networks map[NetworkType]*networkIndex
+	// modification time of the indexed partitions by table and key
+	indexed map[string]map[string]time.Time
+}
+
+// PartitionNetwork parses the network out of a partition key (e.g. chain=ethereum/network=goerli/...)
+func PartitionNetwork(key string) (NetworkType, bool) {
+	for _, part := range strings.Split(key, "/") {
+		if strings.HasPrefix(part, "network=") {
+			return NetworkType(strings.TrimPrefix(part, "network=")), true
+		}
+	}
+
+	return "", false
+}
+
+// BuildReadIndex lists the event partitions and reads the action and contract event partitions
+// to index them by address and event name
+func BuildReadIndex(source PartitionSource, tables APITables) (*ReadIndex, error) {
+	return (&ReadIndex{}).Update(source, tables)
+}
+
+// Update returns a copy of the index with the partitions written or removed since the index was built,
+// only the partitions modified since then are read. The index itself is left untouched for the requests reading it
+func (i *ReadIndex) Update(source PartitionSource, tables APITables) (*ReadIndex, error) {
+	index := i.clone()
+
+	// the refs shared with the previous index are copied before they are changed and sorted
+	addresses := make(map[*networkIndex]map[string]bool)
+	contractEvents := make(map[*networkIndex]map[string]bool)
+
+	touched := func(refs map[*networkIndex]map[string]bool, n *networkIndex) map[string]bool {
+		if refs[n] == nil {
+			refs[n] = make(map[string]bool)
+		}
+
+		return refs[n]
+	}
+
+	network := func(key string) (*networkIndex, uint64, bool) {
+		name, ok := PartitionNetwork(key)
+
+		if !ok {
+			return nil, 0, false
+		}
+
+		height, ok := PartitionHeight(key)
+
+		if !ok {
+			return nil, 0, false
+		}
+
+		n, ok := index.networks[name]
+
+		if !ok {
+			n = &networkIndex{
+				events:         make(map[uint64]string),
+				addresses:      make(map[string][]RowRef),
+				contractEvents: make(map[string][]RowRef),
+			}
+			index.networks[name] = n
+		}
+
+		return n, height, true
+	}
+
+	changed, removed, err := index.changes(source, tables.Events)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(removed) > 0 {
+		for _, n := range index.networks {
+			for height, key := range n.events {
+				if removed[key] {
+					delete(n.events, height)
+				}
+			}
+
+			n.latest = 0
+
+			for height := range n.events {
+				if height > n.latest {
+					n.latest = height
+				}
+			}
+		}
+	}
+
+	for _, key := range changed {
+		n, height, ok := network(key)
+
+		if !ok {
+			continue
+		}
+
+		n.events[height] = key
+
+		if height > n.latest {
+			n.latest = height
+		}
+	}
+
+	if tables.Actions != "" && tables.AddressIndex == "" {
+		changed, removed, err = index.changes(source, tables.Actions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range index.networks {
+			dropRefs(n.addresses, removed, touched(addresses, n))
+		}
+
+		for _, key := range changed {
+			n, height, ok := network(key)
+
+			if !ok {
+				continue
+			}
+
+			actions, err := readPartition[Action](source, tables.Actions, key)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for position, action := range actions {
+				address := strings.ToLower(action.Address)
+				addRef(n.addresses, touched(addresses, n), address, RowRef{Height: height, Key: key, Position: position})
+			}
+		}
+	}
+
+	if tables.ContractEvents != "" {
+		changed, removed, err = index.changes(source, tables.ContractEvents)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range index.networks {
+			dropRefs(n.contractEvents, removed, touched(contractEvents, n))
+		}
+
+		for _, key := range changed {
+			n, height, ok := network(key)
+
+			if !ok {
+				continue
+			}
+
+			records, err := readPartition[ContractEventRecord](source, tables.ContractEvents, key)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for position, record := range records {
+				addRef(n.contractEvents, touched(contractEvents, n), record.Event, RowRef{Height: height, Key: key, Position: position})
+			}
+		}
+	}
+
+	for n, names := range addresses {
+		for address := range names {
+			SortRowRefs(n.addresses[address])
+		}
+	}
+
+	for n, names := range contractEvents {
+		for event := range names {
+			SortRowRefs(n.contractEvents[event])
+		}
+	}
+
+	return index, nil
+}
+
+// changes lists the partitions of a table and returns the keys written since they were indexed, and the keys
+// that were removed or rewritten so their rows are dropped before they are read again
+func (i *ReadIndex) changes(source PartitionSource, table string) ([]string, map[string]bool, error) {
+	objects, err := source.List(table, fmt.Sprintf("chain=%s/", Ethereum))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modified := make(map[string]time.Time, len(objects))
+	keys := make([]string, len(objects))
+
+	for j, object := range objects {
+		modified[object.Key] = object.Modified
+		keys[j] = object.Key
+	}
+
+	previous := i.indexed[table]
+	current := make(map[string]time.Time, len(objects))
+
+	var changed []string
+
+	removed := make(map[string]bool)
+
+	for _, key := range UniquePartitions(keys) {
+		current[key] = modified[key]
+
+		indexed, ok := previous[key]
+
+		if ok && indexed.Equal(modified[key]) {
+			continue
+		}
+
+		if ok {
+			removed[key] = true
+		}
+
+		changed = append(changed, key)
+	}
+
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			removed[key] = true
+		}
+	}
+
+	i.indexed[table] = current
+
+	return changed, removed, nil
+}
+
+// clone copies the maps of the index, the refs are shared until they are changed
+func (i *ReadIndex) clone() *ReadIndex {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	index := &ReadIndex{
+		networks: make(map[NetworkType]*networkIndex, len(i.networks)),
+		indexed:  make(map[string]map[string]time.Time, len(i.indexed)),
+	}
+
+	for name, n := range i.networks {
+		copied := &networkIndex{
+			events:         make(map[uint64]string, len(n.events)),
+			latest:         n.latest,
+			addresses:      make(map[string][]RowRef, len(n.addresses)),
+			contractEvents: make(map[string][]RowRef, len(n.contractEvents)),
+		}
+
+		for height, key := range n.events {
+			copied.events[height] = key
+		}
+
+		for address, refs := range n.addresses {
+			copied.addresses[address] = refs
+		}
+
+		for event, refs := range n.contractEvents {
+			copied.contractEvents[event] = refs
+		}
+
+		index.networks[name] = copied
+	}
+
+	for table, keys := range i.indexed {
+		index.indexed[table] = keys
+	}
+
+	return index
+}
+
+// addRef adds a ref, the refs shared with the previous index are copied first
+func addRef(refs map[string][]RowRef, touched map[string]bool, name string, ref RowRef) {
+	if !touched[name] {
+		refs[name] = append([]RowRef(nil), refs[name]...)
+		touched[name] = true
+	}
+
+	refs[name] = append(refs[name], ref)
+}
+
+// dropRefs removes the refs pointing at the removed keys
+func dropRefs(refs map[string][]RowRef, removed map[string]bool, touched map[string]bool) {
+	if len(removed) == 0 {
+		return
+	}
+
+	for name, existing := range refs {
+		var kept []RowRef
+
+		for _, ref := range existing {
+			if !removed[ref.Key] {
+				kept = append(kept, ref)
+			}
+		}
+
+		if len(kept) == len(existing) {
+			continue
+		}
+
+		touched[name] = true
+
+		if len(kept) == 0 {
+			delete(refs, name)
+			continue
+		}
+
+		refs[name] = kept
+	}
+}
+
+// SortRowRefs sorts refs newest first
+func SortRowRefs(refs []RowRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Height != refs[j].Height {
+			return refs[i].Height > refs[j].Height
+		}
+		return refs[i].Position > refs[j].Position
+	})
+}
+
+// Latest returns the highest indexed height of every network
+func (i *ReadIndex) Latest() map[NetworkType]uint64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	latest := make(map[NetworkType]uint64)
+
+	for name, n := range i.networks {
+		latest[name] = n.latest
+	}
+
+	return latest
+}
+
+func (i *ReadIndex) network(name NetworkType) (*networkIndex, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	n, ok := i.networks[name]
+	return n, ok
+}
+
+// APIServer answers queries over the crawled data of a sink
+type APIServer struct {
+	*Logger
+	Source PartitionSource
+	Tables APITables
+	mu     sync.RWMutex
+	index  *ReadIndex
+}
+
+func NewAPIServer(logger *Logger, source PartitionSource, tables APITables) (*APIServer, error) {
+	server := &APIServer{
+		Logger: logger,
+		Source: source,
+		Tables: tables,
+	}
+
+	err := server.Refresh()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Refresh indexes the partitions written or removed since the last refresh
+func (s *APIServer) Refresh() error {
+	previous := s.Index()
+
+	if previous == nil {
+		previous = &ReadIndex{}
+	}
+
+	index, err := previous.Update(s.Source, s.Tables)
+
+	if err != nil {
+		return fmt.Errorf("failed to build read index: %s", err.Error())
+	}
+
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *APIServer) Index() *ReadIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.index
+}
+
+// Handler routes:
+//
+//	GET /v1/heights                                           latest processed height per network
+//	GET /v1/{network}/events?from=&to=                        block and transaction events by block range
+//	GET /v1/{network}/actions/{address}?limit=&cursor=        wallet actions of an address, newest first
+//	GET /v1/{network}/contract-events/{event}?limit=&cursor=  contract events by type, newest first
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/heights", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Index().Latest())
+	})
+
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/")
+
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+			return
+		}
+
+		if len(parts) < 2 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown path: %s", r.URL.Path))
+			return
+		}
+
+		n, ok := s.Index().network(NetworkType(parts[0]))
+
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown network: %s", parts[0]))
+			return
+		}
+
+		switch {
+		case parts[1] == "events" && len(parts) == 2:
+			s.serveEvents(w, r, n)
+		case parts[1] == "actions" && len(parts) == 3:
+			refs, err := s.addressRefs(NetworkType(parts[0]), n, parts[2])
+
+			if err != nil {
+				s.Logger.Sugar().Errorf("failed to look up address=%s: %s", parts[2], err.Error())
+				writeError(w, http.StatusInternalServerError, errors.New("failed to look up address"))
+				return
+			}
+
+			s.serveRows(w, r, s.Tables.Actions, refs, func(key string) (func(int) (interface{}, bool), error) {
+				rows, err := readPartition[Action](s.Source, s.Tables.Actions, key)
+				return func(i int) (interface{}, bool) {
+					if i < 0 || i >= len(rows) || !strings.EqualFold(rows[i].Address, parts[2]) {
+						return nil, false
+					}
+					return rows[i], true
+				}, err
+			})
+		case parts[1] == "contract-events" && len(parts) == 3:
+			s.serveRows(w, r, s.Tables.ContractEvents, n.contractEvents[parts[2]], func(key string) (func(int) (interface{}, bool), error) {
+				rows, err := readPartition[ContractEventRecord](s.Source, s.Tables.ContractEvents, key)
+				return func(i int) (interface{}, bool) {
+					if i < 0 || i >= len(rows) || rows[i].Event != parts[2] {
+						return nil, false
+					}
+					return rows[i], true
+				}, err
+			})
+		default:
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown path: %s", r.URL.Path))
+		}
+	})
+
+	return mux
+}
+
+// addressRefs returns the actions of an address newest first, from the address index when the sink has one
+func (s *APIServer) addressRefs(network NetworkType, n *networkIndex, address string) ([]RowRef, error) {
+	if s.Tables.AddressIndex == "" {
+		return n.addresses[strings.ToLower(address)], nil
+	}
+
+	entries, err := LookupAddress(s.Source, s.Tables.AddressIndex, network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]RowRef, len(entries))
+
+	for i, entry := range entries {
+		refs[i] = RowRef{Height: entry.Height, Key: entry.Partition, Position: entry.Row}
+	}
+
+	SortRowRefs(refs)
+	return refs, nil
+}
+
+func (s *APIServer) serveEvents(w http.ResponseWriter, r *http.Request, n *networkIndex) {
+	from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("from must be a block number"))
+		return
+	}
+
+	to := from
+
+	if r.URL.Query().Get("to") != "" {
+		to, err = strconv.ParseUint(r.URL.Query().Get("to"), 10, 64)
+
+		if err != nil || to < from {
+			writeError(w, http.StatusBadRequest, errors.New("to must be a block number not below from"))
+			return
+		}
+	}
+
+	if to-from >= MaxAPIBlockRange {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("block range is limited to %d blocks", MaxAPIBlockRange))
+		return
+	}
+
+	events := []Event{}
+
+	// count the blocks instead of comparing the height to to, which never fails at the top of the uint64 range
+	for i := uint64(0); i <= to-from; i++ {
+		height := from + i
+
+		key, ok := n.events[height]
+
+		if !ok {
+			continue
+		}
+
+		rows, err := readPartition[Event](s.Source, s.Tables.Events, key)
+
+		if err != nil {
+			s.Logger.Sugar().Errorf("failed to read partition=%s: %s", key, err.Error())
+			writeError(w, http.StatusInternalServerError, errors.New("failed to read events"))
+			return
+		}
+
+		events = append(events, rows...)
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// Page is a page of rows, the next cursor is empty on the last page
+type Page struct {
+	Rows       []interface{} `json:"rows"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// serveRows pages through the indexed rows, the cursor is the offset of the next page. Rows a ref no longer points
+// at (e.g. the partition was rewritten after the index was built) are skipped
+func (s *APIServer) serveRows(w http.ResponseWriter, r *http.Request, table string, refs []RowRef, read func(key string) (func(int) (interface{}, bool), error)) {
+	limit, offset, err := PageParams(r)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page := Page{Rows: []interface{}{}}
+
+	if offset >= len(refs) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	end := offset + limit
+
+	if end > len(refs) {
+		end = len(refs)
+	} else if end < len(refs) {
+		page.NextCursor = strconv.Itoa(end)
+	}
+
+	rows := make(map[string]func(int) (interface{}, bool))
+
+	for _, ref := range refs[offset:end] {
+		row, ok := rows[ref.Key]
+
+		if !ok {
+			at, err := read(ref.Key)
+
+			if err != nil {
+				s.Logger.Sugar().Errorf("failed to read partition=%s of table=%s: %s", ref.Key, table, err.Error())
+				writeError(w, http.StatusInternalServerError, errors.New("failed to read rows"))
+				return
+			}
+
+			row = at
+			rows[ref.Key] = at
+		}
+
+		value, ok := row(ref.Position)
+
+		if !ok {
+			s.Logger.Sugar().Warnf("skipping stale ref partition=%s row=%d of table=%s", ref.Key, ref.Position, table)
+			continue
+		}
+
+		page.Rows = append(page.Rows, value)
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// PageParams parses the limit and cursor query parameters
+func PageParams(r *http.Request) (int, int, error) {
+	limit := DefaultPageSize
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+
+		if err != nil || parsed < 1 || parsed > MaxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+
+		limit = parsed
+	}
+
+	offset := 0
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+func readPartition[T Event | Action | ContractEventRecord | AddressIndexEntry](source PartitionSource, table, key string) ([]T, error) {
+	reader, err := source.Open(table, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return ReadPartition[T](key, reader)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// NewAPISource returns the sink the api reads from, a local directory when dir is set and the glue tables in s3 otherwise
+func NewAPISource(config Config, dir string) (PartitionSource, APITables, error) {
+	if dir != "" {
+		tables := APITables{Events: "events", Actions: "actions", ContractEvents: "contract_events"}
+
+		if info, err := os.Stat(filepath.Join(dir, "address_index")); err == nil && info.IsDir() {
+			tables.AddressIndex = "address_index"
+		}
+
+		return &DirSource{Dir: dir}, tables, nil
+	}
+
+	glue, s3c, err := NewSinkServices(config)
+
+	if err != nil {
+		return nil, APITables{}, err
+	}
+
+	tables := APITables{
+		Events:         glue.EventMeta.Bucket,
+		Actions:        glue.ActionMeta.Bucket,
+		ContractEvents: glue.ContractEventMeta.Bucket,
+		AddressIndex:   glue.AddressIndexMeta.Bucket,
+	}
+
+	return &S3Source{S3: s3c}, tables, nil
+}
+
+// RefreshEvery refreshes the index on every tick until done is closed, a failed refresh keeps serving the previous index
+func (s *APIServer) RefreshEvery(interval time.Duration, done <-chan struct{}) {
+	l := s.Logger.Sugar()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := s.Refresh()
+
+			if err != nil {
+				l.Warnf("keeping the previous index: %s", err.Error())
+			}
+		}
+	}
+}
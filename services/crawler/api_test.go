@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestPartition[T Event | Action | DecodedEvent](t *testing.T, dir, table, key string, rows []T) {
+	t.Helper()
+
+	encoded, err := EncodePartition(rows, CompressionOf(key))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, table, filepath.FromSlash(key))
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(file, encoded.Bytes(), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	writeTestPartition(t, dir, "events", "chain=ethereum/network=goerli/year=2023/month=07/block=10.ndjson", []Event{
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Block, Height: 10, Block: "0xa"},
+	})
+	writeTestPartition(t, dir, "events", "chain=ethereum/network=goerli/year=2023/month=07/block=11.ndjson.gz", []Event{
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Block, Height: 11, Block: "0xb"},
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Transaction, Height: 11, Block: "0xb", Transaction: "0xc"},
+	})
+	writeTestPartition(t, dir, "events", "chain=ethereum/network=mainnet/year=2023/month=07/block=99.ndjson", []Event{
+		{Chain: Ethereum, Network: EthereumMainnet, Type: Block, Height: 99, Block: "0xd"},
+	})
+
+	for height, hash := range map[string]string{"10": "0x1", "11": "0x2", "12": "0x3"} {
+		writeTestPartition(t, dir, "actions", "chain=ethereum/network=goerli/year=2023/month=07/block="+height+".ndjson", []Action{
+			{Chain: Ethereum, Network: EthereumGoerli, Address: "0xABC", Hash: hash},
+			{Chain: Ethereum, Network: EthereumGoerli, Address: "0xdef", Hash: hash},
+		})
+	}
+
+	logger, err := NewConsoleLogger()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, tables, err := NewAPISource(Config{}, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewAPIServer(logger, source, tables)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func getJSON(t *testing.T, url string, status int, body interface{}) {
+	t.Helper()
+
+	res, err := http.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		t.Fatalf("expected: %d, got: %d for %s", status, res.StatusCode, url)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIHeightsAndEvents(t *testing.T) {
+	ts := newTestAPIServer(t)
+
+	var heights map[NetworkType]uint64
+	getJSON(t, ts.URL+"/v1/heights", http.StatusOK, &heights)
+
+	if heights[EthereumGoerli] != 11 || heights[EthereumMainnet] != 99 {
+		t.Errorf("expected: %v, got: %v", map[NetworkType]uint64{EthereumGoerli: 11, EthereumMainnet: 99}, heights)
+	}
+
+	var events []Event
+	getJSON(t, ts.URL+"/v1/goerli/events?from=9&to=11", http.StatusOK, &events)
+
+	if len(events) != 3 || events[0].Block != "0xa" || events[2].Transaction != "0xc" {
+		t.Errorf("expected 3 events of blocks 10 and 11, got: %v", events)
+	}
+
+	// a range ending at the last uint64 height stops instead of wrapping around
+	var top []Event
+	getJSON(t, ts.URL+fmt.Sprintf("/v1/goerli/events?from=%d&to=%d", uint64(math.MaxUint64)-2, uint64(math.MaxUint64)), http.StatusOK, &top)
+
+	if len(top) != 0 {
+		t.Errorf("expected no events at the top of the range, got: %v", top)
+	}
+
+	var failure map[string]string
+	getJSON(t, ts.URL+"/v1/goerli/events?from=0&to=5000", http.StatusBadRequest, &failure)
+
+	if failure["error"] == "" {
+		t.Errorf("expected an error for a range above %d blocks", MaxAPIBlockRange)
+	}
+
+	getJSON(t, ts.URL+"/v1/holesky/events?from=1", http.StatusNotFound, &failure)
+}
+
+func TestAPIActionsPagination(t *testing.T) {
+	ts := newTestAPIServer(t)
+
+	var hashes []string
+	cursor := ""
+
+	for page := 0; page < 5; page++ {
+		var body struct {
+			Rows       []Action `json:"rows"`
+			NextCursor string   `json:"next_cursor"`
+		}
+
+		getJSON(t, ts.URL+"/v1/goerli/actions/0xabc?limit=2&cursor="+cursor, http.StatusOK, &body)
+
+		for _, action := range body.Rows {
+			hashes = append(hashes, action.Hash)
+		}
+
+		cursor = body.NextCursor
+
+		if cursor == "" {
+			break
+		}
+	}
+
+	expected := []string{"0x3", "0x2", "0x1"}
+
+	if len(hashes) != len(expected) || hashes[0] != expected[0] || hashes[2] != expected[2] {
+		t.Errorf("expected: %v, got: %v", expected, hashes)
+	}
+}
+
+func TestAPIStaleAddressIndex(t *testing.T) {
+	dir := t.TempDir()
+	key := "chain=ethereum/network=goerli/year=2023/month=07/block=12.ndjson"
+
+	writeTestPartition(t, dir, "events", key, []Event{
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Block, Height: 12, Block: "0xa"},
+	})
+	writeTestPartition(t, dir, "actions", key, []Action{
+		{Chain: Ethereum, Network: EthereumGoerli, Address: "0xabc", Hash: "0x1"},
+		{Chain: Ethereum, Network: EthereumGoerli, Address: "0xdef", Hash: "0x2"},
+	})
+
+	// the index points at a row of another address and past the end of the partition, e.g. after a reorg
+	encoded, err := NDJSON[AddressIndexEntry]([]AddressIndexEntry{
+		{Address: "0xabc", Network: EthereumGoerli, Height: 12, Partition: key, Row: 0},
+		{Address: "0xabc", Network: EthereumGoerli, Height: 12, Partition: key, Row: 1},
+		{Address: "0xabc", Network: EthereumGoerli, Height: 12, Partition: key, Row: 7},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "address_index", filepath.FromSlash(AddressIndexKey(EthereumGoerli, "ab", 12)))
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(file, encoded.Bytes(), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := NewConsoleLogger()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, tables, err := NewAPISource(Config{}, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tables.AddressIndex == "" {
+		t.Fatal("expected the address index table")
+	}
+
+	server, err := NewAPIServer(logger, source, tables)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+
+	var body struct {
+		Rows []Action `json:"rows"`
+	}
+
+	getJSON(t, ts.URL+"/v1/goerli/actions/0xabc", http.StatusOK, &body)
+
+	if len(body.Rows) != 1 || body.Rows[0].Hash != "0x1" {
+		t.Errorf("expected only the action of the address, got: %v", body.Rows)
+	}
+}
+
+// countingSource counts the partitions opened
+type countingSource struct {
+	*DirSource
+	opened map[string]int
+}
+
+func (s *countingSource) Open(table, key string) (io.ReadCloser, error) {
+	s.opened[key]++
+	return s.DirSource.Open(table, key)
+}
+
+func TestReadIndexUpdate(t *testing.T) {
+	dir := t.TempDir()
+	prefix := "chain=ethereum/network=goerli/year=2023/month=07/"
+
+	for height, hash := range map[string]string{"10": "0x1", "11": "0x2"} {
+		writeTestPartition(t, dir, "actions", prefix+"block="+height+".ndjson", []Action{
+			{Chain: Ethereum, Network: EthereumGoerli, Address: "0xabc", Hash: hash},
+		})
+	}
+
+	source := &countingSource{DirSource: &DirSource{Dir: dir}, opened: make(map[string]int)}
+	tables := APITables{Events: "events", Actions: "actions"}
+
+	index, err := BuildReadIndex(source, tables)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block 11 is rewritten after a reorg, block 12 is new and block 10 is recompressed
+	writeTestPartition(t, dir, "actions", prefix+"block=11.ndjson", []Action{
+		{Chain: Ethereum, Network: EthereumGoerli, Address: "0xdef", Hash: "0x4"},
+	})
+	writeTestPartition(t, dir, "actions", prefix+"block=12.ndjson", []Action{
+		{Chain: Ethereum, Network: EthereumGoerli, Address: "0xabc", Hash: "0x3"},
+	})
+
+	later := time.Now().Add(time.Minute)
+
+	err = os.Chtimes(filepath.Join(dir, "actions", prefix+"block=11.ndjson"), later, later)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestPartition(t, dir, "actions", prefix+"block=10.ndjson.gz", []Action{
+		{Chain: Ethereum, Network: EthereumGoerli, Address: "0xabc", Hash: "0x1"},
+	})
+
+	err = os.Remove(filepath.Join(dir, "actions", prefix+"block=10.ndjson"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := index.Update(source, tables)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]int{"block=10.ndjson": 1, "block=10.ndjson.gz": 1, "block=11.ndjson": 2, "block=12.ndjson": 1} {
+		if source.opened[prefix+key] != expected {
+			t.Errorf("%s: expected: %d, got: %d", key, expected, source.opened[prefix+key])
+		}
+	}
+
+	goerli, _ := updated.network(EthereumGoerli)
+	refs := goerli.addresses["0xabc"]
+
+	if len(refs) != 2 || refs[0].Height != 12 || refs[1].Key != prefix+"block=10.ndjson.gz" || len(goerli.addresses["0xdef"]) != 1 {
+		t.Errorf("unexpected refs after the update: %v, %v", refs, goerli.addresses["0xdef"])
+	}
+
+	previous, _ := index.network(EthereumGoerli)
+
+	if len(previous.addresses["0xabc"]) != 2 || previous.addresses["0xabc"][0].Height != 11 {
+		t.Errorf("expected the previous index to be left untouched, got: %v", previous.addresses["0xabc"])
+	}
+}
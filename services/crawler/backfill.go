@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	DefaultLogWindow = 10_000
+	MinLogWindow     = 1
+	MaxLogWindow     = 500_000
+	// windows with fewer logs than this grow for the next query
+	SparseLogCount = 100
+	// json-rpc code used by infura, alchemy and geth when a query exceeds the result or range limit
+	LimitExceededCode = -32005
+)
+
+// ContractEventRecord is a decoded contract log, it follows common/data/src/schemas/event.schema.json
+type ContractEventRecord struct {
+	Network     NetworkType `json:"network"`
+	BlockNumber uint64      `json:"block_number"`
+	BlockHash   string      `json:"block_hash"`
+	TxHash      string      `json:"tx_hash"`
+	LogIndex    uint        `json:"log_index"`
+	Timestamp   uint64      `json:"timestamp"`
+	Contract    string      `json:"contract"`
+	Event       string      `json:"event"`
+	Sender      string      `json:"sender"`
+	Amount      string      `json:"amount"`
+}
+
+// LogScanner walks a block range with eth_getLogs, halving the window when the provider rejects a
+// query as too large and doubling it when a window comes back sparse
+type LogScanner struct {
+	Client    ethereum.LogFilterer
+	Window    uint64
+	MinWindow uint64
+	MaxWindow uint64
+	// addresses to filter, read before every query so contracts discovered mid-scan are included
+	Addresses func() []common.Address
+}
+
+func NewLogScanner(client ethereum.LogFilterer, window uint64, addresses func() []common.Address) *LogScanner {
+	if window == 0 {
+		window = DefaultLogWindow
+	}
+
+	return &LogScanner{
+		Client:    client,
+		Window:    window,
+		MinWindow: MinLogWindow,
+		MaxWindow: MaxLogWindow,
+		Addresses: addresses,
+	}
+}
+
+// Scan calls handle with the logs of every window between from and to in block order
+func (s *LogScanner) Scan(ctx context.Context, from, to uint64, handle func(logs []types.Log, from, to uint64) error) error {
+	if to < from {
+		return fmt.Errorf("invalid log range: from=%d to=%d", from, to)
+	}
+
+	start := from
+
+	for start <= to {
+		end := start + s.Window - 1
+
+		if end > to || end < start {
+			end = to
+		}
+
+		logs, err := s.Client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: s.Addresses(),
+		})
+
+		if err != nil {
+			if !IsTooManyResults(err) {
+				return fmt.Errorf("failed to filter logs from=%d to=%d: %s", start, end, err.Error())
+			}
+
+			if s.Window <= s.MinWindow {
+				return fmt.Errorf("log window can't shrink below %d blocks at block=%d: %s", s.MinWindow, start, err.Error())
+			}
+
+			s.Window /= 2
+
+			if s.Window < s.MinWindow {
+				s.Window = s.MinWindow
+			}
+
+			continue
+		}
+
+		err = handle(logs, start, end)
+
+		if err != nil {
+			return err
+		}
+
+		if len(logs) < SparseLogCount && s.Window < s.MaxWindow {
+			s.Window *= 2
+
+			if s.Window > s.MaxWindow {
+				s.Window = s.MaxWindow
+			}
+		}
+
+		start = end + 1
+	}
+
+	return nil
+}
+
+// IsTooManyResults returns true when the provider rejected a log query for its result count or block range,
+// matched on the limit code and known provider messages so unrelated errors (e.g. an invalid range or a rate
+// limit) aren't retried with smaller windows
+func IsTooManyResults(err error) bool {
+	var rpcErr rpc.Error
+
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == LimitExceededCode {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	for _, s := range LogLimitMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LogLimitMessages are the messages providers reject oversized eth_getLogs queries with
+var LogLimitMessages = []string{
+	// infura
+	"query returned more than",
+	// alchemy
+	"log response size exceeded",
+	// ankr, blast and other erigon based providers
+	"exceed maximum block range",
+	// quicknode and cloudflare
+	"block range is too wide",
+	"range too large",
+	"range is too large",
+}
+
+// DeploymentBlock binary searches the first block where the contract has code
+func DeploymentBlock(ctx context.Context, client ethereum.ChainStateReader, address common.Address, head uint64) (uint64, error) {
+	code, err := client.CodeAt(ctx, address, new(big.Int).SetUint64(head))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(code) == 0 {
+		return 0, fmt.Errorf("no contract code at address=%s block=%d", address.Hex(), head)
+	}
+
+	low, high := uint64(0), head
+
+	for low < high {
+		mid := low + (high-low)/2
+
+		code, err := client.CodeAt(ctx, address, new(big.Int).SetUint64(mid))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if len(code) > 0 {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return low, nil
+}
+
+// NewContractEventRecord builds the schema row of a decoded log, sender and amount are empty for events without them
+func NewContractEventRecord(network NetworkType, log ContractLog, timestamp uint64) ContractEventRecord {
+	record := ContractEventRecord{
+		Network:     network,
+		BlockNumber: log.Log.BlockNumber,
+		BlockHash:   log.Log.BlockHash.Hex(),
+		TxHash:      log.Log.TxHash.Hex(),
+		LogIndex:    log.Log.Index,
+		Timestamp:   timestamp,
+		Contract:    log.Log.Address.Hex(),
+		Event:       log.Event,
+	}
+
+	if sender, ok := log.Args["sender"].(common.Address); ok {
+		record.Sender = sender.Hex()
+	}
+
+	if amount, ok := log.Args["amount"].(*big.Int); ok {
+		record.Amount = amount.String()
+	}
+
+	return record
+}
+
+// BackfillContractEvents scans the logs of the manager and its discovered contracts between from and to
+// and uploads the decoded events to the contract events table, from defaults to the manager deployment block
+func (c *EthereumCrawler) BackfillContractEvents(from, to, window uint64) error {
+	l := c.Logger.Sugar()
+
+	if c.Config.Writes(S3Sink) && c.Glue.ContractEventMeta.Bucket == "" {
+		return errors.New("contract events table not found")
+	}
+
+	manager, err := c.Manager()
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if from == 0 {
+		deployed, err := DeploymentBlock(ctx, c.Client, manager, to)
+
+		if err != nil {
+			return fmt.Errorf("failed to find manager deployment block: %s", err.Error())
+		}
+
+		from = deployed
+	}
+
+	l.Infof("backfilling contract events from=%d to=%d window=%d", from, to, window)
+
+	scanner := NewLogScanner(c.Client, window, c.Contracts.Addresses)
+
+	return scanner.Scan(ctx, from, to, func(logs []types.Log, start, end uint64) error {
+		pointers := make([]*types.Log, len(logs))
+
+		for i := range logs {
+			pointers[i] = &logs[i]
+		}
+
+		byHeight := make(map[uint64][]ContractEventRecord)
+		var heights []uint64
+		times := make(map[uint64]uint64)
+
+		events := 0
+
+		for _, log := range DecodeContractLogs(c.Contracts, c.ContractABIs, pointers) {
+			height := log.Log.BlockNumber
+
+			timestamp, ok := times[height]
+
+			if !ok {
+				header, err := c.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+
+				if err != nil {
+					return fmt.Errorf("failed to get header=%d: %s", height, err.Error())
+				}
+
+				timestamp = header.Time
+				times[height] = timestamp
+				heights = append(heights, height)
+			}
+
+			c.TrackContractLog(log)
+
+			byHeight[height] = append(byHeight[height], NewContractEventRecord(c.Config.Network, log, timestamp))
+			events++
+		}
+
+		for _, height := range heights {
+			if c.Postgres != nil {
+				err := c.Postgres.WriteContractEvents(ctx, byHeight[height])
+
+				if err != nil {
+					return fmt.Errorf("failed to write contract events of block=%d to postgres: %s", height, err.Error())
+				}
+			}
+
+			if !c.Config.Writes(S3Sink) {
+				continue
+			}
+
+			encoded, err := EncodePartition(byHeight[height], c.Config.Compression)
+
+			if err != nil {
+				return err
+			}
+
+			tt := time.Unix(int64(times[height]), 0)
+
+			partition := Partition{
+				Chain:   Ethereum,
+				Network: c.Config.Network,
+				Year:    fmt.Sprintf("%04d", tt.Year()),
+				Month:   fmt.Sprintf("%02d", tt.Month()),
+				Block:   height,
+			}
+
+			key := c.Config.Compression.PartitionKey(partition)
+
+			err = c.UploadPartition(c.Glue.ContractEventMeta.Bucket, key, encoded, "")
+
+			if err != nil {
+				return err
+			}
+		}
+
+		l.Infof("scanned blocks=%d-%d logs=%d events=%d next window=%d", start, end, len(logs), events, scanner.Window)
+
+		return nil
+	})
+}
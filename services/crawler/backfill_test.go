@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// limitedFilterer has a log in every block and rejects queries returning more than limit logs like hosted providers do
+type limitedFilterer struct {
+	limit   uint64
+	queries int
+}
+
+func (f *limitedFilterer) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.queries++
+
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+
+	if to-from+1 > f.limit {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	var logs []types.Log
+
+	for b := from; b <= to; b++ {
+		logs = append(logs, types.Log{BlockNumber: b})
+	}
+
+	return logs, nil
+}
+
+func (f *limitedFilterer) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestLogScanner(t *testing.T) {
+	filterer := &limitedFilterer{limit: 150}
+
+	scanner := NewLogScanner(filterer, 1000, func() []common.Address { return nil })
+
+	var scanned []uint64
+
+	err := scanner.Scan(context.Background(), 1, 1000, func(logs []types.Log, from, to uint64) error {
+		for _, log := range logs {
+			scanned = append(scanned, log.BlockNumber)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scanned) != 1000 || scanned[0] != 1 || scanned[999] != 1000 {
+		t.Fatalf("expected every block once, got: %d logs", len(scanned))
+	}
+
+	if scanner.Window > filterer.limit {
+		t.Errorf("expected window under the provider limit=%d, got: %d", filterer.limit, scanner.Window)
+	}
+
+	// sparse windows grow back
+	sparse := &limitedFilterer{limit: 1_000_000}
+	scanner = NewLogScanner(sparse, 10, func() []common.Address { return nil })
+
+	err = scanner.Scan(context.Background(), 1, 1000, func(logs []types.Log, from, to uint64) error { return nil })
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scanner.Window <= 10 {
+		t.Errorf("expected the window to grow, got: %d", scanner.Window)
+	}
+}
+
+func TestIsTooManyResults(t *testing.T) {
+	for _, msg := range []string{"query returned more than 10000 results", "Log response size exceeded.", "exceed maximum block range: 5000"} {
+		if !IsTooManyResults(errors.New(msg)) {
+			t.Errorf("expected too many results for: %s", msg)
+		}
+	}
+
+	for _, msg := range []string{"connection refused", "invalid block range params", "query timeout exceeded", "429 too many requests", "daily request count limit exceeded"} {
+		if IsTooManyResults(errors.New(msg)) {
+			t.Errorf("unexpected too many results for: %s", msg)
+		}
+	}
+}
+
+// codeReader has code at the address from the deployment block on
+type codeReader struct {
+	deployed uint64
+}
+
+func (c codeReader) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c codeReader) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c codeReader) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	if blockNumber.Uint64() >= c.deployed {
+		return []byte{1}, nil
+	}
+	return nil, nil
+}
+
+func (c codeReader) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func TestDeploymentBlock(t *testing.T) {
+	for _, deployed := range []uint64{0, 1, 9_234_567} {
+		block, err := DeploymentBlock(context.Background(), codeReader{deployed}, common.Address{}, 10_000_000)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if block != deployed {
+			t.Errorf("expected: %d, got: %d", deployed, block)
+		}
+	}
+
+	_, err := DeploymentBlock(context.Background(), codeReader{20_000_000}, common.Address{}, 10_000_000)
+
+	if err == nil {
+		t.Error("expected an error for a contract deployed after head")
+	}
+}
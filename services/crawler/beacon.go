@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	SecondsPerSlot = 12
+	// beacon nodes cap the number of ids per validators request
+	BeaconValidatorsBatch = 64
+
+	CasimirPoolABI = `[{"inputs":[],"name":"publicKey","outputs":[{"type":"bytes"}],"stateMutability":"view","type":"function"}]`
+)
+
+var ErrSlotNotFound = errors.New("beacon block not found for slot")
+
+// BeaconClient reads validators from the standard beacon node api
+type BeaconClient struct {
+	BaseUrl string
+	Client  *http.Client
+}
+
+// BeaconValidator is an entry of /eth/v1/beacon/states/{state_id}/validators, amounts are in gwei
+type BeaconValidator struct {
+	Index     string `json:"index"`
+	Balance   string `json:"balance"`
+	Status    string `json:"status"`
+	Validator struct {
+		Pubkey                string `json:"pubkey"`
+		WithdrawalCredentials string `json:"withdrawal_credentials"`
+		EffectiveBalance      string `json:"effective_balance"`
+		Slashed               bool   `json:"slashed"`
+		ActivationEpoch       string `json:"activation_epoch"`
+		ExitEpoch             string `json:"exit_epoch"`
+		WithdrawableEpoch     string `json:"withdrawable_epoch"`
+	} `json:"validator"`
+}
+
+// BeaconWithdrawal is a withdrawal of a block execution payload, the amount is in gwei
+type BeaconWithdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validator_index"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// ValidatorDay is a row of the daily validator table, balances and withdrawals are in gwei
+type ValidatorDay struct {
+	Chain            ChainType   `json:"chain"`
+	Network          NetworkType `json:"network"`
+	Date             string      `json:"date"`
+	Slot             uint64      `json:"slot"`
+	ReceivedAt       uint64      `json:"received_at"`
+	PoolId           uint32      `json:"pool_id"`
+	PoolAddress      string      `json:"pool_address"`
+	PublicKey        string      `json:"public_key"`
+	Index            string      `json:"index"`
+	Status           string      `json:"status"`
+	Balance          string      `json:"balance"`
+	EffectiveBalance string      `json:"effective_balance"`
+	Slashed          bool        `json:"slashed"`
+	ActivationEpoch  string      `json:"activation_epoch"`
+	ExitEpoch        string      `json:"exit_epoch"`
+	// sum of the day's withdrawals, empty when withdrawals weren't scanned
+	Withdrawals     string `json:"withdrawals"`
+	WithdrawalCount int    `json:"withdrawal_count"`
+}
+
+func NewBeaconClient(baseUrl string) (*BeaconClient, error) {
+	if baseUrl == "" {
+		return nil, fmt.Errorf("missing beacon api url, set %s", BEACON_API_URL)
+	}
+
+	client, err := NewHttpClientWithTimeout(30 * time.Second)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BeaconClient{
+		BaseUrl: strings.TrimSuffix(baseUrl, "/"),
+		Client:  client,
+	}, nil
+}
+
+// GenesisTime returns the unix time of slot 0
+func (b *BeaconClient) GenesisTime(ctx context.Context) (uint64, error) {
+	var resp struct {
+		Data struct {
+			GenesisTime string `json:"genesis_time"`
+		} `json:"data"`
+	}
+
+	err := b.get(ctx, "/eth/v1/beacon/genesis", &resp)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(resp.Data.GenesisTime, 10, 64)
+}
+
+// Validators returns the validators with the given public keys at a state (e.g. head or a slot)
+func (b *BeaconClient) Validators(ctx context.Context, state string, pubkeys []string) ([]BeaconValidator, error) {
+	var validators []BeaconValidator
+
+	for start := 0; start < len(pubkeys); start += BeaconValidatorsBatch {
+		end := start + BeaconValidatorsBatch
+
+		if end > len(pubkeys) {
+			end = len(pubkeys)
+		}
+
+		var resp struct {
+			Data []BeaconValidator `json:"data"`
+		}
+
+		err := b.get(ctx, fmt.Sprintf("/eth/v1/beacon/states/%s/validators?id=%s", state, strings.Join(pubkeys[start:end], ",")), &resp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		validators = append(validators, resp.Data...)
+	}
+
+	return validators, nil
+}
+
+// Withdrawals returns the withdrawals of the block at a slot, ErrSlotNotFound for missed slots
+func (b *BeaconClient) Withdrawals(ctx context.Context, slot uint64) ([]BeaconWithdrawal, error) {
+	var resp struct {
+		Data struct {
+			Message struct {
+				Body struct {
+					ExecutionPayload struct {
+						Withdrawals []BeaconWithdrawal `json:"withdrawals"`
+					} `json:"execution_payload"`
+				} `json:"body"`
+			} `json:"message"`
+		} `json:"data"`
+	}
+
+	err := b.get(ctx, fmt.Sprintf("/eth/v2/beacon/blocks/%d", slot), &resp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data.Message.Body.ExecutionPayload.Withdrawals, nil
+}
+
+func (b *BeaconClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseUrl+path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.Client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/eth/v2/beacon/blocks/") {
+		return fmt.Errorf("%w: %s", ErrSlotNotFound, path)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code=%d from beacon api path=%s: %s", resp.StatusCode, path, string(res))
+	}
+
+	return json.Unmarshal(res, v)
+}
+
+// SlotAt returns the last slot at or before t
+func SlotAt(genesis uint64, t time.Time) uint64 {
+	if t.Unix() < int64(genesis) {
+		return 0
+	}
+
+	return (uint64(t.Unix()) - genesis) / SecondsPerSlot
+}
+
+// PoolPublicKeys reads the validator public key of each pool contract, pools without a deposited validator are skipped
+func PoolPublicKeys(ctx context.Context, caller bind.ContractCaller, pools []Contract) (map[string]Contract, error) {
+	parsed, err := abi.JSON(strings.NewReader(CasimirPoolABI))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := parsed.Pack("publicKey")
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]Contract)
+
+	for _, pool := range pools {
+		address := pool.Address
+
+		out, err := caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get public key of pool=%d: %s", pool.PoolId, err.Error())
+		}
+
+		values, err := parsed.Unpack("publicKey", out)
+
+		if err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("failed to decode public key of pool=%d", pool.PoolId)
+		}
+
+		key, _ := values[0].([]byte)
+
+		if len(key) == 0 {
+			continue
+		}
+
+		keys[hexutil.Encode(key)] = pool
+	}
+
+	return keys, nil
+}
+
+// SumWithdrawals adds up the withdrawals of each validator index, returning the gwei sum and count per index
+func SumWithdrawals(withdrawals []BeaconWithdrawal, indexes map[string]bool) (map[string]*big.Int, map[string]int, error) {
+	sums := make(map[string]*big.Int)
+	counts := make(map[string]int)
+
+	for _, w := range withdrawals {
+		if !indexes[w.ValidatorIndex] {
+			continue
+		}
+
+		amount, ok := new(big.Int).SetString(w.Amount, 10)
+
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid withdrawal amount=%s validator=%s", w.Amount, w.ValidatorIndex)
+		}
+
+		if _, ok := sums[w.ValidatorIndex]; !ok {
+			sums[w.ValidatorIndex] = new(big.Int)
+		}
+
+		sums[w.ValidatorIndex].Add(sums[w.ValidatorIndex], amount)
+		counts[w.ValidatorIndex]++
+	}
+
+	return sums, counts, nil
+}
+
+// ValidatorDays reads the state of every pool validator at the last slot of the day and, when withdrawals is set,
+// scans every slot of the day for their withdrawals
+func ValidatorDays(ctx context.Context, beacon *BeaconClient, genesis uint64, day time.Time, keys map[string]Contract, withdrawals bool) ([]ValidatorDay, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.Add(24*time.Hour - time.Second)
+
+	firstSlot := SlotAt(genesis, start)
+
+	if uint64(start.Unix()) > genesis && (uint64(start.Unix())-genesis)%SecondsPerSlot != 0 {
+		firstSlot++
+	}
+
+	lastSlot := SlotAt(genesis, end)
+
+	pubkeys := make([]string, 0, len(keys))
+
+	for key := range keys {
+		pubkeys = append(pubkeys, key)
+	}
+
+	validators, err := beacon.Validators(ctx, strconv.FormatUint(lastSlot, 10), pubkeys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]bool)
+
+	for _, v := range validators {
+		indexes[v.Index] = true
+	}
+
+	var sums map[string]*big.Int
+	var counts map[string]int
+
+	if withdrawals {
+		var all []BeaconWithdrawal
+
+		for slot := firstSlot; slot <= lastSlot; slot++ {
+			w, err := beacon.Withdrawals(ctx, slot)
+
+			if errors.Is(err, ErrSlotNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			all = append(all, w...)
+		}
+
+		sums, counts, err = SumWithdrawals(all, indexes)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := make([]ValidatorDay, 0, len(validators))
+
+	for _, v := range validators {
+		pool := keys[strings.ToLower(v.Validator.Pubkey)]
+
+		row := ValidatorDay{
+			Date:             start.Format("2006-01-02"),
+			Slot:             lastSlot,
+			ReceivedAt:       genesis + lastSlot*SecondsPerSlot,
+			PoolId:           pool.PoolId,
+			PoolAddress:      pool.Address.Hex(),
+			PublicKey:        v.Validator.Pubkey,
+			Index:            v.Index,
+			Status:           v.Status,
+			Balance:          v.Balance,
+			EffectiveBalance: v.Validator.EffectiveBalance,
+			Slashed:          v.Validator.Slashed,
+			ActivationEpoch:  v.Validator.ActivationEpoch,
+			ExitEpoch:        v.Validator.ExitEpoch,
+		}
+
+		if withdrawals {
+			row.Withdrawals = "0"
+
+			if sum, ok := sums[v.Index]; ok {
+				row.Withdrawals = sum.String()
+			}
+
+			row.WithdrawalCount = counts[v.Index]
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// SyncValidators writes the daily state of every Casimir pool validator between from and to to the validator table
+func (c *EthereumCrawler) SyncValidators(beacon *BeaconClient, from, to time.Time, withdrawals bool) error {
+	l := c.Logger.Sugar()
+
+	if c.Glue.ValidatorMeta.Bucket == "" {
+		return errors.New("validator table not found")
+	}
+
+	ctx := context.Background()
+
+	// pools discovered from the manager at startup, exited pools are no longer listed by the manager
+	var pools []Contract
+
+	for _, address := range c.Contracts.Addresses() {
+		contract, _ := c.Contracts.Get(address)
+
+		if contract.Kind == PoolContract {
+			pools = append(pools, contract)
+		}
+	}
+
+	keys, err := PoolPublicKeys(ctx, c.Client, pools)
+
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		l.Infof("no pool validators found")
+		return nil
+	}
+
+	genesis, err := beacon.GenesisTime(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to get beacon genesis: %s", err.Error())
+	}
+
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		rows, err := ValidatorDays(ctx, beacon, genesis, day, keys, withdrawals)
+
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			continue
+		}
+
+		for i := range rows {
+			rows[i].Chain = Ethereum
+			rows[i].Network = c.Config.Network
+		}
+
+		encoded, err := EncodePartition(rows, c.Config.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		partition := Partition{
+			Chain:   Ethereum,
+			Network: c.Config.Network,
+			Year:    fmt.Sprintf("%04d", day.Year()),
+			Month:   fmt.Sprintf("%02d", day.Month()),
+			// the day's last slot
+			Block: rows[0].Slot,
+		}
+
+		key := c.Config.Compression.PartitionKey(partition)
+
+		err = c.UploadPartition(c.Glue.ValidatorMeta.Bucket, key, encoded, "")
+
+		if err != nil {
+			return err
+		}
+
+		l.Infof("uploaded %d validators day=%s to partition=%s", len(rows), rows[0].Date, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	mockGenesis   = 1606824023
+	mockPubkey    = "0xa1b2"
+	mockLastSlot  = 6937198
+	mockPaidSlot  = 6930000
+	mockEmptySlot = 6930001
+)
+
+// newMockBeacon serves the beacon api endpoints used by the crawler for a single validator
+func newMockBeacon(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/eth/v1/beacon/genesis":
+			fmt.Fprintf(w, `{"data":{"genesis_time":"%d"}}`, mockGenesis)
+		case r.URL.Path == fmt.Sprintf("/eth/v1/beacon/states/%d/validators", mockLastSlot):
+			if r.URL.Query().Get("id") != mockPubkey {
+				t.Errorf("unexpected validator ids: %s", r.URL.Query().Get("id"))
+			}
+			fmt.Fprintf(w, `{"data":[{"index":"42","balance":"32012345678","status":"active_ongoing","validator":{"pubkey":"%s","effective_balance":"32000000000","slashed":false,"activation_epoch":"100","exit_epoch":"18446744073709551615"}}]}`, mockPubkey)
+		case strings.HasPrefix(r.URL.Path, "/eth/v2/beacon/blocks/"):
+			slot := strings.TrimPrefix(r.URL.Path, "/eth/v2/beacon/blocks/")
+
+			switch slot {
+			case fmt.Sprint(mockEmptySlot):
+				http.NotFound(w, r)
+			case fmt.Sprint(mockPaidSlot):
+				fmt.Fprint(w, `{"data":{"message":{"body":{"execution_payload":{"withdrawals":[{"validator_index":"42","amount":"12345678"},{"validator_index":"7","amount":"1"}]}}}}}`)
+			default:
+				fmt.Fprint(w, `{"data":{"message":{"body":{"execution_payload":{"withdrawals":[]}}}}}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestValidatorDays(t *testing.T) {
+	server := newMockBeacon(t)
+	defer server.Close()
+
+	beacon, err := NewBeaconClient(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := beacon.GenesisTime(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if genesis != mockGenesis {
+		t.Fatalf("expected: %d, got: %d", mockGenesis, genesis)
+	}
+
+	pool := Contract{Kind: PoolContract, Address: common.HexToAddress("0x5000000000000000000000000000000000000005"), PoolId: 3}
+
+	day := time.Date(2023, 7, 22, 15, 0, 0, 0, time.UTC)
+
+	rows, err := ValidatorDays(context.Background(), beacon, genesis, day, map[string]Contract{mockPubkey: pool}, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 {
+		t.Fatalf("expected: %d, got: %d", 1, len(rows))
+	}
+
+	row := rows[0]
+
+	if row.Date != "2023-07-22" || row.Slot != mockLastSlot || row.PoolId != 3 || row.Index != "42" || row.Balance != "32012345678" {
+		t.Errorf("unexpected validator row: %+v", row)
+	}
+
+	if row.Withdrawals != "12345678" || row.WithdrawalCount != 1 {
+		t.Errorf("expected: %s (%d), got: %s (%d)", "12345678", 1, row.Withdrawals, row.WithdrawalCount)
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
+	"net/http"
 	"os"
-	"os/user"
-	"strconv"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -19,10 +20,21 @@ func main() {
 }
 
 func Start(args []string) error {
-	app := &cli.App{
+	err := NewApp().Run(args)
+
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// NewApp returns the crawler cli with its flags and commands
+func NewApp() *cli.App {
+	return &cli.App{
 		Name:    "crawler",
 		Usage:   "Crawl and stream blockchain events",
-		Version: "0.0.1",
+		Version: CrawlerVersion,
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name:    "development",
@@ -36,113 +48,879 @@ func Start(args []string) error {
 				Usage:   "Set the environment to production (uses prod resource in AWS)",
 				Value:   false,
 			},
+			&cli.BoolFlag{
+				Name:  "confirm-prod",
+				Usage: "Confirm writing to production resources (only allowed for mainnet from a remote rpc)",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "namespace",
+				Usage: "Write development data under user=<namespace>/ (fork runs default to the current user)",
+			},
 			&cli.BoolFlag{
 				Name:    "fork",
 				Aliases: []string{"f"},
 				Usage:   "Crawl and stream from a forked network",
 				Value:   false,
 			},
+			&cli.StringSliceFlag{
+				Name:  "enrich",
+				Usage: "Enrichment tiers to fetch (block, transaction, receipt, balance, trace, token, rewards, contract)",
+				Value: cli.NewStringSlice("block", "transaction", "receipt", "balance", "token", "contract"),
+			},
+			&cli.StringSliceFlag{
+				Name:  "token-allow",
+				Usage: "Only index erc-20 transfers of these token addresses",
+			},
+			&cli.StringSliceFlag{
+				Name:  "token-deny",
+				Usage: "Never index erc-20 transfers of these token addresses",
+			},
+			&cli.StringSliceFlag{
+				Name:  "abi",
+				Usage: "Decode logs with an abi file or contract artifact name, optionally bound to addresses joined by + (e.g. CasimirRegistry@0x...+0x..., ./vault.json)",
+			},
+			&cli.StringFlag{
+				Name:  "prices-dir",
+				Usage: "Directory of the local price cache, relative to the crawler module (created on the first fetched price)",
+				Value: DefaultPriceDir,
+			},
+			&cli.BoolFlag{
+				Name:  "prices-offline",
+				Usage: "Only use the local price cache for enrichment (no outbound price requests)",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "fees-in-eth",
+				Usage: "Write gas fees as exact ether decimals instead of wei integers",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "compression",
+				Usage: "Compress uploaded event and action partitions (none, gzip, zstd)",
+				Value: string(NoCompression),
+			},
+			&cli.Uint64Flag{
+				Name:  "upload-part-size",
+				Usage: "MiB per part of multipart uploads (at least 5)",
+				Value: DefaultUploadPartSize / 1024 / 1024,
+			},
+			&cli.IntFlag{
+				Name:  "upload-concurrency",
+				Usage: "Parts of a multipart upload sent at once",
+				Value: DefaultUploadConcurrency,
+			},
+			&cli.StringFlag{
+				Name:  "checkpoint-dir",
+				Usage: "Directory of the local store of crawled heights",
+				Value: DefaultCheckpointDir,
+			},
+			&cli.StringSliceFlag{
+				Name:  "sink",
+				Usage: "Sinks crawled blocks are written to in parallel (s3, postgres), postgres reads POSTGRES_URL",
+				Value: cli.NewStringSlice(string(S3Sink)),
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "snapshot",
+				Usage: "Snapshot the CasimirManager state at a block interval",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:     "from",
+						Usage:    "First block to snapshot",
+						Required: true,
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to snapshot (defaults to the current head)",
+					},
+					&cli.Uint64Flag{
+						Name:  "interval",
+						Usage: "Blocks between snapshots",
+						Value: DefaultSnapshotInterval,
+					},
+					&cli.StringFlag{
+						Name:  "manager",
+						Usage: "CasimirManager contract address",
+					},
+				},
+				Action: SnapshotCmd,
+			},
+			{
+				Name:  "rewards",
+				Usage: "Compute per-user stake history and rewards from the CasimirManager logs",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "from",
+						Usage: "First block to read manager logs from",
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to read manager logs from (defaults to the current head)",
+					},
+					&cli.StringFlag{
+						Name:  "manager",
+						Usage: "CasimirManager contract address",
+					},
+				},
+				Action: RewardsCmd,
+			},
+			{
+				Name:  "pools",
+				Usage: "Record pool status transitions from the CasimirManager logs",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "from",
+						Usage: "First block to read manager logs from",
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to read manager logs from (defaults to the current head)",
+					},
+					&cli.StringFlag{
+						Name:  "manager",
+						Usage: "CasimirManager contract address",
+					},
+				},
+				Action: PoolsCmd,
+			},
+			{
+				Name:  "backfill",
+				Usage: "Backfill the manager and discovered contract events with eth_getLogs",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "from",
+						Usage: "First block to scan (defaults to the manager deployment block)",
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to scan (defaults to the current head)",
+					},
+					&cli.Uint64Flag{
+						Name:  "window",
+						Usage: "Initial blocks per eth_getLogs query, adapted to the provider limits",
+						Value: DefaultLogWindow,
+					},
+					&cli.StringFlag{
+						Name:  "manager",
+						Usage: "CasimirManager contract address",
+					},
+				},
+				Action: BackfillCmd,
+			},
+			{
+				Name:  "validators",
+				Usage: "Write the daily beacon chain state of every Casimir pool validator",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "First day (YYYY-MM-DD or RFC3339)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "Last day (defaults to from)",
+					},
+					&cli.StringFlag{
+						Name:  "beacon-url",
+						Usage: "Beacon node api url (defaults to BEACON_API_URL)",
+					},
+					&cli.BoolFlag{
+						Name:  "withdrawals",
+						Usage: "Scan every slot of each day for the validators' withdrawals",
+						Value: false,
+					},
+				},
+				Action: ValidatorsCmd,
+			},
+			{
+				Name:  "verify",
+				Usage: "Check the uploaded partitions of a block range against the chain",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:     "from",
+						Usage:    "First block to verify",
+						Required: true,
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to verify (defaults to the current head)",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Usage: "File to write the json report to (defaults to stdout)",
+					},
+					&cli.StringFlag{
+						Name:  "retry-queue",
+						Usage: "Push the heights that failed verification onto this retry queue file",
+					},
+				},
+				Action: VerifyCmd,
+			},
+			{
+				Name:  "retry",
+				Usage: "Crawl the heights of a retry queue file again",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "queue",
+						Usage:    "Retry queue file written by verify",
+						Required: true,
+					},
+				},
+				Action: RetryCmd,
+			},
+			{
+				Name:  "gaps",
+				Usage: "Find the block ranges that haven't been uploaded and optionally crawl only those",
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "from",
+						Usage: "First block to check",
+					},
+					&cli.Uint64Flag{
+						Name:  "to",
+						Usage: "Last block to check (defaults to the current head)",
+					},
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "Where to read the uploaded heights from (s3, checkpoint)",
+						Value: string(S3GapSource),
+					},
+					&cli.BoolFlag{
+						Name:  "fill",
+						Usage: "Crawl the missing ranges",
+						Value: false,
+					},
+				},
+				Action: GapsCmd,
+			},
+			{
+				Name:  "stream",
+				Usage: "Stream events, in fork mode the stale contract data of the previous fork is removed first",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "List the stale fork data instead of deleting it",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "confirm-delete",
+						Usage: "Allow deleting stale fork data outside of the dev environment",
+						Value: false,
+					},
+				},
+				Action: StreamCmd,
+			},
+			{
+				Name:  "serve",
+				Usage: "Serve the crawled events, actions and heights over a read-only HTTP API",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "Address to listen on",
+						Value: DefaultAPIAddr,
+					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Usage: "Read partitions from a local directory with events, actions and contract_events subdirectories instead of s3",
+					},
+					&cli.DurationFlag{
+						Name:  "refresh",
+						Usage: "Interval to rebuild the index at, 0 disables refreshing",
+						Value: time.Minute,
+					},
+				},
+				Action: ServeCmd,
+			},
+			{
+				Name:  "compact-index",
+				Usage: "Merge the address index files written at ingest into one file per address prefix",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "min-files",
+						Usage: "Only compact prefixes with at least this many files",
+						Value: DefaultCompactMinFiles,
+					},
+				},
+				Action: CompactIndexCmd,
+			},
+			{
+				Name:  "prices",
+				Usage: "Manage the local price cache",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "sync",
+						Usage: "Prefetch prices for a time range into the local price cache",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "from",
+								Usage:    "Start of the range (YYYY-MM-DD or RFC3339)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "End of the range, inclusive (YYYY-MM-DD covers the whole day, or RFC3339)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "currency",
+								Usage: "Currency to price ether in",
+								Value: USD.String(),
+							},
+						},
+						Action: PricesSyncCmd,
+					},
+				},
+			},
 		},
 		Action: RootCmd,
 	}
+}
 
-	err := app.Run(args)
+func RootCmd(c *cli.Context) error {
+	logger, err := NewConsoleLogger()
 
 	if err != nil {
 		return err
 	}
 
-	return err
+	l := logger.Sugar()
+
+	l.With("cli_args", c.Args().Slice()).Info("cli options")
+
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		l.Errorf("failed to load config: %s", err.Error())
+		return err
+	}
+
+	if config.Fork {
+		fork, err := NewEthereumCrawler(config)
+
+		if err != nil {
+			return err
+		}
+
+		err = fork.Crawl()
+
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = NewEthereumCrawler(config)
+
+	if err != nil {
+		return err
+	}
+
+	// err = live.Crawl()
+
+	// if err != nil {
+	// 	return err
+	// }
+
+	return nil
 }
 
-func RootCmd(c *cli.Context) error {
-	logger, err := NewConsoleLogger()
+func SnapshotCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
 
 	if err != nil {
 		return err
 	}
 
-	l := logger.Sugar()
+	if c.String("manager") != "" {
+		config.ManagerAddress = c.String("manager")
+	}
 
-	l.With("cli_args", c.Args().Slice()).Info("cli options")
+	crawler, err := NewEthereumCrawler(config)
 
-	vars, err := LoadEnv()
+	if err != nil {
+		return err
+	}
+
+	defer crawler.Close()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
+	}
+
+	return crawler.SnapshotManagerRange(c.Uint64("from"), to, c.Uint64("interval"))
+}
+
+func RewardsCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	if c.String("manager") != "" {
+		config.ManagerAddress = c.String("manager")
+	}
+
+	crawler, err := NewEthereumCrawler(config)
 
 	if err != nil {
-		l.Errorf("failed to load env: %s", err.Error())
 		return err
 	}
 
-	url, err := url.Parse(vars[ETHEREUM_RPC_URL])
+	defer crawler.Close()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
+	}
+
+	return crawler.SyncRewards(c.Uint64("from"), to)
+}
+
+func PoolsCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
 
 	if err != nil {
-		l.Errorf("failed to parse ethereum rpc url: %s", err.Error())
 		return err
 	}
 
-	user, err := user.Current()
+	if c.String("manager") != "" {
+		config.ManagerAddress = c.String("manager")
+	}
+
+	crawler, err := NewEthereumCrawler(config)
 
 	if err != nil {
-		l.Errorf("failed to get current user: %s", err.Error())
 		return err
 	}
 
-	config := Config{
-		Env:              Dev,
-		URL:              url,
-		Network:          EthereumGoerli,
-		User:             user.Username,
-		Start:            0,
-		BatchSize:        250_000,
-		ConcurrencyLimit: 10,
+	defer crawler.Close()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
 	}
 
-	if c.Bool("production") {
-		config.Env = Prod
+	return crawler.SyncPools(c.Uint64("from"), to)
+}
+
+func BackfillCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
 	}
 
-	if vars[FORK] != "" {
-		rawForkBlock := vars[ETHEREUM_FORK_BLOCK]
-		forkBlock, err := strconv.ParseUint(rawForkBlock, 10, 64)
+	if c.String("manager") != "" {
+		config.ManagerAddress = c.String("manager")
+	}
 
-		if err != nil {
-			l.Errorf("failed to parse fork block: %s", err.Error())
-			return err
-		}
+	crawler, err := NewEthereumCrawler(config)
 
-		config.Fork = true
-		config.ForkBlock = forkBlock
+	if err != nil {
+		return err
+	}
 
-		fork, err := NewEthereumCrawler(config)
+	defer crawler.Close()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
+	}
+
+	return crawler.BackfillContractEvents(c.Uint64("from"), to, c.Uint64("window"))
+}
+
+func ValidatorsCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	if c.String("beacon-url") != "" {
+		config.BeaconURL = c.String("beacon-url")
+	}
+
+	beacon, err := NewBeaconClient(config.BeaconURL)
+
+	if err != nil {
+		return err
+	}
+
+	from, err := ParseTimeFlag(c.String("from"))
+
+	if err != nil {
+		return err
+	}
+
+	to := from
+
+	if c.String("to") != "" {
+		to, err = ParseEndTimeFlag(c.String("to"))
 
 		if err != nil {
 			return err
 		}
+	}
 
-		err = fork.Crawl()
+	crawler, err := NewEthereumCrawler(config)
+
+	if err != nil {
+		return err
+	}
+
+	defer crawler.Close()
+
+	return crawler.SyncValidators(beacon, from, to, c.Bool("withdrawals"))
+}
+
+func VerifyCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	crawler, err := NewEthereumCrawler(config)
+
+	if err != nil {
+		return err
+	}
+
+	defer crawler.Close()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
+	}
+
+	report, err := crawler.Verify(c.Uint64("from"), to)
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if c.String("report") != "" {
+		err = os.WriteFile(c.String("report"), encoded, 0644)
+	} else {
+		_, err = fmt.Println(string(encoded))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if c.String("retry-queue") != "" && len(report.Retry) > 0 {
+		queue := &RetryQueue{Path: c.String("retry-queue")}
+
+		err = queue.Push(report.RetryEntries()...)
 
 		if err != nil {
 			return err
 		}
+	}
 
-		return nil
+	if len(report.Discrepancies) > 0 {
+		return fmt.Errorf("found %d discrepancies in %d blocks", len(report.Discrepancies), len(report.Retry))
 	}
 
-	_, err = NewEthereumCrawler(config)
+	return nil
+}
+
+func RetryCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
 
 	if err != nil {
 		return err
 	}
 
-	// err = live.Crawl()
+	crawler, err := NewEthereumCrawler(config)
 
-	// if err != nil {
-	// 	return err
-	// }
+	if err != nil {
+		return err
+	}
+
+	defer crawler.Close()
+
+	return crawler.Retry(&RetryQueue{Path: c.String("queue")})
+}
+
+func GapsCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	crawler, err := NewEthereumCrawler(config)
+
+	if err != nil {
+		return err
+	}
+
+	defer crawler.Close()
+
+	l := crawler.Logger.Sugar()
+
+	to := c.Uint64("to")
+
+	if to == 0 {
+		to = crawler.Head
+	}
+
+	gaps, err := crawler.FindGaps(c.Uint64("from"), to, GapSource(c.String("source")))
+
+	if err != nil {
+		return err
+	}
+
+	missing := uint64(0)
+
+	for _, gap := range gaps {
+		missing += gap.Len()
+	}
+
+	encoded, err := json.Marshal(gaps)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(encoded))
+
+	l.Infof("found %d gaps with %d missing blocks between %d and %d", len(gaps), missing, c.Uint64("from"), to)
+
+	if c.Bool("fill") {
+		crawler.CrawlRanges(gaps)
+	}
 
 	return nil
 }
 
+func StreamCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	streamer, err := NewEthereumStreamer(config)
+
+	if err != nil {
+		return err
+	}
+
+	streamer.DryRun = c.Bool("dry-run")
+	streamer.ConfirmDelete = c.Bool("confirm-delete")
+
+	return streamer.Stream()
+}
+
+func ServeCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	logger, err := NewConsoleLogger()
+
+	if err != nil {
+		return err
+	}
+
+	l := logger.Sugar()
+
+	source, tables, err := NewAPISource(config, c.String("dir"))
+
+	if err != nil {
+		l.Errorf("failed to create api source: %s", err.Error())
+		return err
+	}
+
+	server, err := NewAPIServer(logger, source, tables)
+
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	if c.Duration("refresh") > 0 {
+		go server.RefreshEvery(c.Duration("refresh"), done)
+	}
+
+	l.Infof("serving api on addr=%s", c.String("addr"))
+
+	return http.ListenAndServe(c.String("addr"), server.Handler())
+}
+
+func CompactIndexCmd(c *cli.Context) error {
+	config, err := LoadConfig(c)
+
+	if err != nil {
+		return err
+	}
+
+	// the index is compacted under the network of the connected chain
+	_, err = ConnectNetwork(&config)
+
+	if err != nil {
+		return err
+	}
+
+	err = ValidateEnvironment(config)
+
+	if err != nil {
+		return err
+	}
+
+	logger, err := NewConsoleLogger()
+
+	if err != nil {
+		return err
+	}
+
+	glue, s3c, err := NewSinkServices(config)
+
+	if err != nil {
+		return err
+	}
+
+	if glue.AddressIndexMeta.Bucket == "" {
+		return errors.New("address index table not found")
+	}
+
+	index := &AddressIndex{Logger: logger, S3: s3c, Bucket: glue.AddressIndexMeta.Bucket}
+
+	report, err := index.Compact(config.Network, c.Int("min-files"))
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(encoded))
+	return nil
+}
+
+func PricesSyncCmd(c *cli.Context) error {
+	logger, err := NewConsoleLogger()
+
+	if err != nil {
+		return err
+	}
+
+	l := logger.Sugar()
+
+	vars, err := LoadEnv()
+
+	if err != nil {
+		l.Errorf("failed to load env: %s", err.Error())
+		return err
+	}
+
+	from, err := ParseTimeFlag(c.String("from"))
+
+	if err != nil {
+		return err
+	}
+
+	to, err := ParseEndTimeFlag(c.String("to"))
+
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("prices-offline") {
+		return errors.New("can't sync prices in offline mode")
+	}
+
+	priceDir, err := ResolvePriceDir(c.String("prices-dir"))
+
+	if err != nil {
+		return err
+	}
+
+	config := Config{
+		PriceDir:            priceDir,
+		CryptoCompareApiKey: vars[CRYPTOCOMPARE_API_KEY],
+		CoinGeckoApiKey:     vars[COINGECKO_API_KEY],
+	}
+
+	store, err := NewPriceStore(config.PriceDir)
+
+	if err != nil {
+		return err
+	}
+
+	exchange, err := NewPriceExchange(logger, config, nil)
+
+	if err != nil {
+		return err
+	}
+
+	currency := Currency(c.String("currency"))
+
+	l.Infof("syncing %s prices from=%s to=%s into %s", currency, from.Format(time.RFC3339), to.Format(time.RFC3339), config.PriceDir)
+
+	synced, err := SyncPrices(store, exchange, Ethereum, currency, from, to)
+
+	if err != nil {
+		l.Errorf("failed to sync prices after %d minutes: %s", synced, err.Error())
+		return err
+	}
+
+	l.Infof("synced %d minutes of prices", synced)
+	return nil
+}
+
+// ParseTimeFlag parses a date (YYYY-MM-DD) or RFC3339 timestamp in UTC
+func ParseTimeFlag(raw string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC3339", raw)
+	}
+
+	return t.UTC(), nil
+}
+
+// ParseEndTimeFlag parses the inclusive end of a range, a date covers the whole day up to its last second
+func ParseEndTimeFlag(raw string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t.UTC().AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+
+	return ParseTimeFlag(raw)
+}
+
 // if config.Fork {
 // 	crawler, err := NewEthereumCrawler(config)
 
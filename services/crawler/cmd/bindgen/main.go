@@ -0,0 +1,64 @@
+// bindgen regenerates a contract binding from its hardhat build artifact, it's the abigen
+// invocation behind the crawler's go:generate directives
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+type artifact struct {
+	ABI json.RawMessage `json:"abi"`
+}
+
+func main() {
+	artifactPath := flag.String("artifact", "", "Path of the hardhat build artifact")
+	typ := flag.String("type", "Main", "Name of the generated binding type")
+	pkg := flag.String("pkg", "main", "Package of the generated binding")
+	out := flag.String("out", "", "Output file")
+
+	flag.Parse()
+
+	err := generate(*artifactPath, *typ, *pkg, *out)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bindgen: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func generate(artifactPath, typ, pkg, out string) error {
+	if artifactPath == "" || out == "" {
+		return fmt.Errorf("-artifact and -out are required")
+	}
+
+	data, err := os.ReadFile(artifactPath)
+
+	if err != nil {
+		return fmt.Errorf("failed to read artifact (build the contracts first): %s", err.Error())
+	}
+
+	var a artifact
+
+	err = json.Unmarshal(data, &a)
+
+	if err != nil {
+		return fmt.Errorf("failed to parse artifact=%s: %s", artifactPath, err.Error())
+	}
+
+	if len(a.ABI) == 0 {
+		return fmt.Errorf("artifact=%s has no abi", artifactPath)
+	}
+
+	code, err := bind.Bind([]string{typ}, []string{string(a.ABI)}, []string{""}, nil, pkg, bind.LangGo, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(out, []byte(code), 0644)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	CoinbaseSource = "coinbase"
+
+	// smallest candle granularity supported by coinbase (in seconds)
+	CoinbaseCandleGranularity = 60
+	// max candles coinbase returns per request
+	CoinbaseCandleLimit = 300
+)
+
+type CoinbaseExchange struct {
+	BaseUrl string
+}
+
+type CoinbaseTickerResponse struct {
+	Price string    `json:"price"`
+	Time  time.Time `json:"time"`
+}
+
+// CoinbaseCandle is [time, low, high, open, close, volume]
+type CoinbaseCandle [6]float64
+
+func NewCoinbaseExchange() (Exchange, error) {
+	return CoinbaseExchange{
+		BaseUrl: "https://api.exchange.coinbase.com",
+	}, nil
+}
+
+func (c CoinbaseExchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	price := ExchangePrice{
+		Coin:     coin.Short(),
+		Currency: currency.String(),
+		Time:     time.Now(),
+		Source:   CoinbaseSource,
+	}
+
+	product, err := Instrument(coin, currency)
+
+	if err != nil {
+		return price, err
+	}
+
+	url := fmt.Sprintf("%s/products/%s/ticker", c.BaseUrl, product)
+
+	var response CoinbaseTickerResponse
+
+	err = FetchJSON(url, c.header(), &response)
+
+	if err != nil {
+		return price, err
+	}
+
+	value, err := strconv.ParseFloat(response.Price, 64)
+
+	if err != nil {
+		return price, fmt.Errorf("failed to parse coinbase price: %s", err.Error())
+	}
+
+	price.Value = value
+
+	if !response.Time.IsZero() {
+		price.Time = response.Time.UTC()
+	}
+
+	return price, nil
+}
+
+func (c CoinbaseExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	price := ExchangePrice{
+		Coin:     coin.Short(),
+		Currency: currency.String(),
+		Time:     received,
+		Source:   CoinbaseSource,
+	}
+
+	product, err := Instrument(coin, currency)
+
+	if err != nil {
+		return price, err
+	}
+
+	start := received.UTC().Truncate(CoinbaseCandleGranularity * time.Second)
+	end := start.Add(CoinbaseCandleGranularity * time.Second)
+
+	url := fmt.Sprintf("%s/products/%s/candles?granularity=%d&start=%s&end=%s", c.BaseUrl, product, CoinbaseCandleGranularity, start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+	var candles []CoinbaseCandle
+
+	err = FetchJSON(url, c.header(), &candles)
+
+	if err != nil {
+		return price, err
+	}
+
+	unix := received.UTC().Unix()
+
+	for _, candle := range candles {
+		ts := int64(candle[0])
+
+		if ts <= unix && unix-ts < CoinbaseCandleGranularity {
+			price.Value = candle[3]
+			price.Time = time.Unix(ts, 0).UTC()
+			return price, nil
+		}
+	}
+
+	return price, fmt.Errorf("no coinbase candle found for product=%s time=%d", product, unix)
+}
+
+// HistoricalRange returns every minute candle between from and to
+func (c CoinbaseExchange) HistoricalRange(coin ChainType, currency Currency, from, to time.Time) ([]ExchangePrice, time.Duration, error) {
+	product, err := Instrument(coin, currency)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	step := CoinbaseCandleGranularity * time.Second
+
+	var prices []ExchangePrice
+
+	for start := from.UTC().Truncate(step); !start.After(to); start = start.Add(CoinbaseCandleLimit * step) {
+		end := start.Add((CoinbaseCandleLimit - 1) * step)
+
+		if end.After(to) {
+			end = to.UTC()
+		}
+
+		url := fmt.Sprintf("%s/products/%s/candles?granularity=%d&start=%s&end=%s", c.BaseUrl, product, CoinbaseCandleGranularity, start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+		var candles []CoinbaseCandle
+
+		err = FetchJSON(url, c.header(), &candles)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, candle := range candles {
+			prices = append(prices, ExchangePrice{
+				Value:    candle[3],
+				Coin:     coin.Short(),
+				Currency: currency.String(),
+				Time:     time.Unix(int64(candle[0]), 0).UTC(),
+				Source:   CoinbaseSource,
+			})
+		}
+	}
+
+	// coinbase returns candles newest first
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Time.Before(prices[j].Time)
+	})
+
+	return prices, step, nil
+}
+
+func (c CoinbaseExchange) header() http.Header {
+	header := http.Header{}
+	// coinbase rejects requests without a user agent
+	header.Set("User-Agent", "casimir-crawler")
+	return header
+}
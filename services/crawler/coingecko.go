@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	CoinGeckoSource = "coingecko"
+
+	// coingecko returns 5 minute points for ranges shorter than a day
+	CoinGeckoHistoricalWindow = time.Hour
+
+	CoinGeckoPublicUrl = "https://api.coingecko.com/api/v3"
+	// pro api keys are only accepted by the pro host
+	CoinGeckoProUrl = "https://pro-api.coingecko.com/api/v3"
+)
+
+type CoinGeckoExchange struct {
+	BaseUrl string
+	// optional, only required for the pro api
+	ApiKey string
+}
+
+// CoinGeckoMarketChartResponse is the response of /coins/{id}/market_chart/range, each point is [unix ms, price]
+type CoinGeckoMarketChartResponse struct {
+	Prices [][2]float64 `json:"prices"`
+}
+
+func NewCoinGeckoExchange(apiKey string) (Exchange, error) {
+	url := CoinGeckoPublicUrl
+
+	if apiKey != "" {
+		url = CoinGeckoProUrl
+	}
+
+	return CoinGeckoExchange{
+		BaseUrl: url,
+		ApiKey:  apiKey,
+	}, nil
+}
+
+func (c CoinGeckoExchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	price := ExchangePrice{
+		Coin:     coin.Short(),
+		Currency: currency.String(),
+		Time:     time.Now(),
+		Source:   CoinGeckoSource,
+	}
+
+	id, err := coin.CoinGeckoID()
+
+	if err != nil {
+		return price, err
+	}
+
+	if currency == "" {
+		return price, errors.New("currency is required")
+	}
+
+	vs := strings.ToLower(currency.String())
+
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", c.BaseUrl, id, vs)
+
+	var response map[string]map[string]float64
+
+	err = FetchJSON(url, c.header(), &response)
+
+	if err != nil {
+		return price, err
+	}
+
+	value, ok := response[id][vs]
+
+	if !ok {
+		return price, fmt.Errorf("no price returned for coin=%s currency=%s", id, vs)
+	}
+
+	price.Value = value
+	return price, nil
+}
+
+func (c CoinGeckoExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	price := ExchangePrice{
+		Coin:     coin.Short(),
+		Currency: currency.String(),
+		Time:     received,
+		Source:   CoinGeckoSource,
+	}
+
+	id, err := coin.CoinGeckoID()
+
+	if err != nil {
+		return price, err
+	}
+
+	if currency == "" {
+		return price, errors.New("currency is required")
+	}
+
+	to := received.UTC().Unix()
+	from := received.Add(-CoinGeckoHistoricalWindow).UTC().Unix()
+
+	url := fmt.Sprintf("%s/coins/%s/market_chart/range?vs_currency=%s&from=%d&to=%d", c.BaseUrl, id, strings.ToLower(currency.String()), from, to)
+
+	var response CoinGeckoMarketChartResponse
+
+	err = FetchJSON(url, c.header(), &response)
+
+	if err != nil {
+		return price, err
+	}
+
+	found := false
+	latest := int64(0)
+
+	for _, point := range response.Prices {
+		ts := int64(point[0]) / 1000
+
+		if ts > to || ts < latest {
+			continue
+		}
+
+		latest = ts
+		price.Value = point[1]
+		found = true
+	}
+
+	if !found {
+		return price, fmt.Errorf("no price found for coin=%s time=%d", id, to)
+	}
+
+	price.Time = time.Unix(latest, 0).UTC()
+	return price, nil
+}
+
+func (c CoinGeckoExchange) header() http.Header {
+	header := http.Header{}
+
+	if c.ApiKey != "" {
+		header.Set("x-cg-pro-api-key", c.ApiKey)
+	}
+
+	return header
+}
+
+func (c ChainType) CoinGeckoID() (string, error) {
+	switch c {
+	case Ethereum:
+		return "ethereum", nil
+	default:
+		return "", fmt.Errorf("unsupported coin: %s", c)
+	}
+}
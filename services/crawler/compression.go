@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	NoCompression Compression = "none"
+	Gzip          Compression = "gzip"
+	Zstd          Compression = "zstd"
+)
+
+var Compressions = []Compression{NoCompression, Gzip, Zstd}
+
+// ParseCompression parses a compression name, an empty name means no compression
+func ParseCompression(name string) (Compression, error) {
+	if name == "" {
+		return NoCompression, nil
+	}
+
+	for _, c := range Compressions {
+		if string(c) == strings.TrimSpace(name) {
+			return c, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown compression: %s", name)
+}
+
+// Extension returns the suffix appended to the .ndjson of compressed objects, athena picks the codec from it
+func (c Compression) Extension() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// ContentEncoding returns the Content-Encoding of compressed objects
+func (c Compression) ContentEncoding() string {
+	switch c {
+	case Gzip, Zstd:
+		return string(c)
+	default:
+		return ""
+	}
+}
+
+// CompressionOf returns the compression of an object from its key
+func CompressionOf(key string) Compression {
+	for _, c := range Compressions {
+		if c.Extension() != "" && strings.HasSuffix(key, c.Extension()) {
+			return c
+		}
+	}
+
+	return NoCompression
+}
+
+// PartitionKey returns the key of a partition written with the compression (e.g. <partition>.ndjson.gz)
+func (c Compression) PartitionKey(partition Partition) string {
+	return fmt.Sprintf("%s.ndjson%s", partition.String(), c.Extension())
+}
+
+// SiblingKeys returns the keys the partition of key has under the other compressions
+func SiblingKeys(key string) []string {
+	base := strings.TrimSuffix(key, CompressionOf(key).Extension())
+
+	if !strings.HasSuffix(base, ".ndjson") {
+		return nil
+	}
+
+	var siblings []string
+
+	for _, c := range Compressions {
+		if sibling := base + c.Extension(); sibling != key {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	return siblings
+}
+
+// UniquePartitions keeps one key per partition when a partition was written under several compressions,
+// the most compressed key is kept since compression is only switched on after the fact
+func UniquePartitions(keys []string) []string {
+	rank := make(map[Compression]int)
+
+	for i, c := range Compressions {
+		rank[c] = i
+	}
+
+	kept := make(map[string]string)
+
+	var unique []string
+
+	for _, key := range keys {
+		base := strings.TrimSuffix(key, CompressionOf(key).Extension())
+
+		existing, ok := kept[base]
+
+		if !ok {
+			kept[base] = key
+			unique = append(unique, key)
+			continue
+		}
+
+		if rank[CompressionOf(key)] > rank[CompressionOf(existing)] {
+			kept[base] = key
+		}
+	}
+
+	for i, key := range unique {
+		unique[i] = kept[strings.TrimSuffix(key, CompressionOf(key).Extension())]
+	}
+
+	return unique
+}
+
+// NewWriter returns a writer compressing into w, it must be closed to flush the compressed stream
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// NewReader returns a reader decompressing r
+func (c Compression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// EncodePartition encodes rows as ndjson straight into the compressor, so only the compressed partition is held in memory
+func EncodePartition[T Event | Action | DecodedEvent | ManagerSnapshot | UserReward | PoolTransition | ContractEventRecord | ValidatorDay](rows []T, compression Compression) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+
+	err := WriteNDJSON(&buf, rows, compression)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+// WriteNDJSON writes rows as compressed ndjson to w
+func WriteNDJSON[T Event | Action | DecodedEvent | ManagerSnapshot | UserReward | PoolTransition | ContractEventRecord | ValidatorDay](w io.Writer, rows []T, compression Compression) error {
+	compressor, err := compression.NewWriter(w)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(compressor)
+
+	for _, row := range rows {
+		err = encoder.Encode(row)
+
+		if err != nil {
+			compressor.Close()
+			return fmt.Errorf("failed to encode row to JSON: %v", err)
+		}
+	}
+
+	return compressor.Close()
+}
+
+// ReadPartition decodes a partition, decompressing it with the codec of its key
+func ReadPartition[T Event | Action | ContractEventRecord | AddressIndexEntry](key string, r io.Reader) ([]T, error) {
+	decompressor, err := CompressionOf(key).NewReader(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer decompressor.Close()
+
+	return ReadNDJSON[T](decompressor)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEncodePartition(t *testing.T) {
+	events := []Event{
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Block, Height: 42, Block: "0xa"},
+		{Chain: Ethereum, Network: EthereumGoerli, Type: Transaction, Height: 42, Block: "0xa", Transaction: "0xb", Amount: "1000"},
+	}
+
+	raw, err := NDJSON[Event](events)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range Compressions {
+		encoded, err := EncodePartition(events, compression)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if compression == NoCompression && encoded.String() != raw.String() {
+			t.Errorf("expected: %s, got: %s", raw.String(), encoded.String())
+		}
+
+		if compression != NoCompression && encoded.Len() == 0 {
+			t.Errorf("%s: expected compressed bytes", compression)
+		}
+
+		key := "chain=ethereum/network=goerli/year=2023/month=07/block=42.ndjson" + compression.Extension()
+
+		if CompressionOf(key) != compression {
+			t.Errorf("expected: %s, got: %s", compression, CompressionOf(key))
+		}
+
+		if height, ok := PartitionHeight(key); !ok || height != 42 {
+			t.Errorf("expected: %d, got: %d for key=%s", 42, height, key)
+		}
+
+		decoded, err := ReadPartition[Event](key, encoded)
+
+		if err != nil {
+			t.Fatalf("%s: %s", compression, err.Error())
+		}
+
+		if len(decoded) != len(events) || decoded[1].Transaction != "0xb" || decoded[1].Amount != "1000" {
+			t.Errorf("%s: expected: %v, got: %v", compression, events, decoded)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, expected := range map[string]Compression{"": NoCompression, "none": NoCompression, "gzip": Gzip, "zstd": Zstd} {
+		compression, err := ParseCompression(name)
+
+		if err != nil || compression != expected {
+			t.Errorf("expected: %s, got: %s (%v)", expected, compression, err)
+		}
+	}
+
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Errorf("expected an error for an unknown compression")
+	}
+
+	if Gzip.ContentEncoding() != "gzip" || NoCompression.ContentEncoding() != "" {
+		t.Errorf("unexpected content encodings: %s, %s", Gzip.ContentEncoding(), NoCompression.ContentEncoding())
+	}
+}
+
+func TestPartitionKeys(t *testing.T) {
+	partition := Partition{Network: EthereumGoerli, Year: "2023", Month: "06", Block: 42}
+	key := Gzip.PartitionKey(partition)
+
+	if key != "chain=ethereum/network=goerli/year=2023/month=06/block=42.ndjson.gz" {
+		t.Fatalf("unexpected key: %s", key)
+	}
+
+	siblings := SiblingKeys(key)
+
+	if len(siblings) != 2 || siblings[0] != NoCompression.PartitionKey(partition) || siblings[1] != Zstd.PartitionKey(partition) {
+		t.Errorf("unexpected siblings: %v", siblings)
+	}
+
+	if SiblingKeys("address=0x1/blocks=1-2.json") != nil {
+		t.Errorf("expected no siblings for a key that isn't a partition")
+	}
+
+	other := Partition{Network: EthereumGoerli, Year: "2023", Month: "06", Block: 43}
+
+	keys := []string{NoCompression.PartitionKey(partition), NoCompression.PartitionKey(other), Zstd.PartitionKey(partition)}
+	unique := UniquePartitions(keys)
+
+	if len(unique) != 2 || unique[0] != Zstd.PartitionKey(partition) || unique[1] != NoCompression.PartitionKey(other) {
+		t.Errorf("unexpected unique partitions: %v", unique)
+	}
+}
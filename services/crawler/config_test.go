@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"testing"
+	"time"
 )
 
 func TestGetContractBuildArtifact(t *testing.T) {
@@ -30,3 +33,92 @@ func TestGetResourceVersion(t *testing.T) {
 		t.Fatalf("expected: %d, got: %d", 1, rv)
 	}
 }
+
+func TestValidateEnvironment(t *testing.T) {
+	remote, _ := url.Parse("https://nodes.casimir.co/eth/mainnet")
+	local, _ := url.Parse("http://127.0.0.1:8545")
+	named, _ := url.Parse("http://localhost:8545")
+
+	prod := Config{Env: Prod, ConfirmProd: true, URL: remote, Network: EthereumMainnet}
+
+	if err := ValidateEnvironment(prod); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	unconfirmed := prod
+	unconfirmed.ConfirmProd = false
+
+	if err := ValidateEnvironment(unconfirmed); !errors.Is(err, ErrProdNotConfirmed) {
+		t.Errorf("expected: %v, got: %v", ErrProdNotConfirmed, err)
+	}
+
+	goerli := prod
+	goerli.Network = EthereumGoerli
+
+	fork := prod
+	fork.Fork = true
+
+	localRPC := prod
+	localRPC.URL = local
+
+	localhost := prod
+	localhost.URL = named
+
+	namespaced := prod
+	namespaced.Namespace = "jane"
+
+	for name, config := range map[string]Config{
+		"goerli":     goerli,
+		"fork":       fork,
+		"local rpc":  localRPC,
+		"localhost":  localhost,
+		"namespaced": namespaced,
+	} {
+		if err := ValidateEnvironment(config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	dev := Config{Env: Dev, Fork: true, URL: local, Namespace: "jane", Network: EthereumHardhat}
+
+	if err := ValidateEnvironment(dev); err != nil {
+		t.Errorf("expected no error in development, got: %v", err)
+	}
+}
+
+func TestNamespaceOf(t *testing.T) {
+	for user, expected := range map[string]string{
+		"jane":           "jane",
+		"CORP\\Jane Doe": "corp-jane-doe",
+		"ci_runner.01":   "ci_runner-01",
+		"--":             "",
+	} {
+		if NamespaceOf(user) != expected {
+			t.Errorf("expected: %s, got: %s", expected, NamespaceOf(user))
+		}
+	}
+}
+
+func TestParseEndTimeFlag(t *testing.T) {
+	from, err := ParseTimeFlag("2023-01-01")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := ParseEndTimeFlag("2023-01-01")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if to.Sub(from) != 24*time.Hour-time.Second {
+		t.Errorf("expected a date to cover the whole day, got: %s to %s", from, to)
+	}
+
+	exact, err := ParseEndTimeFlag("2023-01-01T10:30:00Z")
+
+	if err != nil || !exact.Equal(time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected a timestamp to be kept, got: %s (%v)", exact, err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Event abis of the contracts discovered from the manager, transcribed from contracts/ethereum/src/v1/interfaces and
+// the OwnableUpgradeable, Initializable and FunctionsClient contracts they inherit. Enums are encoded as uint8.
+const (
+	RegistryEventsABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"CollateralDeposited","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"}],"name":"DeactivationCompleted","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"}],"name":"DeactivationRequested","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"}],"name":"DeregistrationCompleted","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"},{"indexed":false,"name":"poolId","type":"uint32"}],"name":"OperatorPoolAdded","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"operatorId","type":"uint64"},{"indexed":false,"name":"poolId","type":"uint32"},{"indexed":false,"name":"blameAmount","type":"uint256"}],"name":"OperatorPoolRemoved","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"}],"name":"OperatorRegistered","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"operatorId","type":"uint64"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"WithdrawalFulfilled","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"version","type":"uint8"}],"name":"Initialized","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"previousOwner","type":"address"},{"indexed":true,"name":"newOwner","type":"address"}],"name":"OwnershipTransferred","type":"event"}]`
+	UpkeepEventsABI   = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"count","type":"uint256"}],"name":"ActivationsRequested","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"count","type":"uint256"}],"name":"CompletedExitReportsRequested","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"count","type":"uint256"}],"name":"ForcedExitReportsRequested","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"newFunctionsOracleAddress","type":"address"}],"name":"FunctionsOracleAddressSet","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"newRequestSource","type":"string"},{"indexed":false,"name":"newRequestArgs","type":"string[]"},{"indexed":false,"name":"newFulfillGasLimit","type":"uint32"}],"name":"FunctionsRequestSet","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"requestId","type":"bytes32"},{"indexed":false,"name":"result","type":"bytes"},{"indexed":false,"name":"err","type":"bytes"}],"name":"OCRResponse","type":"event"},{"anonymous":false,"inputs":[],"name":"NewReportRequested","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"requestId","type":"bytes32"},{"indexed":false,"name":"requestArgs","type":"string[]"}],"name":"ReportRequestSent","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"status","type":"uint8"}],"name":"UpkeepPerformed","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"}],"name":"RequestSent","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"id","type":"bytes32"}],"name":"RequestFulfilled","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"version","type":"uint8"}],"name":"Initialized","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"previousOwner","type":"address"},{"indexed":true,"name":"newOwner","type":"address"}],"name":"OwnershipTransferred","type":"event"}]`
+	PoolEventsABI     = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"operatorIds","type":"uint64[]"}],"name":"OperatorIdsSet","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"reshares","type":"uint256"}],"name":"ResharesSet","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"status","type":"uint8"}],"name":"StatusSet","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"version","type":"uint8"}],"name":"Initialized","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"previousOwner","type":"address"},{"indexed":true,"name":"newOwner","type":"address"}],"name":"OwnershipTransferred","type":"event"}]`
+)
+
+// ContractABIs returns the abi each contract kind's logs are decoded with
+func ContractABIs(managerABI *abi.ABI) (map[ContractKind]*abi.ABI, error) {
+	abis := map[ContractKind]*abi.ABI{
+		ManagerContract: managerABI,
+	}
+
+	for kind, raw := range map[ContractKind]string{
+		RegistryContract: RegistryEventsABI,
+		UpkeepContract:   UpkeepEventsABI,
+		PoolContract:     PoolEventsABI,
+	} {
+		parsed, err := abi.JSON(strings.NewReader(raw))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s abi: %s", kind, err.Error())
+		}
+
+		abis[kind] = &parsed
+	}
+
+	return abis, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type ContractKind string
+
+const (
+	ManagerContract  ContractKind = "manager"
+	RegistryContract ContractKind = "registry"
+	UpkeepContract   ContractKind = "upkeep"
+	PoolContract     ContractKind = "pool"
+)
+
+// ManagerAddresses are the CasimirManager deployments per network, overridden by ETHEREUM_MANAGER_ADDRESS or --manager.
+// The manager isn't deployed on mainnet yet.
+var ManagerAddresses = map[NetworkType]string{
+	EthereumGoerli: "0x5d35a44Db8a390aCfa997C9a9Ba3a2F878595630",
+	// the local hardhat node forks goerli, so it serves the goerli deployment (see common/env HARDHAT_NETWORK_KEY)
+	EthereumHardhat: "0x5d35a44Db8a390aCfa997C9a9Ba3a2F878595630",
+}
+
+var ErrNoManagerAddress = errors.New("no CasimirManager address configured")
+
+// Contract is a Casimir contract whose logs get decoded
+type Contract struct {
+	Kind    ContractKind
+	Address common.Address
+	// set on pool contracts
+	PoolId uint32
+	// latest owner seen in an OwnershipTransferred log or read from the contract
+	Owner common.Address
+}
+
+// ContractSet is the set of contracts discovered from the manager, it grows while crawling
+type ContractSet struct {
+	mu        sync.RWMutex
+	contracts map[common.Address]Contract
+}
+
+func NewContractSet(contracts ...Contract) *ContractSet {
+	set := &ContractSet{contracts: make(map[common.Address]Contract)}
+
+	for _, c := range contracts {
+		set.Add(c)
+	}
+
+	return set
+}
+
+// Add adds a contract to the set and returns true if it wasn't already in it
+func (s *ContractSet) Add(contract Contract) bool {
+	if contract.Address == (common.Address{}) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.contracts[contract.Address]; ok {
+		return false
+	}
+
+	s.contracts[contract.Address] = contract
+	return true
+}
+
+func (s *ContractSet) Get(address common.Address) (Contract, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contract, ok := s.contracts[address]
+	return contract, ok
+}
+
+// SetOwner records the owner of a contract in the set
+func (s *ContractSet) SetOwner(address, owner common.Address) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if contract, ok := s.contracts[address]; ok {
+		contract.Owner = owner
+		s.contracts[address] = contract
+	}
+}
+
+// Addresses returns the addresses in the set sorted so filters are stable
+func (s *ContractSet) Addresses() []common.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := make([]common.Address, 0, len(s.contracts))
+
+	for address := range s.contracts {
+		addresses = append(addresses, address)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Hex() < addresses[j].Hex()
+	})
+
+	return addresses
+}
+
+// DiscoverContracts reads the registry, upkeep and pool addresses from the manager at the block (nil for latest)
+func DiscoverContracts(manager *MainCaller, block *big.Int) ([]Contract, error) {
+	opt := &bind.CallOpts{BlockNumber: block, Context: context.Background()}
+
+	var contracts []Contract
+
+	registry, err := manager.GetRegistryAddress(opt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to call GetRegistryAddress: %s", err.Error())
+	}
+
+	contracts = append(contracts, Contract{Kind: RegistryContract, Address: registry})
+
+	upkeep, err := manager.GetUpkeepAddress(opt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to call GetUpkeepAddress: %s", err.Error())
+	}
+
+	contracts = append(contracts, Contract{Kind: UpkeepContract, Address: upkeep})
+
+	for _, list := range []struct {
+		name string
+		call func(*bind.CallOpts) ([]uint32, error)
+	}{
+		{"GetPendingPoolIds", manager.GetPendingPoolIds},
+		{"GetReadyPoolIds", manager.GetReadyPoolIds},
+		{"GetStakedPoolIds", manager.GetStakedPoolIds},
+	} {
+		ids, err := list.call(opt)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to call %s: %s", list.name, err.Error())
+		}
+
+		for _, id := range ids {
+			pool, err := manager.GetPoolAddress(opt, id)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to call GetPoolAddress pool=%d: %s", id, err.Error())
+			}
+
+			contracts = append(contracts, Contract{Kind: PoolContract, Address: pool, PoolId: id})
+		}
+	}
+
+	return contracts, nil
+}
+
+// NewManagerContractSet returns a set of the manager and the contracts discovered from it at the latest block,
+// the set always holds the manager even when discovery fails
+func NewManagerContractSet(address common.Address, caller bind.ContractCaller) (*ContractSet, error) {
+	set := NewContractSet(Contract{Kind: ManagerContract, Address: address})
+
+	manager, err := NewMainCaller(address, caller)
+
+	if err != nil {
+		return set, err
+	}
+
+	owner, err := manager.Owner(&bind.CallOpts{Context: context.Background()})
+
+	if err != nil {
+		return set, fmt.Errorf("failed to call Owner: %s", err.Error())
+	}
+
+	set.SetOwner(address, owner)
+
+	discovered, err := DiscoverContracts(manager, nil)
+
+	if err != nil {
+		return set, err
+	}
+
+	for _, contract := range discovered {
+		set.Add(contract)
+	}
+
+	return set, nil
+}
+
+// ManagerAddressFor returns the configured manager address or the default deployment of the network
+func ManagerAddressFor(configured string, network NetworkType) (string, error) {
+	if configured != "" {
+		if !common.IsHexAddress(configured) {
+			return "", fmt.Errorf("invalid manager address: %s", configured)
+		}
+		return configured, nil
+	}
+
+	address, ok := ManagerAddresses[network]
+
+	if !ok {
+		return "", fmt.Errorf("%w for network=%s, set %s or --manager", ErrNoManagerAddress, network, ETHEREUM_MANAGER_ADDRESS)
+	}
+
+	return address, nil
+}
+
+// ContractLog is a log of a contract in the set decoded with the manager abi
+type ContractLog struct {
+	Contract Contract
+	Event    string
+	Args     map[string]interface{}
+	Log      *types.Log
+}
+
+// DecodeContractLogs decodes the logs emitted by contracts in the set with the abi of their kind, logs of
+// unknown events are skipped
+func DecodeContractLogs(set *ContractSet, abis map[ContractKind]*abi.ABI, logs []*types.Log) []ContractLog {
+	var decoded []ContractLog
+
+	for _, log := range logs {
+		contract, ok := set.Get(log.Address)
+
+		if !ok || len(log.Topics) == 0 {
+			continue
+		}
+
+		contractABI, ok := abis[contract.Kind]
+
+		if !ok {
+			continue
+		}
+
+		event, err := contractABI.EventByID(log.Topics[0])
+
+		if err != nil {
+			continue
+		}
+
+		args := make(map[string]interface{})
+
+		err = event.Inputs.UnpackIntoMap(args, log.Data)
+
+		if err != nil {
+			continue
+		}
+
+		var indexed abi.Arguments
+
+		for _, input := range event.Inputs {
+			if input.Indexed {
+				indexed = append(indexed, input)
+			}
+		}
+
+		err = abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:])
+
+		if err != nil {
+			continue
+		}
+
+		decoded = append(decoded, ContractLog{
+			Contract: contract,
+			Event:    event.Name,
+			Args:     args,
+			Log:      log,
+		})
+	}
+
+	return decoded
+}
+
+// SnakeCase converts an event name to its action name (e.g. StakeDeposited to stake_deposited)
+func SnakeCase(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// GetContractActions turns the contract logs of a receipt into actions and grows the contract set
+// with the pools and owners they reveal
+func (c *EthereumCrawler) GetContractActions(receipt *Receipt, receivedAt uint64, price string) []Action {
+	var actions []Action
+
+	for _, log := range DecodeContractLogs(c.Contracts, c.ContractABIs, receipt.Logs) {
+		logIndex := log.Log.Index
+
+		action := Action{
+			Chain:      Ethereum,
+			Network:    c.Config.Network,
+			Type:       ContractEvent,
+			Action:     SpecificActionType(SnakeCase(log.Event)),
+			Address:    log.Contract.Address.Hex(),
+			Hash:       log.Log.TxHash.Hex(),
+			Price:      price,
+			ReceivedAt: receivedAt,
+			LogIndex:   &logIndex,
+		}
+
+		if sender, ok := log.Args["sender"].(common.Address); ok {
+			action.Address = sender.Hex()
+		}
+
+		if amount, ok := log.Args["amount"].(*big.Int); ok {
+			action.Amount = amount.String()
+		}
+
+		actions = append(actions, action)
+
+		c.TrackContractLog(log)
+	}
+
+	return actions
+}
+
+// TrackContractLog grows the contract set with the pools and owners revealed by a decoded log
+func (c *EthereumCrawler) TrackContractLog(log ContractLog) {
+	l := c.Logger.Sugar()
+
+	switch log.Event {
+	case "OwnershipTransferred":
+		if owner, ok := log.Args["newOwner"].(common.Address); ok {
+			c.Contracts.SetOwner(log.Contract.Address, owner)
+			l.Infof("contract=%s kind=%s owner=%s", log.Contract.Address.Hex(), log.Contract.Kind, owner.Hex())
+		}
+	case PoolInitiatedEvent:
+		poolId, ok := log.Args["poolId"].(uint32)
+
+		if !ok || log.Contract.Kind != ManagerContract {
+			return
+		}
+
+		manager, err := NewMainCaller(log.Contract.Address, c.Client)
+
+		if err != nil {
+			return
+		}
+
+		pool, err := manager.GetPoolAddress(&bind.CallOpts{BlockNumber: new(big.Int).SetUint64(log.Log.BlockNumber), Context: context.Background()}, poolId)
+
+		if err != nil {
+			l.Warnf("failed to get pool address pool=%d: %s", poolId, err.Error())
+			return
+		}
+
+		if c.Contracts.Add(Contract{Kind: PoolContract, Address: pool, PoolId: poolId}) {
+			l.Infof("discovered pool=%d contract=%s", poolId, pool.Hex())
+		}
+	}
+}
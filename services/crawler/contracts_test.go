@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestDecodeContractLogs(t *testing.T) {
+	managerABI, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abis, err := ContractABIs(managerABI)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := common.HexToAddress(ManagerAddresses[EthereumGoerli])
+	registry := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	sender := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	set := NewContractSet(Contract{Kind: ManagerContract, Address: manager}, Contract{Kind: RegistryContract, Address: registry})
+
+	amount, err := managerABI.Events["StakeDeposited"].Inputs.NonIndexed().Pack(big.NewInt(32))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	set.Add(Contract{Kind: PoolContract, Address: pool, PoolId: 1})
+
+	status, err := abis[PoolContract].Events["StatusSet"].Inputs.Pack(uint8(2))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := []*types.Log{
+		{Address: manager, Topics: []common.Hash{managerABI.Events["StakeDeposited"].ID, common.BytesToHash(sender.Bytes())}, Data: amount},
+		{Address: registry, Topics: []common.Hash{managerABI.Events["OwnershipTransferred"].ID, common.Hash{}, common.BytesToHash(sender.Bytes())}},
+		// same event from a contract outside the set
+		{Address: sender, Topics: []common.Hash{managerABI.Events["StakeDeposited"].ID, common.BytesToHash(sender.Bytes())}, Data: amount},
+		// registry and pool events aren't in the manager abi
+		{Address: registry, Topics: []common.Hash{abis[RegistryContract].Events["OperatorRegistered"].ID, common.BigToHash(big.NewInt(7))}},
+		{Address: pool, Topics: []common.Hash{abis[PoolContract].Events["StatusSet"].ID}, Data: status},
+		// a manager event emitted by the registry isn't decoded with the manager abi
+		{Address: registry, Topics: []common.Hash{managerABI.Events["StakeDeposited"].ID, common.BytesToHash(sender.Bytes())}, Data: amount},
+	}
+
+	decoded := DecodeContractLogs(set, abis, logs)
+
+	if len(decoded) != 4 {
+		t.Fatalf("expected: %d, got: %d", 4, len(decoded))
+	}
+
+	if decoded[2].Event != "OperatorRegistered" || decoded[2].Args["operatorId"] != uint64(7) {
+		t.Errorf("unexpected registry log: %+v", decoded[2])
+	}
+
+	if decoded[3].Event != "StatusSet" || decoded[3].Contract.Kind != PoolContract || decoded[3].Args["status"] != uint8(2) {
+		t.Errorf("unexpected pool log: %+v", decoded[3])
+	}
+
+	if decoded[0].Event != "StakeDeposited" || decoded[0].Args["sender"] != sender || decoded[0].Args["amount"].(*big.Int).Int64() != 32 {
+		t.Errorf("unexpected deposit: %+v", decoded[0])
+	}
+
+	if decoded[1].Contract.Kind != RegistryContract || decoded[1].Args["newOwner"] != sender {
+		t.Errorf("unexpected ownership transfer: %+v", decoded[1])
+	}
+
+	if SnakeCase(decoded[0].Event) != string(StakeDeposited) {
+		t.Errorf("expected: %s, got: %s", StakeDeposited, SnakeCase(decoded[0].Event))
+	}
+}
+
+func TestManagerAddressFor(t *testing.T) {
+	address, err := ManagerAddressFor("", EthereumGoerli)
+
+	if err != nil || address != ManagerAddresses[EthereumGoerli] {
+		t.Errorf("expected: %s, got: %s (%v)", ManagerAddresses[EthereumGoerli], address, err)
+	}
+
+	_, err = ManagerAddressFor("", EthereumMainnet)
+
+	if !errors.Is(err, ErrNoManagerAddress) {
+		t.Errorf("expected: %v, got: %v", ErrNoManagerAddress, err)
+	}
+
+	if _, err := ManagerAddressFor("", EthereumHardhat); err != nil {
+		t.Errorf("expected the hardhat fork to resolve, got: %v", err)
+	}
+
+	crawler := &EthereumCrawler{Config: &Config{Network: EthereumMainnet}}
+
+	if _, err := crawler.Manager(); !errors.Is(err, ErrNoManagerAddress) {
+		t.Errorf("expected the manager commands to fail without an address, got: %v", err)
+	}
+
+	_, err = ManagerAddressFor("0x123", EthereumGoerli)
+
+	if err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
@@ -7,15 +7,22 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 const (
 	AWSAthenaTimeFormat = "2006-01-02 15:04:05.999999999"
+	CrawlerVersion      = "0.0.1"
+	// bumped when a change to the uploaded rows needs the partitions rewritten
+	SchemaVersion = "1"
 )
 
 type EthereumCrawler struct {
@@ -24,6 +31,8 @@ type EthereumCrawler struct {
 	*Config
 	Glue       *GlueService
 	S3         *S3Service
+	Prices     Exchange
+	PriceStore *PriceStore
 	Wg         *sync.WaitGroup
 	Sema       chan struct{}
 	Head       uint64
@@ -32,6 +41,24 @@ type EthereumCrawler struct {
 	Start      time.Time
 	Elapsed    time.Duration
 	StartBlock uint64
+	// set once the node reports that debug tracing is unavailable
+	TracingDisabled atomic.Bool
+	Tokens          *TokenRegistry
+	TokenFilter     TokenFilter
+	// set by SyncRewards when the rewards tier is enabled
+	Rewards *RewardsIndex
+	// the manager and the contracts discovered from it, their logs are decoded into contract actions
+	Contracts *ContractSet
+	// abi of each contract kind
+	ContractABIs map[ContractKind]*abi.ABI
+	// set when abis are configured
+	Decoder *EventDecoder
+	// heights uploaded by ProcessBlock, used to find gaps without listing s3
+	Checkpoints *CheckpointStore
+	// set when the address index table exists
+	AddressIndex *AddressIndex
+	// set when the postgres sink is enabled
+	Postgres *PostgresStore
 }
 
 func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
@@ -43,7 +70,7 @@ func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
 
 	l := logger.Sugar()
 
-	eths, err := NewEthereumService(config.URL.String())
+	eths, err := ConnectNetwork(&config)
 
 	if err != nil {
 		l.Infof("failed to create ethereum service: %s", err.Error())
@@ -59,6 +86,93 @@ func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
 
 	config.End = head
 
+	err = ValidateEnvironment(config)
+
+	if err != nil {
+		l.Infof("refusing to crawl: %s", err.Error())
+		return nil, err
+	}
+
+	managerAddress, err := ManagerAddressFor(config.ManagerAddress, eths.Network)
+
+	if errors.Is(err, ErrNoManagerAddress) {
+		// only the manager commands need it, crawling goes on without decoding casimir contracts
+		l.Warnf("%s, casimir contracts won't be decoded", err.Error())
+	} else if err != nil {
+		l.Infof("failed to resolve manager address: %s", err.Error())
+		return nil, err
+	}
+
+	config.ManagerAddress = managerAddress
+
+	err = CheckManagerBinding()
+
+	if err != nil && !errors.Is(err, ErrArtifactNotFound) {
+		l.Infof("failed to check manager binding: %s", err.Error())
+		return nil, err
+	}
+
+	managerABI, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		return nil, err
+	}
+
+	contractABIs, err := ContractABIs(managerABI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	contracts := NewContractSet()
+
+	if managerAddress != "" {
+		contracts, err = NewManagerContractSet(common.HexToAddress(managerAddress), eths.Client)
+
+		if err != nil {
+			// the manager may not be deployed at the head of a fork yet, its logs are still decoded
+			l.Warnf("failed to discover manager contracts: %s", err.Error())
+		}
+	}
+
+	prices, priceStore, err := NewEnrichmentExchange(logger, config, eths)
+
+	if err != nil {
+		l.Infof("failed to create price exchange: %s", err.Error())
+		return nil, err
+	}
+
+	tokens, err := NewTokenRegistry(eths.Client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokenFilter, err := NewTokenFilter(config.TokenAllowlist, config.TokenDenylist)
+
+	if err != nil {
+		l.Infof("failed to parse token filter: %s", err.Error())
+		return nil, err
+	}
+
+	var decoder *EventDecoder
+
+	if len(config.ABIs) > 0 {
+		decoder, err = LoadEventDecoder(config.ABIs)
+
+		if err != nil {
+			l.Infof("failed to load abis: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	checkpoints, err := NewCheckpointStore(config.CheckpointDir)
+
+	if err != nil {
+		l.Infof("failed to create checkpoint store: %s", err.Error())
+		return nil, err
+	}
+
 	awsConfig, err := LoadDefaultAWSConfig()
 
 	if err != nil {
@@ -80,6 +194,15 @@ func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
 		return nil, err
 	}
 
+	if config.Compression != NoCompression {
+		// athena still decompresses by file extension, the flag only documents the table contents
+		for _, table := range glue.PartitionTables() {
+			if !table.Compressed {
+				l.Warnf("uploading %s partitions to table=%s not marked as compressed", config.Compression, table.Name)
+			}
+		}
+	}
+
 	s3c, err := NewS3Service(awsConfig)
 
 	if err != nil {
@@ -87,6 +210,51 @@ func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
 		return nil, err
 	}
 
+	s3c.Env = config.Env
+	s3c.Namespace = config.Namespace
+
+	if config.UploadPartSize != 0 || config.UploadConcurrency != 0 {
+		partSize, concurrency := config.UploadPartSize, config.UploadConcurrency
+
+		if partSize == 0 {
+			partSize = DefaultUploadPartSize
+		}
+
+		if concurrency == 0 {
+			concurrency = DefaultUploadConcurrency
+		}
+
+		err = s3c.ConfigureUploads(partSize, concurrency)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var postgres *PostgresStore
+
+	if config.Writes(PostgresSink) {
+		postgres, err = NewPostgresStore(context.Background(), logger, config.PostgresURL)
+
+		if err != nil {
+			l.Infof("failed to create postgres sink: %s", err.Error())
+			return nil, err
+		}
+
+		err = postgres.Migrate(context.Background())
+
+		if err != nil {
+			postgres.Close()
+			return nil, err
+		}
+	}
+
+	var addressIndex *AddressIndex
+
+	if glue.AddressIndexMeta.Bucket != "" {
+		addressIndex = &AddressIndex{Logger: logger, S3: s3c, Bucket: glue.AddressIndexMeta.Bucket}
+	}
+
 	// resourceVersion, err := GetResourceVersion()
 
 	// if err != nil {
@@ -99,6 +267,16 @@ func NewEthereumCrawler(config Config) (*EthereumCrawler, error) {
 		EthereumService: eths,
 		Glue:            glue,
 		S3:              s3c,
+		Prices:          prices,
+		PriceStore:      priceStore,
+		Tokens:          tokens,
+		TokenFilter:     tokenFilter,
+		Contracts:       contracts,
+		ContractABIs:    contractABIs,
+		Decoder:         decoder,
+		Checkpoints:     checkpoints,
+		AddressIndex:    addressIndex,
+		Postgres:        postgres,
 		Wg:              &sync.WaitGroup{},
 		Start:           time.Now(),
 		Sema:            make(chan struct{}, config.ConcurrencyLimit),
@@ -135,6 +313,14 @@ func (c *EthereumCrawler) Crawl() error {
 		return err
 	}
 
+	if c.Config.Enriches(RewardsTier) {
+		err = c.SyncRewards(0, c.Head)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	c.Head = 1_000_000
 
 	for i := c.Head; i > 0; i -= c.Config.BatchSize {
@@ -167,6 +353,26 @@ func (c *EthereumCrawler) Close() {
 	c.Client.Close()
 	close(c.Sema)
 
+	if c.PriceStore != nil {
+		err := c.PriceStore.Flush()
+
+		if err != nil {
+			l.Errorf("failed to flush price store: %s", err.Error())
+		}
+	}
+
+	if c.Checkpoints != nil {
+		err := c.Checkpoints.Flush()
+
+		if err != nil {
+			l.Errorf("failed to flush checkpoints: %s", err.Error())
+		}
+	}
+
+	if c.Postgres != nil {
+		c.Postgres.Close()
+	}
+
 	c.Elapsed = time.Since(c.Start)
 
 	l.Info("closed all connections, shutting down...")
@@ -186,6 +392,15 @@ func (c *EthereumCrawler) ProcessBatch(start, end uint64) error {
 		}
 	}
 
+	// flush after every batch so a crash only loses the marks of the batches in flight
+	if c.Checkpoints != nil {
+		err := c.Checkpoints.Flush()
+
+		if err != nil {
+			l.Errorf("failed to flush checkpoints: %s", err.Error())
+		}
+	}
+
 	return nil
 }
 
@@ -196,12 +411,57 @@ func (c *EthereumCrawler) ProcessBlock(b uint64) error {
 		return err
 	}
 
-	err = c.UploadBlock(result)
+	err = c.WriteBlock(result)
 
 	if err != nil {
 		return err
 	}
 
+	if c.Checkpoints != nil {
+		return c.Checkpoints.Mark(c.Config.Network, b)
+	}
+
+	return nil
+}
+
+// WriteBlock writes the block to the configured sinks in parallel, the block counts as written once every sink succeeded
+func (c *EthereumCrawler) WriteBlock(result *BlockEventsResult) error {
+	var wg sync.WaitGroup
+
+	errs := make(chan error, len(Sinks))
+
+	if c.Config.Writes(S3Sink) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.UploadBlock(result)
+		}()
+	}
+
+	if c.Postgres != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := c.Postgres.WriteBlock(context.Background(), result)
+
+			if err != nil {
+				err = fmt.Errorf("failed to write block=%d to postgres: %s", result.EventsPartitionKey.Block, err.Error())
+			}
+
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -213,70 +473,117 @@ func (c *EthereumCrawler) UploadBlock(result *BlockEventsResult) error {
 		return errors.New("no events found, there shoudl be at least one block event")
 	}
 
-	encodedEvents, err := NDJSON[Event](result.Events)
+	encodedEvents, err := EncodePartition(result.Events, c.Config.Compression)
 
 	if err != nil {
 		return err
 	}
 
-	ext := "ndjson"
+	eventPartition := c.Config.Compression.PartitionKey(result.EventsPartitionKey)
 
-	eventPartition := fmt.Sprintf("%s.%s", result.EventsPartitionKey.String(), ext)
+	blockHash := result.Events[0].Block
 
-	err = c.S3.UploadBytes(c.Glue.EventMeta.Bucket, eventPartition, bytes.NewBuffer(encodedEvents.Bytes()))
+	err = c.UploadPartition(c.Glue.EventMeta.Bucket, eventPartition, encodedEvents, blockHash)
 
 	if err != nil {
 		return err
 	}
 
-	l.Infof("uploaded block=%d events to partition=%s", result.EventsPartitionKey.Block, eventPartition)
-
 	if len(result.Action) > 0 {
-		act, err := NDJSON[Action](result.Action)
+		act, err := EncodePartition(result.Action, c.Config.Compression)
 
 		if err != nil {
 			return err
 		}
 
-		actionPartition := fmt.Sprintf("%s.%s", result.ActionPartitionKey.String(), ext)
+		actionPartition := c.Config.Compression.PartitionKey(result.ActionPartitionKey)
 
-		err = c.S3.UploadBytes(c.Glue.ActionMeta.Bucket, actionPartition, bytes.NewBuffer(act.Bytes()))
+		err = c.UploadPartition(c.Glue.ActionMeta.Bucket, actionPartition, act, blockHash)
 
 		if err != nil {
 			return err
 		}
 
-		l.Infof("uploaded block %d actions to %s", result.ActionPartitionKey.Block, actionPartition)
+		err = c.UploadAddressIndex(result, actionPartition)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(result.Decoded) > 0 {
+		if c.Glue.DecodedEventMeta.Bucket == "" {
+			l.Warnf("decoded events table not found, skipping %d decoded events of block=%d", len(result.Decoded), result.EventsPartitionKey.Block)
+			return nil
+		}
+
+		decoded, err := EncodePartition(result.Decoded, c.Config.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		err = c.UploadPartition(c.Glue.DecodedEventMeta.Bucket, eventPartition, decoded, blockHash)
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (c *EthereumCrawler) GetHistoricalContracts() (*BlockEventsResult, error) {
-	var result *BlockEventsResult
+// UploadPartition uploads a partition of a block, unchanged partitions are skipped and overwriting a partition
+// recorded with another block hash is logged as a possible reorg. The partition written under another compression
+// is deleted so the table doesn't hold the rows twice
+func (c *EthereumCrawler) UploadPartition(bucket, key string, data *bytes.Buffer, blockHash string) error {
+	l := c.Logger.Sugar()
 
-	contractAddr := common.HexToAddress("0x5d35a44Db8a390aCfa997C9a9Ba3a2F878595630")
+	meta := NewObjectMeta(data.Bytes(), blockHash)
+	meta.ContentEncoding = c.Config.Compression.ContentEncoding()
 
-	manager, err := NewMain(contractAddr, c.Client)
+	status, err := c.S3.UploadObject(bucket, key, data, meta)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	opt := &bind.CallOpts{}
+	if status != Unchanged {
+		_, err = c.S3.DeleteKeys(bucket, SiblingKeys(key))
 
-	mine := common.HexToAddress("0x84725c8f954f18709aDcA150a0635D2fBE94fDfF")
+		if err != nil {
+			return fmt.Errorf("failed to delete the other compressions of partition=%s: %s", key, err.Error())
+		}
+	}
 
-	userStaked, err := manager.GetUserStake(opt, mine)
+	switch status {
+	case Unchanged:
+		l.Infof("skipped unchanged partition=%s", key)
+	case Reorged:
+		l.Warnf("possible reorg, overwrote partition=%s with block=%s", key, blockHash)
+	default:
+		l.Infof("uploaded partition=%s", key)
+	}
+
+	return nil
+}
+
+// GetHistoricalContracts snapshots the CasimirManager state from the fork block to the current head
+func (c *EthereumCrawler) GetHistoricalContracts() (*BlockEventsResult, error) {
+	var result *BlockEventsResult
+
+	interval := c.Config.SnapshotInterval
+
+	if interval == 0 {
+		interval = DefaultSnapshotInterval
+	}
+
+	err := c.SnapshotManagerRange(c.Config.ForkBlock, c.Head, interval)
 
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("----")
-	fmt.Println(userStaked)
-	fmt.Println("----")
-
 	return result, nil
 }
 
@@ -292,6 +599,8 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 
 	fmt.Println(block.Hash())
 
+	c.EthereumService.Times.Remember(block.NumberU64(), block.Time())
+
 	blockTime := int64(block.Time())
 
 	tt := time.Unix(blockTime, 0)
@@ -309,6 +618,10 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 		ReceivedAt: block.Time(),
 	}
 
+	if c.Config.Enriches(BlockTier) {
+		EnrichBlock(blockEvent, block)
+	}
+
 	result.EventsPartitionKey = Partition{
 		Chain:   Ethereum,
 		Network: c.Config.Network,
@@ -323,7 +636,9 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 		return result, nil
 	}
 
-	for _, tx := range block.Transactions() {
+	price := c.BlockPrice(block.Time())
+
+	for i, tx := range block.Transactions() {
 		txEvent := Event{
 			Chain:       Ethereum,
 			Network:     c.Config.Network,
@@ -333,37 +648,74 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 			Height:      b,
 			Transaction: tx.Hash().Hex(),
 			ReceivedAt:  blockEvent.ReceivedAt,
-			GasFee:      fmt.Sprintf("%f", GasFeeInETH(tx.GasPrice(), tx.Gas())),
+			Price:       price,
 		}
 
 		if tx.Value() != nil {
 			txEvent.Amount = tx.Value().String()
 		}
 
-		sender, err := c.Client.TransactionSender(context.Background(), tx, block.Hash(), uint(0))
+		if c.Config.Enriches(BlockTier) {
+			EnrichBlock(&txEvent, block)
+		}
 
-		if err != nil {
-			return nil, err
+		if c.Config.Enriches(TransactionTier) {
+			EnrichTransaction(&txEvent, tx, uint(i))
 		}
 
-		txEvent.Sender = sender.Hex()
-		senderBalance, err := c.Client.BalanceAt(context.Background(), sender, block.Number())
+		var receipt *Receipt
+
+		if c.Config.Enriches(ReceiptTier) || c.Config.Enriches(TokenTier) || c.Config.Enriches(ContractTier) || c.Decoder != nil {
+			receipt, err = c.TransactionReceipt(context.Background(), tx.Hash())
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to get receipt for tx=%s: %s", tx.Hash().Hex(), err.Error())
+			}
+		}
+
+		if c.Config.Enriches(ReceiptTier) {
+			fees := ComputeTxFees(receipt, tx, block.BaseFee())
+
+			txEvent.GasFee = c.FormatFee(fees.Total)
+			txEvent.GasUsed = fees.GasUsed
+			txEvent.EffectiveGasPrice = fees.EffectiveGasPrice.String()
+			txEvent.BurntFee = c.FormatFee(fees.Burnt)
+			txEvent.PriorityFee = c.FormatFee(fees.Tip)
+			txEvent.BlobFee = c.FormatFee(fees.Blob)
+
+			EnrichReceipt(&txEvent, receipt)
+		}
+
+		sender, err := c.Client.TransactionSender(context.Background(), tx, block.Hash(), uint(i))
 
 		if err != nil {
 			return nil, err
 		}
 
-		txEvent.SenderBalance = senderBalance.String()
+		txEvent.Sender = sender.Hex()
 
 		if tx.To() != nil {
 			txEvent.Recipient = tx.To().Hex()
-			recipeintBalance, err := c.Client.BalanceAt(context.Background(), *tx.To(), block.Number())
+		}
+
+		if c.Config.Enriches(BalanceTier) {
+			senderBalance, err := c.Client.BalanceAt(context.Background(), sender, block.Number())
 
 			if err != nil {
 				return nil, err
 			}
 
-			txEvent.RecipientBalance = recipeintBalance.String()
+			txEvent.SenderBalance = senderBalance.String()
+
+			if tx.To() != nil {
+				recipeintBalance, err := c.Client.BalanceAt(context.Background(), *tx.To(), block.Number())
+
+				if err != nil {
+					return nil, err
+				}
+
+				txEvent.RecipientBalance = recipeintBalance.String()
+			}
 		}
 
 		result.Events = append(result.Events, txEvent)
@@ -376,8 +728,9 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 			Address:    txEvent.Sender,
 			Amount:     txEvent.Amount,
 			Balance:    txEvent.SenderBalance,
-			Gas:        fmt.Sprintf("%f", GasFeeInETH(tx.GasPrice(), tx.Gas())),
+			Gas:        txEvent.GasFee,
 			Hash:       tx.Hash().Hex(),
+			Price:      price,
 			ReceivedAt: blockEvent.ReceivedAt,
 		}
 
@@ -389,28 +742,241 @@ func (c *EthereumCrawler) GetBlockEvents(b uint64) (*BlockEventsResult, error) {
 			Address:    txEvent.Recipient,
 			Amount:     txEvent.Amount,
 			Balance:    txEvent.RecipientBalance,
-			Gas:        fmt.Sprintf("%f", GasFeeInETH(tx.GasPrice(), tx.Gas())),
+			Gas:        txEvent.GasFee,
 			Hash:       tx.Hash().Hex(),
+			Price:      price,
 			ReceivedAt: blockEvent.ReceivedAt,
 		}
 
 		result.ActionPartitionKey = result.EventsPartitionKey
 		result.Action = append(result.Action, senderAction, recipientAction)
+
+		if c.Config.Enriches(TokenTier) {
+			tokenActions, err := c.GetTokenActions(receipt, block.Time())
+
+			if err != nil {
+				return nil, err
+			}
+
+			result.Action = append(result.Action, tokenActions...)
+		}
+
+		if c.Config.Enriches(ContractTier) {
+			result.Action = append(result.Action, c.GetContractActions(receipt, block.Time(), price)...)
+		}
+
+		if c.Decoder != nil {
+			decoded, err := c.Decoder.DecodeLogs(receipt.Logs)
+
+			if err != nil {
+				l.Warnf("failed to decode logs tx=%s: %s", tx.Hash().Hex(), err.Error())
+			}
+
+			for _, event := range decoded {
+				event.Network = c.Config.Network
+				event.Timestamp = block.Time()
+				result.Decoded = append(result.Decoded, event)
+			}
+		}
+	}
+
+	if c.Config.Enriches(TraceTier) && !c.TracingDisabled.Load() {
+		internal, err := c.GetInternalActions(block, price)
+
+		if errors.Is(err, ErrTracingUnavailable) {
+			c.TracingDisabled.Store(true)
+			l.Warnf("disabling internal transaction tracing: %s", err.Error())
+		} else if err != nil {
+			return nil, err
+		}
+
+		result.Action = append(result.Action, internal...)
+	}
+
+	if c.Rewards != nil {
+		for i := range result.Action {
+			c.Rewards.Apply(&result.Action[i], b)
+		}
+	}
+
+	topLevel := 0
+
+	for _, action := range result.Action {
+		if action.IsTopLevel() {
+			topLevel++
+		}
 	}
 
-	if (len(result.Events)-1)*2 != len(result.Action) {
-		l.Errorf("block=%d events=%d actions=%d", b, len(result.Events), len(result.Action))
+	if (len(result.Events)-1)*2 != topLevel {
+		l.Errorf("block=%d events=%d actions=%d", b, len(result.Events), topLevel)
 	}
 
 	return result, nil
 }
 
-func GasFeeInETH(gasPrice *big.Int, gasLimit uint64) float64 {
-	gasPriceFloat64 := new(big.Float).SetInt(gasPrice)
-	gasLimitInt64 := int64(gasLimit)
+// GetTokenActions returns sent and received actions for the indexed erc-20 transfers in a receipt
+func (c *EthereumCrawler) GetTokenActions(receipt *Receipt, receivedAt uint64) ([]Action, error) {
+	var actions []Action
+
+	for _, transfer := range DecodeERC20Transfers(receipt.Logs) {
+		if !c.TokenFilter.Indexes(transfer.Token) {
+			continue
+		}
+
+		token, err := c.Tokens.Token(context.Background(), transfer.Token)
+
+		if err != nil {
+			return nil, err
+		}
+
+		decimals := token.Decimals
+		logIndex := transfer.LogIndex
+
+		sent := Action{
+			Chain:         Ethereum,
+			Network:       c.Config.Network,
+			Type:          Wallet,
+			Action:        Sent,
+			Address:       transfer.From.Hex(),
+			Amount:        transfer.Value.String(),
+			Hash:          transfer.TxHash.Hex(),
+			ReceivedAt:    receivedAt,
+			TokenAddress:  token.Address.Hex(),
+			TokenSymbol:   token.Symbol,
+			TokenDecimals: &decimals,
+			LogIndex:      &logIndex,
+		}
+
+		received := sent
+		received.Action = Received
+		received.Address = transfer.To.Hex()
+
+		actions = append(actions, sent, received)
+	}
+
+	return actions, nil
+}
+
+// GetInternalActions returns sent and received actions for ether moved by contracts inside the block's transactions
+func (c *EthereumCrawler) GetInternalActions(block *types.Block, price string) ([]Action, error) {
+	traces, err := c.TraceBlock(context.Background(), block.Number())
+
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := InternalTransfers(traces, block.Transactions())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract internal transfers for block=%d: %s", block.NumberU64(), err.Error())
+	}
+
+	var actions []Action
+
+	for _, transfer := range transfers {
+		sent := Action{
+			Chain:      Ethereum,
+			Network:    c.Config.Network,
+			Type:       Wallet,
+			Action:     Sent,
+			Address:    transfer.From.Hex(),
+			Amount:     transfer.Value.String(),
+			Hash:       transfer.TxHash.Hex(),
+			Price:      price,
+			ReceivedAt: block.Time(),
+			TracePath:  transfer.Path,
+		}
+
+		received := sent
+		received.Action = Received
+		received.Address = transfer.To.Hex()
 
-	gasFee := new(big.Float).Mul(gasPriceFloat64, big.NewFloat(float64(gasLimitInt64)))
-	gasFeeFloat64, _ := gasFee.Float64()
+		if c.Config.Enriches(BalanceTier) {
+			for _, action := range []*Action{&sent, &received} {
+				balance, err := c.Client.BalanceAt(context.Background(), common.HexToAddress(action.Address), block.Number())
 
-	return gasFeeFloat64 / 1e18
+				if err != nil {
+					return nil, err
+				}
+
+				action.Balance = balance.String()
+			}
+		}
+
+		actions = append(actions, sent, received)
+	}
+
+	return actions, nil
+}
+
+// EnrichBlock sets the block header fields on an event
+func EnrichBlock(event *Event, block *types.Block) {
+	gasUsed := block.GasUsed()
+
+	event.Miner = block.Coinbase().Hex()
+	event.BlockGasUsed = &gasUsed
+
+	if block.BaseFee() != nil {
+		event.BaseFee = block.BaseFee().String()
+	}
+}
+
+// EnrichTransaction sets the fields available on the transaction itself
+func EnrichTransaction(event *Event, tx *types.Transaction, index uint) {
+	nonce := tx.Nonce()
+	txType := tx.Type()
+
+	event.Nonce = &nonce
+	event.TxType = &txType
+	event.TxIndex = &index
+
+	// the first 4 bytes of the input select the called contract method
+	if len(tx.Data()) >= 4 {
+		event.MethodSelector = hexutil.Encode(tx.Data()[:4])
+	}
+}
+
+// EnrichReceipt sets the fields only available on the transaction receipt
+func EnrichReceipt(event *Event, receipt *Receipt) {
+	logs := len(receipt.Logs)
+
+	event.LogCount = &logs
+	event.Status = Success
+
+	if receipt.Status == types.ReceiptStatusFailed {
+		event.Status = Reverted
+	}
+
+	if receipt.ContractAddress != (common.Address{}) {
+		event.ContractAddress = receipt.ContractAddress.Hex()
+	}
+}
+
+// BlockPrice returns the usd price of ether at the block time or an empty string when no source can price it
+func (c *EthereumCrawler) BlockPrice(blockTime uint64) string {
+	if c.Prices == nil {
+		return ""
+	}
+
+	price, err := c.Prices.HistoricalPrice(Ethereum, USD, time.Unix(int64(blockTime), 0))
+
+	if errors.Is(err, ErrPriceNotCached) {
+		c.Logger.Sugar().Errorf("no cached price at time=%d, events are written without a price (run `prices sync` for the range first): %s", blockTime, err.Error())
+		return ""
+	}
+
+	if err != nil {
+		c.Logger.Sugar().Warnf("failed to get price at time=%d: %s", blockTime, err.Error())
+		return ""
+	}
+
+	return strconv.FormatFloat(price.Value, 'f', -1, 64)
+}
+
+// FormatFee returns a wei amount as an integer string, or as an exact ether decimal when configured
+func (c *EthereumCrawler) FormatFee(wei *big.Int) string {
+	if c.Config.FeesInETH {
+		return FormatETH(wei)
+	}
+	return wei.String()
 }
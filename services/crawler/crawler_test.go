@@ -1,8 +1,12 @@
 package main
 
 import (
+	"math/big"
 	"net/url"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 func TestGetHistoricalContracts(t *testing.T) {
@@ -42,6 +46,50 @@ func TestGetHistoricalContracts(t *testing.T) {
 
 }
 
+func TestEnrichTransaction(t *testing.T) {
+	to := common.HexToAddress("0x5d35a44Db8a390aCfa997C9a9Ba3a2F878595630")
+
+	tx := types.NewTx(&types.DynamicFeeTx{
+		Nonce:     7,
+		To:        &to,
+		Value:     big.NewInt(1),
+		Gas:       21000,
+		GasFeeCap: big.NewInt(2),
+		GasTipCap: big.NewInt(1),
+		Data:      common.FromHex("0xa9059cbb00000000"),
+	})
+
+	event := Event{}
+
+	EnrichTransaction(&event, tx, 3)
+
+	if *event.Nonce != 7 || *event.TxType != types.DynamicFeeTxType || *event.TxIndex != 3 {
+		t.Errorf("unexpected transaction fields: nonce=%d type=%d index=%d", *event.Nonce, *event.TxType, *event.TxIndex)
+	}
+
+	if event.MethodSelector != "0xa9059cbb" {
+		t.Errorf("expected: %s, got: %s", "0xa9059cbb", event.MethodSelector)
+	}
+
+	EnrichReceipt(&event, &Receipt{Receipt: &types.Receipt{Status: types.ReceiptStatusFailed}})
+
+	if event.Status != Reverted || *event.LogCount != 0 || event.ContractAddress != "" {
+		t.Errorf("unexpected receipt fields: status=%s logs=%d contract=%s", event.Status, *event.LogCount, event.ContractAddress)
+	}
+
+	config := Config{Enrichment: []EnrichmentTier{BlockTier}}
+
+	if config.Enriches(BalanceTier) || !config.Enriches(BlockTier) || !(Config{}).Enriches(ReceiptTier) {
+		t.Error("unexpected enrichment tiers")
+	}
+
+	_, err := ParseEnrichmentTiers([]string{"block", "traces"})
+
+	if err == nil {
+		t.Error("expected error for unknown tier")
+	}
+}
+
 // func TestNewEthereumCrawler(t *testing.T) {
 // 	var err error
 // 	crawler, err := NewEthereumCrawler(Config{Env: Dev})
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DecodedEvent is a log decoded with a configured abi, args are keyed by the abi input names
+type DecodedEvent struct {
+	Network      NetworkType            `json:"network"`
+	BlockNumber  uint64                 `json:"block_number"`
+	BlockHash    string                 `json:"block_hash"`
+	TxHash       string                 `json:"tx_hash"`
+	LogIndex     uint                   `json:"log_index"`
+	Timestamp    uint64                 `json:"timestamp"`
+	Contract     string                 `json:"contract"`
+	ContractName string                 `json:"contract_name"`
+	Event        string                 `json:"event"`
+	Signature    string                 `json:"signature"`
+	Args         map[string]interface{} `json:"args"`
+}
+
+// ContractABI is a loaded abi, logs of any address match when no addresses are bound
+type ContractABI struct {
+	Name      string
+	ABI       abi.ABI
+	Addresses map[common.Address]bool
+}
+
+// EventDecoder matches logs to the configured abis by topic0
+type EventDecoder struct {
+	contracts []*ContractABI
+	events    map[common.Hash][]*ContractABI
+}
+
+type hardhatArtifact struct {
+	ContractName string          `json:"contractName"`
+	ABI          json.RawMessage `json:"abi"`
+}
+
+func NewEventDecoder(contracts ...*ContractABI) *EventDecoder {
+	decoder := &EventDecoder{events: make(map[common.Hash][]*ContractABI)}
+
+	for _, c := range contracts {
+		decoder.Add(c)
+	}
+
+	return decoder
+}
+
+func (d *EventDecoder) Add(contract *ContractABI) {
+	d.contracts = append(d.contracts, contract)
+
+	for _, event := range contract.ABI.Events {
+		if event.Anonymous {
+			continue
+		}
+		d.events[event.ID] = append(d.events[event.ID], contract)
+	}
+}
+
+// Len returns the number of loaded abis
+func (d *EventDecoder) Len() int {
+	return len(d.contracts)
+}
+
+// Decode returns the decoded log, false when no configured abi has the event or its contract is bound elsewhere.
+// Abis bound to the log's address win over unbound ones sharing the same event.
+func (d *EventDecoder) Decode(log *types.Log) (DecodedEvent, bool, error) {
+	if len(log.Topics) == 0 {
+		return DecodedEvent{}, false, nil
+	}
+
+	var match *ContractABI
+
+	for _, c := range d.events[log.Topics[0]] {
+		if c.Addresses[log.Address] {
+			match = c
+			break
+		}
+
+		if len(c.Addresses) == 0 && match == nil {
+			match = c
+		}
+	}
+
+	if match == nil {
+		return DecodedEvent{}, false, nil
+	}
+
+	event, err := match.ABI.EventByID(log.Topics[0])
+
+	if err != nil {
+		return DecodedEvent{}, false, err
+	}
+
+	args := make(map[string]interface{})
+
+	err = event.Inputs.UnpackIntoMap(args, log.Data)
+
+	if err != nil {
+		return DecodedEvent{}, false, fmt.Errorf("failed to unpack %s data tx=%s: %s", event.Name, log.TxHash.Hex(), err.Error())
+	}
+
+	var indexed abi.Arguments
+
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+
+	err = abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:])
+
+	if err != nil {
+		return DecodedEvent{}, false, fmt.Errorf("failed to parse %s topics tx=%s: %s", event.Name, log.TxHash.Hex(), err.Error())
+	}
+
+	for k, v := range args {
+		args[k] = NormalizeArg(v)
+	}
+
+	return DecodedEvent{
+		BlockNumber:  log.BlockNumber,
+		BlockHash:    log.BlockHash.Hex(),
+		TxHash:       log.TxHash.Hex(),
+		LogIndex:     log.Index,
+		Contract:     log.Address.Hex(),
+		ContractName: match.Name,
+		Event:        event.Name,
+		Signature:    event.Sig,
+		Args:         args,
+	}, true, nil
+}
+
+// DecodeLogs decodes every log a configured abi knows, logs that fail to decode are returned as an error after the rest
+func (d *EventDecoder) DecodeLogs(logs []*types.Log) ([]DecodedEvent, error) {
+	var decoded []DecodedEvent
+	var failed []string
+
+	for _, log := range logs {
+		event, ok, err := d.Decode(log)
+
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+
+		if ok {
+			decoded = append(decoded, event)
+		}
+	}
+
+	if len(failed) > 0 {
+		return decoded, errors.New(strings.Join(failed, "; "))
+	}
+
+	return decoded, nil
+}
+
+// NormalizeArg converts decoded abi values to json friendly values, integers become decimal strings
+// so uint256 values keep their precision and byte arrays become hex
+func NormalizeArg(v interface{}) interface{} {
+	switch value := v.(type) {
+	case *big.Int:
+		return value.String()
+	case common.Address:
+		return value.Hex()
+	case common.Hash:
+		return value.Hex()
+	case []byte:
+		return hexutil.Encode(value)
+	case string, bool:
+		return value
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("%d", rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%d", rv.Uint())
+	case reflect.Array:
+		// fixed bytes (e.g. bytes32)
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		values := make([]interface{}, rv.Len())
+
+		for i := 0; i < rv.Len(); i++ {
+			values[i] = NormalizeArg(rv.Index(i).Interface())
+		}
+
+		return values
+	case reflect.Struct:
+		// tuples are decoded into anonymous structs with the abi names as json tags
+		fields := make(map[string]interface{})
+
+		for i := 0; i < rv.NumField(); i++ {
+			name := rv.Type().Field(i).Tag.Get("json")
+
+			if name == "" {
+				name = rv.Type().Field(i).Name
+			}
+
+			fields[name] = NormalizeArg(rv.Field(i).Interface())
+		}
+
+		return fields
+	}
+
+	return v
+}
+
+// ParseABI parses a hardhat artifact or a plain abi array, the name defaults to the artifact's contract name
+func ParseABI(data []byte) (string, abi.ABI, error) {
+	raw := data
+
+	var artifact hardhatArtifact
+
+	if err := json.Unmarshal(data, &artifact); err == nil && len(artifact.ABI) > 0 {
+		raw = artifact.ABI
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(raw)))
+
+	if err != nil {
+		return "", abi.ABI{}, err
+	}
+
+	return artifact.ContractName, parsed, nil
+}
+
+// LoadContractABI loads an abi from a spec of the form file.json[@0xaddress+...] or ContractName[@0xaddress+...],
+// names without a .json suffix resolve to the contract's hardhat build artifact. Addresses are joined by + since
+// the cli splits slice flags on commas
+func LoadContractABI(spec string) (*ContractABI, error) {
+	source, bound, _ := strings.Cut(spec, "@")
+
+	file := source
+
+	if !strings.HasSuffix(source, ".json") {
+		artifact, err := ContractArtifactPath(source)
+
+		if err != nil {
+			return nil, err
+		}
+
+		file = artifact
+	}
+
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name, parsed, err := ParseABI(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse abi=%s: %s", file, err.Error())
+	}
+
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(file), ".json")
+	}
+
+	contract := &ContractABI{
+		Name:      name,
+		ABI:       parsed,
+		Addresses: make(map[common.Address]bool),
+	}
+
+	if bound == "" {
+		return contract, nil
+	}
+
+	for _, address := range strings.Split(bound, "+") {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid address=%s in abi spec=%s", address, spec)
+		}
+		contract.Addresses[common.HexToAddress(address)] = true
+	}
+
+	return contract, nil
+}
+
+// LoadEventDecoder loads every configured abi spec
+func LoadEventDecoder(specs []string) (*EventDecoder, error) {
+	decoder := NewEventDecoder()
+
+	for _, spec := range specs {
+		contract, err := LoadContractABI(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		decoder.Add(contract)
+	}
+
+	return decoder, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/urfave/cli/v2"
+)
+
+const vaultArtifact = `{
+	"contractName": "Vault",
+	"abi": [{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":false,"name":"shares","type":"uint256"},{"indexed":false,"name":"key","type":"bytes32"},{"indexed":false,"name":"poolIds","type":"uint32[]"}],"name":"Deposit","type":"event"}]
+}`
+
+func TestEventDecoder(t *testing.T) {
+	file := path.Join(t.TempDir(), "Vault.json")
+
+	err := os.WriteFile(file, []byte(vaultArtifact), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	owner := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	decoder, err := LoadEventDecoder([]string{file + "@" + vault.Hex()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := decoder.contracts[0].ABI.Events["Deposit"]
+
+	shares, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	data, err := event.Inputs.NonIndexed().Pack(shares, [32]byte{0xab}, []uint32{1, 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := &types.Log{
+		Address: vault,
+		Topics:  []common.Hash{event.ID, common.BytesToHash(owner.Bytes())},
+		Data:    data,
+	}
+
+	decoded, ok, err := decoder.Decode(log)
+
+	if err != nil || !ok {
+		t.Fatalf("expected a decoded event, got: %v %v", ok, err)
+	}
+
+	if decoded.ContractName != "Vault" || decoded.Event != "Deposit" || decoded.Signature != "Deposit(address,uint256,bytes32,uint32[])" {
+		t.Errorf("unexpected decoded event: %+v", decoded)
+	}
+
+	args, err := json.Marshal(decoded.Args)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"key":"0xab00000000000000000000000000000000000000000000000000000000000000","owner":"0x1000000000000000000000000000000000000001","poolIds":["1","2"],"shares":"123456789012345678901234567890"}`
+
+	if string(args) != expected {
+		t.Errorf("expected: %s, got: %s", expected, string(args))
+	}
+
+	// bound abis don't decode logs of other contracts
+	log.Address = owner
+
+	_, ok, err = decoder.Decode(log)
+
+	if err != nil || ok {
+		t.Errorf("expected no match for an unbound address, got: %v %v", ok, err)
+	}
+}
+
+func TestABIFlag(t *testing.T) {
+	file := path.Join(t.TempDir(), "Vault.json")
+
+	err := os.WriteFile(file, []byte(vaultArtifact), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	second := common.HexToAddress("0x5000000000000000000000000000000000000005")
+
+	var specs []string
+
+	app := NewApp()
+	app.Action = func(c *cli.Context) error {
+		specs = c.StringSlice("abi")
+		return nil
+	}
+
+	err = app.Run([]string{"crawler", "--abi", file + "@" + first.Hex() + "+" + second.Hex(), "--abi", file})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(specs) != 2 {
+		t.Fatalf("expected: %d, got: %d (%v)", 2, len(specs), specs)
+	}
+
+	decoder, err := LoadEventDecoder(specs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bound := decoder.contracts[0].Addresses
+
+	if len(bound) != 2 || !bound[first] || !bound[second] || len(decoder.contracts[1].Addresses) != 0 {
+		t.Errorf("unexpected bound addresses: %v %v", bound, decoder.contracts[1].Addresses)
+	}
+}
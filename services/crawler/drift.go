@@ -0,0 +1,112 @@
+package main
+
+//go:generate go run ./cmd/bindgen -artifact ../../contracts/ethereum/build/artifacts/src/v1/CasimirManager.sol/CasimirManager.json -type Main -pkg main -out casimir_manager.go
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// ABIDrift lists the methods and events that differ between a binding's abi and an artifact's abi,
+// an empty list means the binding decodes the artifact's contract correctly
+func ABIDrift(binding, artifact abi.ABI) []string {
+	var drift []string
+
+	for name, method := range artifact.Methods {
+		bound, ok := binding.Methods[name]
+
+		if !ok {
+			drift = append(drift, fmt.Sprintf("method %s missing from binding", method.Sig))
+			continue
+		}
+
+		if bound.Sig != method.Sig || argTypes(bound.Outputs) != argTypes(method.Outputs) {
+			drift = append(drift, fmt.Sprintf("method %s returns (%s) in binding, %s returns (%s) in artifact", bound.Sig, argTypes(bound.Outputs), method.Sig, argTypes(method.Outputs)))
+		}
+	}
+
+	for name, method := range binding.Methods {
+		if _, ok := artifact.Methods[name]; !ok {
+			drift = append(drift, fmt.Sprintf("method %s removed from artifact", method.Sig))
+		}
+	}
+
+	for name, event := range artifact.Events {
+		bound, ok := binding.Events[name]
+
+		if !ok {
+			drift = append(drift, fmt.Sprintf("event %s missing from binding", event.Sig))
+			continue
+		}
+
+		if bound.ID != event.ID || indexedArgs(bound.Inputs) != indexedArgs(event.Inputs) {
+			drift = append(drift, fmt.Sprintf("event %s (indexed %s) in binding, %s (indexed %s) in artifact", bound.Sig, indexedArgs(bound.Inputs), event.Sig, indexedArgs(event.Inputs)))
+		}
+	}
+
+	for name, event := range binding.Events {
+		if _, ok := artifact.Events[name]; !ok {
+			drift = append(drift, fmt.Sprintf("event %s removed from artifact", event.Sig))
+		}
+	}
+
+	sort.Strings(drift)
+
+	return drift
+}
+
+// CheckManagerBinding compares the generated CasimirManager binding with the build artifact,
+// ErrArtifactNotFound is returned when the contracts haven't been built
+func CheckManagerBinding() error {
+	artifact, err := GetContractBuildArtifact()
+
+	if err != nil {
+		return err
+	}
+
+	_, parsed, err := ParseABI(artifact)
+
+	if err != nil {
+		return fmt.Errorf("failed to parse CasimirManager artifact: %s", err.Error())
+	}
+
+	binding, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		return err
+	}
+
+	drift := ABIDrift(*binding, parsed)
+
+	if len(drift) > 0 {
+		return fmt.Errorf("casimir_manager.go is out of date with the CasimirManager artifact, run go generate: %s", strings.Join(drift, "; "))
+	}
+
+	return nil
+}
+
+func argTypes(args abi.Arguments) string {
+	types := make([]string, len(args))
+
+	for i, arg := range args {
+		types[i] = arg.Type.String()
+	}
+
+	return strings.Join(types, ",")
+}
+
+func indexedArgs(args abi.Arguments) string {
+	var indexed []string
+
+	// positions rather than names, renaming an argument doesn't change the log layout
+	for i, arg := range args {
+		if arg.Indexed {
+			indexed = append(indexed, fmt.Sprintf("%d", i))
+		}
+	}
+
+	return strings.Join(indexed, ",")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+func TestManagerBindingMatchesArtifact(t *testing.T) {
+	err := CheckManagerBinding()
+
+	if errors.Is(err, ErrArtifactNotFound) {
+		t.Skip("contracts aren't built, skipping the binding drift check")
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestABIDrift(t *testing.T) {
+	binding, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if drift := ABIDrift(*binding, *binding); len(drift) != 0 {
+		t.Fatalf("expected no drift, got: %v", drift)
+	}
+
+	changed, err := abi.JSON(strings.NewReader(`[
+		{"inputs":[],"name":"getTotalStake","outputs":[{"type":"uint128"}],"stateMutability":"view","type":"function"},
+		{"anonymous":false,"inputs":[{"indexed":false,"name":"sender","type":"address"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"StakeDeposited","type":"event"}
+	]`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drift := strings.Join(ABIDrift(*binding, changed), "\n")
+
+	for _, expected := range []string{"method getTotalStake() returns (uint256) in binding", "event StakeDeposited(address,uint256) (indexed 0)", "method getUserStake(address) removed from artifact"} {
+		if !strings.Contains(drift, expected) {
+			t.Errorf("expected drift to contain: %s, got: %s", expected, drift)
+		}
+	}
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
@@ -34,6 +38,13 @@ type EthereumService struct {
 	Provider ProviderType
 	Url      url.URL
 	Synced   bool
+	// timestamps of the blocks read, used to find the block of a price time
+	Times *BlockTimes
+}
+
+// Receipt is a transaction receipt, the EIP-4844 blob gas fields are decoded by go-ethereum
+type Receipt struct {
+	*types.Receipt
 }
 
 func NewEthereumService(raw string) (*EthereumService, error) {
@@ -86,9 +97,57 @@ func NewEthereumService(raw string) (*EthereumService, error) {
 		Network:  net,
 		Provider: Casimir,
 		Url:      *url,
+		Times:    NewBlockTimes(),
 	}, nil
 }
 
+// ConnectNetwork connects to the rpc of the config and sets the network of the config to the connected chain,
+// so rows are written and the environment is validated under the network they come from
+func ConnectNetwork(config *Config) (*EthereumService, error) {
+	if config.URL == nil {
+		return nil, errors.New("ethereum rpc url is required")
+	}
+
+	eths, err := NewEthereumService(config.URL.String())
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.Network = eths.Network
+
+	return eths, nil
+}
+
+// TransactionReceipt returns the receipt of a mined transaction
+func (e *EthereumService) TransactionReceipt(ctx context.Context, hash common.Hash) (*Receipt, error) {
+	var raw json.RawMessage
+
+	err := e.Client.Client().CallContext(ctx, &raw, "eth_getTransactionReceipt", hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeReceipt(raw)
+}
+
+func DecodeReceipt(raw json.RawMessage) (*Receipt, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+
+	var receipt types.Receipt
+
+	err := json.Unmarshal(raw, &receipt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{Receipt: &receipt}, nil
+}
+
 func PingEthereumClient(url string) error {
 	client, err := ethclient.Dial(url)
 
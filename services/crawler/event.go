@@ -4,18 +4,24 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 )
 
 type EventType string
 type TxDirection string
 type ContractEvents string
 type SpecificActionType string
+type TxStatus string
+type EnrichmentTier string
 
 const (
 	Block       EventType = "block"
 	Transaction EventType = "transaction"
 	// a special event type that is used to track in and out tx of a address
 	Wallet EventType = "wallet"
+	// logs decoded from the manager and the contracts discovered from it
+	ContractEvent EventType = "contract"
 
 	StakeDeposited       SpecificActionType = "stake_deposited"
 	StakeRebalanced      SpecificActionType = "stake_rebalanced"
@@ -24,8 +30,34 @@ const (
 	// wallet event actions
 	Received SpecificActionType = "received"
 	Sent     SpecificActionType = "sent"
+
+	Success  TxStatus = "success"
+	Reverted TxStatus = "reverted"
+
+	// header fields (base fee, miner, gas used), no extra rpc calls
+	BlockTier EnrichmentTier = "block"
+	// nonce, type, method selector and index, no extra rpc calls
+	TransactionTier EnrichmentTier = "transaction"
+	// exact fees, status, log count and contract address, one receipt call per transaction
+	ReceiptTier EnrichmentTier = "receipt"
+	// sender and recipient balances, two balance calls per transaction
+	BalanceTier EnrichmentTier = "balance"
+	// internal ether transfers from debug_traceBlockByNumber, one trace call per block (opt-in)
+	TraceTier EnrichmentTier = "trace"
+	// erc-20 transfers decoded from receipt logs, one receipt call per transaction and metadata calls once per token
+	TokenTier EnrichmentTier = "token"
+	// per-user rewards and fees from the manager logs and GetUserStake, computed once before crawling (opt-in)
+	RewardsTier EnrichmentTier = "rewards"
+	// logs of the manager and its discovered contracts, one receipt call per transaction
+	ContractTier EnrichmentTier = "contract"
 )
 
+var EnrichmentTiers = []EnrichmentTier{BlockTier, TransactionTier, ReceiptTier, BalanceTier, TraceTier, TokenTier, RewardsTier, ContractTier}
+
+// DefaultEnrichmentTiers are used when no tiers are configured
+var DefaultEnrichmentTiers = []EnrichmentTier{BlockTier, TransactionTier, ReceiptTier, BalanceTier, TokenTier, ContractTier}
+
+// Event is a block or transaction event, it follows common/data/src/schemas/chain_event.schema.json
 type Event struct {
 	Chain            ChainType    `json:"chain"`
 	Network          NetworkType  `json:"network"`
@@ -41,7 +73,24 @@ type Event struct {
 	RecipientBalance string       `json:"recipient_balance"`
 	Price            string       `json:"price"`
 	Amount           string       `json:"amount"`
-	GasFee           string       `json:"gas_fee"`
+	// fees are exact wei integers unless the crawler is configured to format them in ether
+	GasFee            string `json:"gas_fee"`
+	GasUsed           uint64 `json:"gas_used"`
+	EffectiveGasPrice string `json:"effective_gas_price"`
+	BurntFee          string `json:"burnt_fee"`
+	PriorityFee       string `json:"priority_fee"`
+	BlobFee           string `json:"blob_fee"`
+	// optional fields, only set when their enrichment tier is enabled
+	Nonce           *uint64  `json:"nonce,omitempty"`
+	TxType          *uint8   `json:"tx_type,omitempty"`
+	MethodSelector  string   `json:"method_selector,omitempty"`
+	TxIndex         *uint    `json:"tx_index,omitempty"`
+	ContractAddress string   `json:"contract_address,omitempty"`
+	Status          TxStatus `json:"status,omitempty"`
+	LogCount        *int     `json:"log_count,omitempty"`
+	BaseFee         string   `json:"base_fee,omitempty"`
+	Miner           string   `json:"miner,omitempty"`
+	BlockGasUsed    *uint64  `json:"block_gas_used,omitempty"`
 }
 
 type Action struct {
@@ -58,6 +107,14 @@ type Action struct {
 	ReceivedAt     uint64             `json:"received_at"`
 	RewardsAllTime string             `json:"rewards_all_time"`
 	StakingFees    string             `json:"staking_fees"`
+	// set on internal transfers made by contracts (e.g. 0.2.1), empty for top level transactions
+	TracePath string `json:"trace_path,omitempty"`
+	// set on erc-20 transfers, the amount is in the token's base units
+	TokenAddress  string `json:"token_address,omitempty"`
+	TokenSymbol   string `json:"token_symbol,omitempty"`
+	TokenDecimals *uint8 `json:"token_decimals,omitempty"`
+	// index of the log in the block, set on token transfers and contract events
+	LogIndex *uint `json:"log_index,omitempty"`
 }
 
 type BlockEventsResult struct {
@@ -65,6 +122,8 @@ type BlockEventsResult struct {
 	Action             []Action  `json:"action"`
 	EventsPartitionKey Partition `json:"events_partition_key"`
 	ActionPartitionKey Partition `json:"action_partition_key"`
+	// logs decoded with the configured abis, uploaded under the events partition
+	Decoded []DecodedEvent `json:"decoded"`
 }
 
 func (e EventType) String() string {
@@ -78,7 +137,35 @@ func (e EventType) String() string {
 	}
 }
 
-func NDJSON[T Event | Action](events []T) (*bytes.Buffer, error) {
+// IsTopLevel returns true for the native ether sent and received actions of a transaction
+func (a Action) IsTopLevel() bool {
+	return a.Type == Wallet && a.TracePath == "" && a.TokenAddress == ""
+}
+
+// ParseEnrichmentTiers parses tier names (e.g. block,receipt)
+func ParseEnrichmentTiers(names []string) ([]EnrichmentTier, error) {
+	tiers := make([]EnrichmentTier, 0, len(names))
+
+	for _, name := range names {
+		found := false
+
+		for _, tier := range EnrichmentTiers {
+			if string(tier) == strings.TrimSpace(name) {
+				tiers = append(tiers, tier)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown enrichment tier: %s", name)
+		}
+	}
+
+	return tiers, nil
+}
+
+func NDJSON[T Event | Action | ManagerSnapshot | UserReward | PoolTransition | ContractEventRecord | DecodedEvent | ValidatorDay | AddressIndexEntry](events []T) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
 
 	for _, ev := range events {
@@ -92,3 +179,26 @@ func NDJSON[T Event | Action](events []T) (*bytes.Buffer, error) {
 
 	return &buf, nil
 }
+
+// ReadNDJSON decodes the newline delimited rows written by NDJSON
+func ReadNDJSON[T Event | Action | ContractEventRecord | AddressIndexEntry](r io.Reader) ([]T, error) {
+	var rows []T
+
+	decoder := json.NewDecoder(r)
+
+	for {
+		var row T
+
+		err := decoder.Decode(&row)
+
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode row %d: %s", len(rows)+1, err.Error())
+		}
+
+		rows = append(rows, row)
+	}
+}
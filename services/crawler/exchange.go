@@ -5,14 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 )
 
 type Currency string
+type CryptoCompareResolution string
 
 const (
 	USD Currency = "USD"
+
+	CryptoCompareSource = "cryptocompare"
+
+	Minute CryptoCompareResolution = "minutes"
+	Hour   CryptoCompareResolution = "hours"
+	Day    CryptoCompareResolution = "days"
+
+	// cryptocompare only keeps minute candles for the last 7 days
+	CryptoCompareMinuteRetention = 7 * 24 * time.Hour
+	CryptoCompareHistoricalLimit = 10
+	CryptoCompareRangeLimit      = 2000
+
+	// prices from two sources more than 2% apart are logged
+	DefaultPriceDivergence = 0.02
 )
 
 // Exchange is an interface for getting current and historical prices
@@ -24,11 +42,19 @@ type Exchange interface {
 	HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error)
 }
 
+// RangeExchange is implemented by exchanges that can return every candle in a time range in bulk,
+// the returned duration is the length of each candle
+type RangeExchange interface {
+	HistoricalRange(coin ChainType, currency Currency, from, to time.Time) ([]ExchangePrice, time.Duration, error)
+}
+
 type ExchangePrice struct {
 	Value    float64   `json:"price,omitempty"`
 	Currency string    `json:"currency,omitempty"`
 	Coin     string    `json:"coin,omitempty"`
 	Time     time.Time `json:"time,omitempty"`
+	// the exchange that supplied the price (e.g. cryptocompare, coingecko)
+	Source string `json:"source,omitempty"`
 }
 
 type CryptoCompareExchange struct {
@@ -37,123 +63,348 @@ type CryptoCompareExchange struct {
 	Version int
 }
 
+type CryptoCompareError struct {
+	Type      int                    `json:"type"`
+	Message   string                 `json:"message"`
+	OtherInfo map[string]interface{} `json:"other_info"`
+}
+
+// CryptoCompareTickerResponse is the response of the latest tick endpoint, keyed by instrument (e.g. ETH-USD)
 type CryptoCompareTickerResponse struct {
-	Data struct {
-		ETHUSD struct {
-			Type                          string  `json:"TYPE"`
-			Market                        string  `json:"MARKET"`
-			Instrument                    string  `json:"INSTRUMENT"`
-			Ccseq                         int     `json:"CCSEQ"`
-			Value                         float64 `json:"VALUE"`
-			ValueFlag                     string  `json:"VALUE_FLAG"`
-			ValueLastUpdateTs             int     `json:"VALUE_LAST_UPDATE_TS"`
-			ValueLastUpdateNs             int     `json:"VALUE_LAST_UPDATE_NS"`
-			LastUpdateQuantity            float64 `json:"LAST_UPDATE_QUANTITY"`
-			LastUpdateQuoteQuantity       float64 `json:"LAST_UPDATE_QUOTE_QUANTITY"`
-			LastUpdateCcseq               int     `json:"LAST_UPDATE_CCSEQ"`
-			CurrentHourVolume             float64 `json:"CURRENT_HOUR_VOLUME"`
-			CurrentHourQuoteVolume        float64 `json:"CURRENT_HOUR_QUOTE_VOLUME"`
-			CurrentHourOpen               float64 `json:"CURRENT_HOUR_OPEN"`
-			CurrentHourHigh               float64 `json:"CURRENT_HOUR_HIGH"`
-			CurrentHourLow                float64 `json:"CURRENT_HOUR_LOW"`
-			CurrentHourTotalIndexUpdates  int     `json:"CURRENT_HOUR_TOTAL_INDEX_UPDATES"`
-			CurrentHourChange             float64 `json:"CURRENT_HOUR_CHANGE"`
-			CurrentHourChangePercentage   float64 `json:"CURRENT_HOUR_CHANGE_PERCENTAGE"`
-			CurrentDayVolume              float64 `json:"CURRENT_DAY_VOLUME"`
-			CurrentDayQuoteVolume         float64 `json:"CURRENT_DAY_QUOTE_VOLUME"`
-			CurrentDayOpen                float64 `json:"CURRENT_DAY_OPEN"`
-			CurrentDayHigh                float64 `json:"CURRENT_DAY_HIGH"`
-			CurrentDayLow                 float64 `json:"CURRENT_DAY_LOW"`
-			CurrentDayTotalIndexUpdates   int     `json:"CURRENT_DAY_TOTAL_INDEX_UPDATES"`
-			CurrentDayChange              float64 `json:"CURRENT_DAY_CHANGE"`
-			CurrentDayChangePercentage    float64 `json:"CURRENT_DAY_CHANGE_PERCENTAGE"`
-			CurrentWeekVolume             float64 `json:"CURRENT_WEEK_VOLUME"`
-			CurrentWeekQuoteVolume        float64 `json:"CURRENT_WEEK_QUOTE_VOLUME"`
-			CurrentWeekOpen               float64 `json:"CURRENT_WEEK_OPEN"`
-			CurrentWeekHigh               float64 `json:"CURRENT_WEEK_HIGH"`
-			CurrentWeekLow                float64 `json:"CURRENT_WEEK_LOW"`
-			CurrentWeekTotalIndexUpdates  int     `json:"CURRENT_WEEK_TOTAL_INDEX_UPDATES"`
-			CurrentWeekChange             float64 `json:"CURRENT_WEEK_CHANGE"`
-			CurrentWeekChangePercentage   float64 `json:"CURRENT_WEEK_CHANGE_PERCENTAGE"`
-			CurrentMonthVolume            float64 `json:"CURRENT_MONTH_VOLUME"`
-			CurrentMonthQuoteVolume       float64 `json:"CURRENT_MONTH_QUOTE_VOLUME"`
-			CurrentMonthOpen              float64 `json:"CURRENT_MONTH_OPEN"`
-			CurrentMonthHigh              float64 `json:"CURRENT_MONTH_HIGH"`
-			CurrentMonthLow               float64 `json:"CURRENT_MONTH_LOW"`
-			CurrentMonthTotalIndexUpdates int     `json:"CURRENT_MONTH_TOTAL_INDEX_UPDATES"`
-			CurrentMonthChange            float64 `json:"CURRENT_MONTH_CHANGE"`
-			CurrentMonthChangePercentage  float64 `json:"CURRENT_MONTH_CHANGE_PERCENTAGE"`
-			CurrentYearVolume             float64 `json:"CURRENT_YEAR_VOLUME"`
-			CurrentYearQuoteVolume        float64 `json:"CURRENT_YEAR_QUOTE_VOLUME"`
-			CurrentYearOpen               float64 `json:"CURRENT_YEAR_OPEN"`
-			CurrentYearHigh               float64 `json:"CURRENT_YEAR_HIGH"`
-			CurrentYearLow                float64 `json:"CURRENT_YEAR_LOW"`
-			CurrentYearTotalIndexUpdates  int     `json:"CURRENT_YEAR_TOTAL_INDEX_UPDATES"`
-			CurrentYearChange             float64 `json:"CURRENT_YEAR_CHANGE"`
-			CurrentYearChangePercentage   float64 `json:"CURRENT_YEAR_CHANGE_PERCENTAGE"`
-			Moving24HourVolume            float64 `json:"MOVING_24_HOUR_VOLUME"`
-			Moving24HourQuoteVolume       float64 `json:"MOVING_24_HOUR_QUOTE_VOLUME"`
-			Moving24HourOpen              float64 `json:"MOVING_24_HOUR_OPEN"`
-			Moving24HourHigh              float64 `json:"MOVING_24_HOUR_HIGH"`
-			Moving24HourLow               float64 `json:"MOVING_24_HOUR_LOW"`
-			Moving24HourTotalIndexUpdates int     `json:"MOVING_24_HOUR_TOTAL_INDEX_UPDATES"`
-			Moving24HourChange            float64 `json:"MOVING_24_HOUR_CHANGE"`
-			Moving24HourChangePercentage  float64 `json:"MOVING_24_HOUR_CHANGE_PERCENTAGE"`
-			Moving7DayVolume              float64 `json:"MOVING_7_DAY_VOLUME"`
-			Moving7DayQuoteVolume         float64 `json:"MOVING_7_DAY_QUOTE_VOLUME"`
-			Moving7DayOpen                float64 `json:"MOVING_7_DAY_OPEN"`
-			Moving7DayHigh                float64 `json:"MOVING_7_DAY_HIGH"`
-			Moving7DayLow                 float64 `json:"MOVING_7_DAY_LOW"`
-			Moving7DayTotalIndexUpdates   int     `json:"MOVING_7_DAY_TOTAL_INDEX_UPDATES"`
-			Moving7DayChange              float64 `json:"MOVING_7_DAY_CHANGE"`
-			Moving7DayChangePercentage    float64 `json:"MOVING_7_DAY_CHANGE_PERCENTAGE"`
-			Moving30DayVolume             float64 `json:"MOVING_30_DAY_VOLUME"`
-			Moving30DayQuoteVolume        float64 `json:"MOVING_30_DAY_QUOTE_VOLUME"`
-			Moving30DayOpen               float64 `json:"MOVING_30_DAY_OPEN"`
-			Moving30DayHigh               float64 `json:"MOVING_30_DAY_HIGH"`
-			Moving30DayLow                float64 `json:"MOVING_30_DAY_LOW"`
-			Moving30DayTotalIndexUpdates  int     `json:"MOVING_30_DAY_TOTAL_INDEX_UPDATES"`
-			Moving30DayChange             float64 `json:"MOVING_30_DAY_CHANGE"`
-			Moving30DayChangePercentage   float64 `json:"MOVING_30_DAY_CHANGE_PERCENTAGE"`
-			Moving90DayVolume             float64 `json:"MOVING_90_DAY_VOLUME"`
-			Moving90DayQuoteVolume        float64 `json:"MOVING_90_DAY_QUOTE_VOLUME"`
-			Moving90DayOpen               float64 `json:"MOVING_90_DAY_OPEN"`
-			Moving90DayHigh               float64 `json:"MOVING_90_DAY_HIGH"`
-			Moving90DayLow                float64 `json:"MOVING_90_DAY_LOW"`
-			Moving90DayTotalIndexUpdates  int     `json:"MOVING_90_DAY_TOTAL_INDEX_UPDATES"`
-			Moving90DayChange             float64 `json:"MOVING_90_DAY_CHANGE"`
-			Moving90DayChangePercentage   float64 `json:"MOVING_90_DAY_CHANGE_PERCENTAGE"`
-			Moving180DayVolume            float64 `json:"MOVING_180_DAY_VOLUME"`
-			Moving180DayQuoteVolume       float64 `json:"MOVING_180_DAY_QUOTE_VOLUME"`
-			Moving180DayOpen              float64 `json:"MOVING_180_DAY_OPEN"`
-			Moving180DayHigh              float64 `json:"MOVING_180_DAY_HIGH"`
-			Moving180DayLow               float64 `json:"MOVING_180_DAY_LOW"`
-			Moving180DayTotalIndexUpdates int     `json:"MOVING_180_DAY_TOTAL_INDEX_UPDATES"`
-			Moving180DayChange            float64 `json:"MOVING_180_DAY_CHANGE"`
-			Moving180DayChangePercentage  float64 `json:"MOVING_180_DAY_CHANGE_PERCENTAGE"`
-			Moving365DayVolume            float64 `json:"MOVING_365_DAY_VOLUME"`
-			Moving365DayQuoteVolume       float64 `json:"MOVING_365_DAY_QUOTE_VOLUME"`
-			Moving365DayOpen              float64 `json:"MOVING_365_DAY_OPEN"`
-			Moving365DayHigh              float64 `json:"MOVING_365_DAY_HIGH"`
-			Moving365DayLow               float64 `json:"MOVING_365_DAY_LOW"`
-			Moving365DayTotalIndexUpdates int     `json:"MOVING_365_DAY_TOTAL_INDEX_UPDATES"`
-			Moving365DayChange            float64 `json:"MOVING_365_DAY_CHANGE"`
-			Moving365DayChangePercentage  float64 `json:"MOVING_365_DAY_CHANGE_PERCENTAGE"`
-			LifetimeFirstUpdateTs         int     `json:"LIFETIME_FIRST_UPDATE_TS"`
-			LifetimeVolume                float64 `json:"LIFETIME_VOLUME"`
-			LifetimeQuoteVolume           float64 `json:"LIFETIME_QUOTE_VOLUME"`
-			LifetimeOpen                  float64 `json:"LIFETIME_OPEN"`
-			LifetimeHigh                  float64 `json:"LIFETIME_HIGH"`
-			LifetimeHighTs                int     `json:"LIFETIME_HIGH_TS"`
-			LifetimeLow                   float64 `json:"LIFETIME_LOW"`
-			LifetimeLowTs                 int     `json:"LIFETIME_LOW_TS"`
-			LifetimeTotalIndexUpdates     int     `json:"LIFETIME_TOTAL_INDEX_UPDATES"`
-			LifetimeChange                float64 `json:"LIFETIME_CHANGE"`
-			LifetimeChangePercentage      float64 `json:"LIFETIME_CHANGE_PERCENTAGE"`
-		} `json:"ETH-USD"`
-	} `json:"Data"`
-	Err struct {
-	} `json:"Err"`
+	Data map[string]CryptoCompareTick `json:"Data"`
+	Err  CryptoCompareError           `json:"Err"`
+}
+
+type CryptoCompareTick struct {
+	Type                          string  `json:"TYPE"`
+	Market                        string  `json:"MARKET"`
+	Instrument                    string  `json:"INSTRUMENT"`
+	Ccseq                         int     `json:"CCSEQ"`
+	Value                         float64 `json:"VALUE"`
+	ValueFlag                     string  `json:"VALUE_FLAG"`
+	ValueLastUpdateTs             int     `json:"VALUE_LAST_UPDATE_TS"`
+	ValueLastUpdateNs             int     `json:"VALUE_LAST_UPDATE_NS"`
+	LastUpdateQuantity            float64 `json:"LAST_UPDATE_QUANTITY"`
+	LastUpdateQuoteQuantity       float64 `json:"LAST_UPDATE_QUOTE_QUANTITY"`
+	LastUpdateCcseq               int     `json:"LAST_UPDATE_CCSEQ"`
+	CurrentHourVolume             float64 `json:"CURRENT_HOUR_VOLUME"`
+	CurrentHourQuoteVolume        float64 `json:"CURRENT_HOUR_QUOTE_VOLUME"`
+	CurrentHourOpen               float64 `json:"CURRENT_HOUR_OPEN"`
+	CurrentHourHigh               float64 `json:"CURRENT_HOUR_HIGH"`
+	CurrentHourLow                float64 `json:"CURRENT_HOUR_LOW"`
+	CurrentHourTotalIndexUpdates  int     `json:"CURRENT_HOUR_TOTAL_INDEX_UPDATES"`
+	CurrentHourChange             float64 `json:"CURRENT_HOUR_CHANGE"`
+	CurrentHourChangePercentage   float64 `json:"CURRENT_HOUR_CHANGE_PERCENTAGE"`
+	CurrentDayVolume              float64 `json:"CURRENT_DAY_VOLUME"`
+	CurrentDayQuoteVolume         float64 `json:"CURRENT_DAY_QUOTE_VOLUME"`
+	CurrentDayOpen                float64 `json:"CURRENT_DAY_OPEN"`
+	CurrentDayHigh                float64 `json:"CURRENT_DAY_HIGH"`
+	CurrentDayLow                 float64 `json:"CURRENT_DAY_LOW"`
+	CurrentDayTotalIndexUpdates   int     `json:"CURRENT_DAY_TOTAL_INDEX_UPDATES"`
+	CurrentDayChange              float64 `json:"CURRENT_DAY_CHANGE"`
+	CurrentDayChangePercentage    float64 `json:"CURRENT_DAY_CHANGE_PERCENTAGE"`
+	CurrentWeekVolume             float64 `json:"CURRENT_WEEK_VOLUME"`
+	CurrentWeekQuoteVolume        float64 `json:"CURRENT_WEEK_QUOTE_VOLUME"`
+	CurrentWeekOpen               float64 `json:"CURRENT_WEEK_OPEN"`
+	CurrentWeekHigh               float64 `json:"CURRENT_WEEK_HIGH"`
+	CurrentWeekLow                float64 `json:"CURRENT_WEEK_LOW"`
+	CurrentWeekTotalIndexUpdates  int     `json:"CURRENT_WEEK_TOTAL_INDEX_UPDATES"`
+	CurrentWeekChange             float64 `json:"CURRENT_WEEK_CHANGE"`
+	CurrentWeekChangePercentage   float64 `json:"CURRENT_WEEK_CHANGE_PERCENTAGE"`
+	CurrentMonthVolume            float64 `json:"CURRENT_MONTH_VOLUME"`
+	CurrentMonthQuoteVolume       float64 `json:"CURRENT_MONTH_QUOTE_VOLUME"`
+	CurrentMonthOpen              float64 `json:"CURRENT_MONTH_OPEN"`
+	CurrentMonthHigh              float64 `json:"CURRENT_MONTH_HIGH"`
+	CurrentMonthLow               float64 `json:"CURRENT_MONTH_LOW"`
+	CurrentMonthTotalIndexUpdates int     `json:"CURRENT_MONTH_TOTAL_INDEX_UPDATES"`
+	CurrentMonthChange            float64 `json:"CURRENT_MONTH_CHANGE"`
+	CurrentMonthChangePercentage  float64 `json:"CURRENT_MONTH_CHANGE_PERCENTAGE"`
+	CurrentYearVolume             float64 `json:"CURRENT_YEAR_VOLUME"`
+	CurrentYearQuoteVolume        float64 `json:"CURRENT_YEAR_QUOTE_VOLUME"`
+	CurrentYearOpen               float64 `json:"CURRENT_YEAR_OPEN"`
+	CurrentYearHigh               float64 `json:"CURRENT_YEAR_HIGH"`
+	CurrentYearLow                float64 `json:"CURRENT_YEAR_LOW"`
+	CurrentYearTotalIndexUpdates  int     `json:"CURRENT_YEAR_TOTAL_INDEX_UPDATES"`
+	CurrentYearChange             float64 `json:"CURRENT_YEAR_CHANGE"`
+	CurrentYearChangePercentage   float64 `json:"CURRENT_YEAR_CHANGE_PERCENTAGE"`
+	Moving24HourVolume            float64 `json:"MOVING_24_HOUR_VOLUME"`
+	Moving24HourQuoteVolume       float64 `json:"MOVING_24_HOUR_QUOTE_VOLUME"`
+	Moving24HourOpen              float64 `json:"MOVING_24_HOUR_OPEN"`
+	Moving24HourHigh              float64 `json:"MOVING_24_HOUR_HIGH"`
+	Moving24HourLow               float64 `json:"MOVING_24_HOUR_LOW"`
+	Moving24HourTotalIndexUpdates int     `json:"MOVING_24_HOUR_TOTAL_INDEX_UPDATES"`
+	Moving24HourChange            float64 `json:"MOVING_24_HOUR_CHANGE"`
+	Moving24HourChangePercentage  float64 `json:"MOVING_24_HOUR_CHANGE_PERCENTAGE"`
+	Moving7DayVolume              float64 `json:"MOVING_7_DAY_VOLUME"`
+	Moving7DayQuoteVolume         float64 `json:"MOVING_7_DAY_QUOTE_VOLUME"`
+	Moving7DayOpen                float64 `json:"MOVING_7_DAY_OPEN"`
+	Moving7DayHigh                float64 `json:"MOVING_7_DAY_HIGH"`
+	Moving7DayLow                 float64 `json:"MOVING_7_DAY_LOW"`
+	Moving7DayTotalIndexUpdates   int     `json:"MOVING_7_DAY_TOTAL_INDEX_UPDATES"`
+	Moving7DayChange              float64 `json:"MOVING_7_DAY_CHANGE"`
+	Moving7DayChangePercentage    float64 `json:"MOVING_7_DAY_CHANGE_PERCENTAGE"`
+	Moving30DayVolume             float64 `json:"MOVING_30_DAY_VOLUME"`
+	Moving30DayQuoteVolume        float64 `json:"MOVING_30_DAY_QUOTE_VOLUME"`
+	Moving30DayOpen               float64 `json:"MOVING_30_DAY_OPEN"`
+	Moving30DayHigh               float64 `json:"MOVING_30_DAY_HIGH"`
+	Moving30DayLow                float64 `json:"MOVING_30_DAY_LOW"`
+	Moving30DayTotalIndexUpdates  int     `json:"MOVING_30_DAY_TOTAL_INDEX_UPDATES"`
+	Moving30DayChange             float64 `json:"MOVING_30_DAY_CHANGE"`
+	Moving30DayChangePercentage   float64 `json:"MOVING_30_DAY_CHANGE_PERCENTAGE"`
+	Moving90DayVolume             float64 `json:"MOVING_90_DAY_VOLUME"`
+	Moving90DayQuoteVolume        float64 `json:"MOVING_90_DAY_QUOTE_VOLUME"`
+	Moving90DayOpen               float64 `json:"MOVING_90_DAY_OPEN"`
+	Moving90DayHigh               float64 `json:"MOVING_90_DAY_HIGH"`
+	Moving90DayLow                float64 `json:"MOVING_90_DAY_LOW"`
+	Moving90DayTotalIndexUpdates  int     `json:"MOVING_90_DAY_TOTAL_INDEX_UPDATES"`
+	Moving90DayChange             float64 `json:"MOVING_90_DAY_CHANGE"`
+	Moving90DayChangePercentage   float64 `json:"MOVING_90_DAY_CHANGE_PERCENTAGE"`
+	Moving180DayVolume            float64 `json:"MOVING_180_DAY_VOLUME"`
+	Moving180DayQuoteVolume       float64 `json:"MOVING_180_DAY_QUOTE_VOLUME"`
+	Moving180DayOpen              float64 `json:"MOVING_180_DAY_OPEN"`
+	Moving180DayHigh              float64 `json:"MOVING_180_DAY_HIGH"`
+	Moving180DayLow               float64 `json:"MOVING_180_DAY_LOW"`
+	Moving180DayTotalIndexUpdates int     `json:"MOVING_180_DAY_TOTAL_INDEX_UPDATES"`
+	Moving180DayChange            float64 `json:"MOVING_180_DAY_CHANGE"`
+	Moving180DayChangePercentage  float64 `json:"MOVING_180_DAY_CHANGE_PERCENTAGE"`
+	Moving365DayVolume            float64 `json:"MOVING_365_DAY_VOLUME"`
+	Moving365DayQuoteVolume       float64 `json:"MOVING_365_DAY_QUOTE_VOLUME"`
+	Moving365DayOpen              float64 `json:"MOVING_365_DAY_OPEN"`
+	Moving365DayHigh              float64 `json:"MOVING_365_DAY_HIGH"`
+	Moving365DayLow               float64 `json:"MOVING_365_DAY_LOW"`
+	Moving365DayTotalIndexUpdates int     `json:"MOVING_365_DAY_TOTAL_INDEX_UPDATES"`
+	Moving365DayChange            float64 `json:"MOVING_365_DAY_CHANGE"`
+	Moving365DayChangePercentage  float64 `json:"MOVING_365_DAY_CHANGE_PERCENTAGE"`
+	LifetimeFirstUpdateTs         int     `json:"LIFETIME_FIRST_UPDATE_TS"`
+	LifetimeVolume                float64 `json:"LIFETIME_VOLUME"`
+	LifetimeQuoteVolume           float64 `json:"LIFETIME_QUOTE_VOLUME"`
+	LifetimeOpen                  float64 `json:"LIFETIME_OPEN"`
+	LifetimeHigh                  float64 `json:"LIFETIME_HIGH"`
+	LifetimeHighTs                int     `json:"LIFETIME_HIGH_TS"`
+	LifetimeLow                   float64 `json:"LIFETIME_LOW"`
+	LifetimeLowTs                 int     `json:"LIFETIME_LOW_TS"`
+	LifetimeTotalIndexUpdates     int     `json:"LIFETIME_TOTAL_INDEX_UPDATES"`
+	LifetimeChange                float64 `json:"LIFETIME_CHANGE"`
+	LifetimeChangePercentage      float64 `json:"LIFETIME_CHANGE_PERCENTAGE"`
+}
+
+// CryptoCompareHistoricalResponse is the response of the minutes, hours and days historical endpoints
+type CryptoCompareHistoricalResponse struct {
+	Data []CryptoCompareCandle `json:"Data"`
+	Err  CryptoCompareError    `json:"Err"`
+}
+
+type CryptoCompareCandle struct {
+	Unit              string  `json:"UNIT"`
+	Timestamp         int64   `json:"TIMESTAMP"`
+	Type              string  `json:"TYPE"`
+	Market            string  `json:"MARKET"`
+	Instrument        string  `json:"INSTRUMENT"`
+	Open              float64 `json:"OPEN"`
+	High              float64 `json:"HIGH"`
+	Low               float64 `json:"LOW"`
+	Close             float64 `json:"CLOSE"`
+	FirstMessageTs    int64   `json:"FIRST_MESSAGE_TIMESTAMP"`
+	LastMessageTs     int64   `json:"LAST_MESSAGE_TIMESTAMP"`
+	Volume            float64 `json:"VOLUME"`
+	QuoteVolume       float64 `json:"QUOTE_VOLUME"`
+	TotalIndexUpdates int     `json:"TOTAL_INDEX_UPDATES"`
+}
+
+func (e CryptoCompareError) Empty() bool {
+	return e.Type == 0 && e.Message == ""
+}
+
+func (e CryptoCompareError) Error() string {
+	return fmt.Sprintf("cryptocompare error type=%d: %s", e.Type, e.Message)
+}
+
+// Duration returns the length of a single candle for the resolution
+func (r CryptoCompareResolution) Duration() time.Duration {
+	switch r {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	case Day:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// ResolutionFor returns the finest resolution cryptocompare still retains for a given time
+func ResolutionFor(received time.Time) CryptoCompareResolution {
+	if time.Since(received) <= CryptoCompareMinuteRetention {
+		return Minute
+	}
+	return Hour
+}
+
+// FallbackExchange tries each source in order and cross-checks the first price
+// against the next source that answers
+type FallbackExchange struct {
+	*Logger
+	Sources []Exchange
+	// max relative difference between two sources before the price is flagged (e.g. 0.02 = 2%), 0 skips the cross-check
+	Threshold float64
+}
+
+func NewFallbackExchange(logger *Logger, threshold float64, sources ...Exchange) (Exchange, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("at least one exchange source is required")
+	}
+
+	if threshold < 0 {
+		return nil, fmt.Errorf("invalid divergence threshold: %f", threshold)
+	}
+
+	return FallbackExchange{
+		Logger:    logger,
+		Sources:   sources,
+		Threshold: threshold,
+	}, nil
+}
+
+func (f FallbackExchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	return f.resolve(func(e Exchange) (ExchangePrice, error) {
+		return e.CurrentPrice(coin, currency)
+	})
+}
+
+func (f FallbackExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	return f.resolve(func(e Exchange) (ExchangePrice, error) {
+		return e.HistoricalPrice(coin, currency, received)
+	})
+}
+
+// HistoricalRange returns the range from the first source that supports bulk requests
+func (f FallbackExchange) HistoricalRange(coin ChainType, currency Currency, from, to time.Time) ([]ExchangePrice, time.Duration, error) {
+	var errs []string
+
+	for _, source := range f.Sources {
+		ranged, ok := source.(RangeExchange)
+
+		if !ok {
+			continue
+		}
+
+		prices, step, err := ranged.HistoricalRange(coin, currency, from, to)
+
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		return prices, step, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, 0, errors.New("no exchange source supports range requests")
+	}
+
+	return nil, 0, fmt.Errorf("all exchange sources failed: %s", strings.Join(errs, "; "))
+}
+
+func (f FallbackExchange) resolve(fetch func(e Exchange) (ExchangePrice, error)) (ExchangePrice, error) {
+	var primary ExchangePrice
+	var errs []string
+
+	found := false
+
+	for _, source := range f.Sources {
+		price, err := fetch(source)
+
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		if !found {
+			primary = price
+			found = true
+
+			if len(errs) > 0 {
+				f.warnf("priced with source=%s after failures: %s", price.Source, strings.Join(errs, "; "))
+			}
+
+			if f.Threshold == 0 {
+				break
+			}
+			continue
+		}
+
+		if Divergence(primary.Value, price.Value) > f.Threshold {
+			f.warnf("price divergence source=%s price=%f source=%s price=%f threshold=%f", primary.Source, primary.Value, price.Source, price.Value, f.Threshold)
+		}
+		break
+	}
+
+	if !found {
+		return primary, fmt.Errorf("all exchange sources failed: %s", strings.Join(errs, "; "))
+	}
+
+	return primary, nil
+}
+
+func (f FallbackExchange) warnf(template string, args ...interface{}) {
+	if f.Logger == nil {
+		return
+	}
+	f.Logger.Sugar().Warnf(template, args...)
+}
+
+// Divergence returns the relative difference between two prices
+func Divergence(a, b float64) float64 {
+	if a == 0 {
+		if b == 0 {
+			return 0
+		}
+		return 1
+	}
+	return math.Abs(a-b) / math.Abs(a)
+}
+
+// NewPriceExchange returns the default price source chain: cryptocompare (when an api key is set),
+// coingecko, coinbase and finally the uniswap twap when connected to mainnet
+func NewPriceExchange(logger *Logger, config Config, eths *EthereumService) (Exchange, error) {
+	var sources []Exchange
+
+	if config.CryptoCompareApiKey != "" {
+		cc, err := NewCryptoCompareExchange(config.CryptoCompareApiKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, cc)
+	}
+
+	gecko, err := NewCoinGeckoExchange(config.CoinGeckoApiKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	coinbase, err := NewCoinbaseExchange()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sources = append(sources, gecko, coinbase)
+
+	if eths != nil && eths.Network == EthereumMainnet {
+		uni, err := NewUniswapV3Exchange(eths.Client, eths.Times)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, uni)
+	}
+
+	return NewFallbackExchange(logger, DefaultPriceDivergence, sources...)
 }
 
 func NewHttpClientWithTimeout(time time.Duration) (*http.Client, error) {
@@ -163,6 +414,9 @@ func NewHttpClientWithTimeout(time time.Duration) (*http.Client, error) {
 	return client, nil
 }
 
+// ExchangeHttpClient is shared by all exchanges so connections are reused between price requests
+var ExchangeHttpClient = &http.Client{Timeout: 5 * time.Second}
+
 func NewCryptoCompareExchange(apiKey string) (Exchange, error) {
 	if apiKey == "" {
 		return nil, errors.New("api key is required")
@@ -178,9 +432,10 @@ func (c CryptoCompareExchange) CurrentPrice(coin ChainType, currency Currency) (
 		Coin:     coin.Short(),
 		Currency: currency.String(),
 		Time:     time.Now(),
+		Source:   CryptoCompareSource,
 	}
 
-	httpClient, err := NewHttpClientWithTimeout(time.Duration(2 * time.Second))
+	instrument, err := Instrument(coin, currency)
 
 	if err != nil {
 		return price, err
@@ -188,84 +443,260 @@ func (c CryptoCompareExchange) CurrentPrice(coin ChainType, currency Currency) (
 
 	path := "index/cc/v1/latest/tick"
 
-	url := fmt.Sprintf("%s/%s?market=ccix&instruments=%s-%s", c.BaseUrl, path, coin.Short(), currency.String())
+	url := fmt.Sprintf("%s/%s?market=ccix&instruments=%s", c.BaseUrl, path, instrument)
 
-	req, err := httpClient.Get(url)
+	var response CryptoCompareTickerResponse
+
+	err = c.get(url, &response)
 
 	if err != nil {
 		return price, err
 	}
 
-	defer req.Body.Close()
+	if !response.Err.Empty() {
+		return price, response.Err
+	}
 
-	res, err := io.ReadAll(req.Body)
+	tick, ok := response.Data[instrument]
 
-	if err != nil {
-		return price, err
+	if !ok {
+		return price, fmt.Errorf("no tick returned for instrument=%s", instrument)
 	}
 
-	var response CryptoCompareTickerResponse
+	price.Value = tick.Value
 
-	err = json.Unmarshal(res, &response)
-
-	if err != nil {
-		return price, err
+	if tick.ValueLastUpdateTs != 0 {
+		price.Time = time.Unix(int64(tick.ValueLastUpdateTs), 0).UTC()
 	}
 
-	price.Value = response.Data.ETHUSD.CurrentDayOpen
 	return price, nil
 }
 
 func (c CryptoCompareExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	return c.HistoricalPriceAt(coin, currency, received, ResolutionFor(received))
+}
+
+// HistoricalPriceAt returns the open of the candle containing received at the given resolution
+func (c CryptoCompareExchange) HistoricalPriceAt(coin ChainType, currency Currency, received time.Time, resolution CryptoCompareResolution) (ExchangePrice, error) {
 	price := ExchangePrice{
 		Coin:     coin.Short(),
 		Currency: currency.String(),
 		Time:     received,
+		Source:   CryptoCompareSource,
 	}
 
-	httpClient, err := NewHttpClientWithTimeout(time.Duration(2 * time.Second))
+	instrument, err := Instrument(coin, currency)
 
 	if err != nil {
 		return price, err
 	}
 
-	path := "index/cc/v1/historical/minutes"
+	if resolution.Duration() == 0 {
+		return price, fmt.Errorf("unsupported resolution: %s", resolution)
+	}
 
-	limit := 20
+	path := fmt.Sprintf("index/cc/v1/historical/%s", resolution)
 
-	fmt.Println(received)
-	// conver the time.Time to unix timestamp
 	unixTime := received.UTC().Unix()
 
-	url := fmt.Sprintf("%s/%s?market=ccix&instrument=%s-%s&limit=%d&to_ts=%d", c.BaseUrl, path, coin.Short(), currency.String(), limit, unixTime)
+	url := fmt.Sprintf("%s/%s?market=ccix&instrument=%s&limit=%d&to_ts=%d", c.BaseUrl, path, instrument, CryptoCompareHistoricalLimit, unixTime)
 
-	fmt.Println(unixTime)
-	fmt.Println(url)
+	var response CryptoCompareHistoricalResponse
 
-	req, err := httpClient.Get(url)
+	err = c.get(url, &response)
 
 	if err != nil {
 		return price, err
 	}
 
-	defer req.Body.Close()
+	if !response.Err.Empty() {
+		return price, response.Err
+	}
 
-	res, err := io.ReadAll(req.Body)
+	candle, err := CandleAt(response.Data, received, resolution)
 
 	if err != nil {
 		return price, err
 	}
 
-	var response CryptoCompareTickerResponse
+	price.Value = candle.Open
+	price.Time = time.Unix(candle.Timestamp, 0).UTC()
+	return price, nil
+}
 
-	err = json.Unmarshal(res, &response)
+// HistoricalRange returns every candle overlapping from and to at the finest resolution still retained for from
+func (c CryptoCompareExchange) HistoricalRange(coin ChainType, currency Currency, from, to time.Time) ([]ExchangePrice, time.Duration, error) {
+	instrument, err := Instrument(coin, currency)
 
 	if err != nil {
-		return price, err
+		return nil, 0, err
 	}
 
-	price.Value = response.Data.ETHUSD.CurrentDayOpen
-	return price, nil
+	resolution := ResolutionFor(from)
+	step := resolution.Duration()
+
+	start := from.UTC().Unix() - int64(step.Seconds()) + 1
+	end := to.UTC().Unix()
+
+	var prices []ExchangePrice
+
+	for end >= start {
+		url := fmt.Sprintf("%s/index/cc/v1/historical/%s?market=ccix&instrument=%s&limit=%d&to_ts=%d", c.BaseUrl, resolution, instrument, CryptoCompareRangeLimit, end)
+
+		var response CryptoCompareHistoricalResponse
+
+		err = c.get(url, &response)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if !response.Err.Empty() {
+			return nil, 0, response.Err
+		}
+
+		earliest := end
+
+		for _, candle := range response.Data {
+			if candle.Timestamp < earliest {
+				earliest = candle.Timestamp
+			}
+
+			if candle.Timestamp < start || candle.Timestamp > end {
+				continue
+			}
+
+			prices = append(prices, ExchangePrice{
+				Value:    candle.Open,
+				Coin:     coin.Short(),
+				Currency: currency.String(),
+				Time:     time.Unix(candle.Timestamp, 0).UTC(),
+				Source:   CryptoCompareSource,
+			})
+		}
+
+		if len(response.Data) == 0 || earliest >= end {
+			break
+		}
+
+		end = earliest - 1
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Time.Before(prices[j].Time)
+	})
+
+	return prices, step, nil
+}
+
+// CandleAt returns the candle whose window contains t
+func CandleAt(candles []CryptoCompareCandle, t time.Time, resolution CryptoCompareResolution) (CryptoCompareCandle, error) {
+	unix := t.UTC().Unix()
+	window := int64(resolution.Duration().Seconds())
+
+	sorted := make([]CryptoCompareCandle, len(candles))
+	copy(sorted, candles)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].Timestamp > unix {
+			continue
+		}
+
+		if unix-sorted[i].Timestamp >= window {
+			break
+		}
+
+		return sorted[i], nil
+	}
+
+	return CryptoCompareCandle{}, fmt.Errorf("no %s candle found for time=%d", resolution, unix)
+}
+
+func (c CryptoCompareExchange) get(url string, v interface{}) error {
+	header := http.Header{}
+
+	if c.ApiKey != "" {
+		header.Set("Authorization", fmt.Sprintf("Apikey %s", c.ApiKey))
+	}
+
+	err := FetchJSON(url, header, v)
+
+	var status *StatusError
+
+	if errors.As(err, &status) {
+		var failed struct {
+			Err CryptoCompareError `json:"Err"`
+		}
+
+		if json.Unmarshal(status.Body, &failed) == nil && !failed.Err.Empty() {
+			return fmt.Errorf("unexpected status code=%d: %w", status.StatusCode, failed.Err)
+		}
+	}
+
+	return err
+}
+
+// StatusError is a non 2xx response, the body is kept for sources that decode their error payload
+type StatusError struct {
+	StatusCode int
+	Host       string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code=%d from %s", e.StatusCode, e.Host)
+}
+
+// FetchJSON sends a GET request and decodes a 2xx JSON response into v, other responses are a *StatusError
+func FetchJSON(url string, header http.Header, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for k, values := range header {
+		for _, value := range values {
+			req.Header.Add(k, value)
+		}
+	}
+
+	resp, err := ExchangeHttpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, Host: req.URL.Host, Body: res}
+	}
+
+	return json.Unmarshal(res, v)
+}
+
+// Instrument returns the exchange instrument for a coin and currency pair (e.g. ETH-USD)
+func Instrument(coin ChainType, currency Currency) (string, error) {
+	if coin.Short() == "" {
+		return "", fmt.Errorf("unsupported coin: %s", coin)
+	}
+
+	if currency == "" {
+		return "", errors.New("currency is required")
+	}
+
+	return fmt.Sprintf("%s-%s", coin.Short(), currency), nil
 }
 
 func (c ChainType) Short() string {
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCryptoCompareExchange_CurrentPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("instruments") != "ETH-EUR" {
+			t.Errorf("unexpected instruments: %s", r.URL.Query().Get("instruments"))
+		}
+
+		if r.Header.Get("Authorization") != "Apikey secret" {
+			t.Errorf("missing api key header")
+		}
+
+		w.Write([]byte(`{"Data":{"ETH-EUR":{"VALUE":1712.5,"CURRENT_DAY_OPEN":1600,"VALUE_LAST_UPDATE_TS":1690000000}},"Err":{}}`))
+	}))
+
+	defer server.Close()
+
+	exchange := CryptoCompareExchange{BaseUrl: server.URL, ApiKey: "secret"}
+
+	price, err := exchange.CurrentPrice(Ethereum, Currency("EUR"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Value != 1712.5 {
+		t.Errorf("expected: %f, got: %f", 1712.5, price.Value)
+	}
+
+	if price.Time.Unix() != 1690000000 {
+		t.Errorf("expected: %d, got: %d", 1690000000, price.Time.Unix())
+	}
+}
+
+func TestCryptoCompareExchange_HistoricalPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index/cc/v1/historical/hours" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		w.Write([]byte(`{"Data":[
+			{"UNIT":"HOUR","TIMESTAMP":1689994800,"OPEN":1800,"CLOSE":1810},
+			{"UNIT":"HOUR","TIMESTAMP":1689998400,"OPEN":1810,"CLOSE":1820},
+			{"UNIT":"HOUR","TIMESTAMP":1690002000,"OPEN":1820,"CLOSE":1830}
+		],"Err":{}}`))
+	}))
+
+	defer server.Close()
+
+	exchange := CryptoCompareExchange{BaseUrl: server.URL, ApiKey: "secret"}
+
+	received := time.Unix(1690000000, 0)
+
+	price, err := exchange.HistoricalPriceAt(Ethereum, USD, received, Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Value != 1810 {
+		t.Errorf("expected: %f, got: %f", 1810.0, price.Value)
+	}
+
+	_, err = exchange.HistoricalPriceAt(Ethereum, USD, time.Unix(1690010000, 0), Hour)
+
+	if err == nil {
+		t.Error("expected error for time outside of the returned window")
+	}
+}
+
+func TestCryptoCompareExchange_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("instrument") == "ETH-XXX" {
+			w.Write([]byte(`{"Data":[],"Err":{"type":2,"message":"instrument not found"}}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"Err":{"type":1,"message":"invalid api key"}}`))
+	}))
+
+	defer server.Close()
+
+	exchange := CryptoCompareExchange{BaseUrl: server.URL, ApiKey: "secret"}
+
+	_, err := exchange.CurrentPrice(Ethereum, USD)
+
+	if err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+
+	_, err = exchange.HistoricalPriceAt(Ethereum, Currency("XXX"), time.Now(), Minute)
+
+	if err == nil {
+		t.Error("expected error for api error")
+	}
+
+	_, err = exchange.CurrentPrice(ChainType("iotex"), USD)
+
+	if err == nil {
+		t.Error("expected error for unsupported coin")
+	}
+}
+
+type staticExchange struct {
+	price ExchangePrice
+	err   error
+}
+
+func (s staticExchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	return s.price, s.err
+}
+
+func (s staticExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	return s.price, s.err
+}
+
+func TestFallbackExchange(t *testing.T) {
+	down := staticExchange{err: errors.New("vendor outage")}
+	gecko := staticExchange{price: ExchangePrice{Value: 1800, Source: CoinGeckoSource}}
+	coinbase := staticExchange{price: ExchangePrice{Value: 1801, Source: CoinbaseSource}}
+
+	exchange, err := NewFallbackExchange(nil, 0.01, down, gecko, coinbase)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, err := exchange.HistoricalPrice(Ethereum, USD, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Source != CoinGeckoSource {
+		t.Errorf("expected: %s, got: %s", CoinGeckoSource, price.Source)
+	}
+
+	exchange, err = NewFallbackExchange(nil, 0.01, down, down)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = exchange.CurrentPrice(Ethereum, USD)
+
+	if err == nil {
+		t.Error("expected error when all sources fail")
+	}
+
+	if Divergence(1800, 1900) < 0.05 {
+		t.Errorf("expected divergence above 5%%, got: %f", Divergence(1800, 1900))
+	}
+
+	// the first price is kept and flagged when the next source is more than the threshold away
+	core, logs := observer.New(zap.WarnLevel)
+	outlier := staticExchange{price: ExchangePrice{Value: 1900, Source: CoinbaseSource}}
+
+	for _, second := range []staticExchange{coinbase, outlier} {
+		exchange, err = NewFallbackExchange(&Logger{Logger: zap.New(core)}, 0.01, gecko, second)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		price, err = exchange.CurrentPrice(Ethereum, USD)
+
+		if err != nil || price.Value != 1800 {
+			t.Errorf("expected: %v, got: %v (%v)", 1800, price.Value, err)
+		}
+	}
+
+	if logs.FilterMessageSnippet("price divergence").Len() != 1 {
+		t.Errorf("expected: %d, got: %d", 1, logs.FilterMessageSnippet("price divergence").Len())
+	}
+}
+
+func TestNewCoinGeckoExchange(t *testing.T) {
+	public, _ := NewCoinGeckoExchange("")
+	pro, _ := NewCoinGeckoExchange("key")
+
+	if public.(CoinGeckoExchange).BaseUrl != CoinGeckoPublicUrl || pro.(CoinGeckoExchange).BaseUrl != CoinGeckoProUrl {
+		t.Errorf("expected: %s and %s, got: %s and %s", CoinGeckoPublicUrl, CoinGeckoProUrl, public.(CoinGeckoExchange).BaseUrl, pro.(CoinGeckoExchange).BaseUrl)
+	}
+
+	if pro.(CoinGeckoExchange).header().Get("x-cg-pro-api-key") != "key" {
+		t.Errorf("expected the pro api key header")
+	}
+}
+
+func TestCoinGeckoExchange_HistoricalPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/coins/ethereum/market_chart/range" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		w.Write([]byte(`{"prices":[[1689999700000,1801.5],[1689999990000,1802.5],[1690000200000,1803.5]]}`))
+	}))
+
+	defer server.Close()
+
+	exchange := CoinGeckoExchange{BaseUrl: server.URL}
+
+	price, err := exchange.HistoricalPrice(Ethereum, USD, time.Unix(1690000000, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Value != 1802.5 {
+		t.Errorf("expected: %f, got: %f", 1802.5, price.Value)
+	}
+}
+
+func TestCoinbaseExchange_HistoricalPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products/ETH-USD/candles" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		w.Write([]byte(`[[1689999960,1790,1810,1795,1805,12.5]]`))
+	}))
+
+	defer server.Close()
+
+	exchange := CoinbaseExchange{BaseUrl: server.URL}
+
+	price, err := exchange.HistoricalPrice(Ethereum, USD, time.Unix(1690000000, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Value != 1795 {
+		t.Errorf("expected: %f, got: %f", 1795.0, price.Value)
+	}
+}
+
+func TestTickToPrice(t *testing.T) {
+	// tick of the USDC/WETH pool when 1 ETH is ~2000 USDC
+	price := TickToPrice(200311, 6, 18, true)
+
+	if math.Abs(price-2000) > 1 {
+		t.Errorf("expected: ~2000, got: %f", price)
+	}
+
+	tick := AverageTick(big.NewInt(-1000), big.NewInt(-1601), 600)
+
+	if tick != -2 {
+		t.Errorf("expected: %d, got: %d", -2, tick)
+	}
+}
+
+// headerChain mines a block every 12 seconds from time 1000 and counts header reads
+type headerChain struct {
+	head  uint64
+	reads int
+}
+
+func (h *headerChain) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (h *headerChain) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (h *headerChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	h.reads++
+
+	height := h.head
+
+	if number != nil {
+		height = number.Uint64()
+	}
+
+	return &types.Header{Number: new(big.Int).SetUint64(height), Time: 1000 + height*12}, nil
+}
+
+func TestBlockAtTime(t *testing.T) {
+	chain := &headerChain{head: 1_000_000}
+	times := NewBlockTimes()
+
+	block, err := BlockAtTime(context.Background(), chain, times, time.Unix(1000+500_000*12+5, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if block.Uint64() != 500_000 {
+		t.Errorf("expected: %d, got: %d", 500_000, block.Uint64())
+	}
+
+	// a block the crawler already read resolves without any rpc
+	times.Remember(700_000, 1000+700_000*12)
+	reads := chain.reads
+
+	block, err = BlockAtTime(context.Background(), chain, times, time.Unix(1000+700_000*12, 0))
+
+	if err != nil || block.Uint64() != 700_000 || chain.reads != reads {
+		t.Errorf("expected: %d without reads, got: %v after %d reads (%v)", 700_000, block, chain.reads-reads, err)
+	}
+
+	// a time between two known blocks only searches between them
+	times.Remember(700_010, 1000+700_010*12)
+	reads = chain.reads
+
+	block, err = BlockAtTime(context.Background(), chain, times, time.Unix(1000+700_004*12+1, 0))
+
+	if err != nil || block.Uint64() != 700_004 || chain.reads-reads > 4 {
+		t.Errorf("expected: %d within 4 reads, got: %v after %d reads (%v)", 700_004, block, chain.reads-reads, err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	WeiPerETHDecimals = 18
+)
+
+// TxFees is the exact fee paid by a transaction in wei, split by where it went
+type TxFees struct {
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	// base fee burnt by EIP-1559 (zero before london)
+	Burnt *big.Int
+	// priority fee paid to the block producer
+	Tip *big.Int
+	// EIP-4844 blob gas fee (burnt)
+	Blob *big.Int
+	// execution and blob fees combined
+	Total *big.Int
+}
+
+// ComputeTxFees splits the fee paid by a transaction using its receipt and the block base fee (nil before london).
+// Receipts without an effective gas price (pre-london or some providers) are priced from the transaction.
+func ComputeTxFees(receipt *Receipt, tx *types.Transaction, baseFee *big.Int) TxFees {
+	gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+
+	price := new(big.Int)
+
+	if receipt.EffectiveGasPrice != nil && receipt.EffectiveGasPrice.Sign() > 0 {
+		price.Set(receipt.EffectiveGasPrice)
+	} else if tx != nil {
+		price.Set(EffectiveGasPrice(tx, baseFee))
+	}
+
+	execution := new(big.Int).Mul(gasUsed, price)
+
+	burnt := new(big.Int)
+
+	if baseFee != nil {
+		burnt.Mul(gasUsed, baseFee)
+	}
+
+	tip := new(big.Int).Sub(execution, burnt)
+
+	blob := new(big.Int)
+
+	if receipt.BlobGasPrice != nil {
+		blob.Mul(new(big.Int).SetUint64(receipt.BlobGasUsed), receipt.BlobGasPrice)
+	}
+
+	return TxFees{
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: price,
+		Burnt:             burnt,
+		Tip:               tip,
+		Blob:              blob,
+		Total:             new(big.Int).Add(execution, blob),
+	}
+}
+
+// EffectiveGasPrice returns the price per gas paid by a transaction, the gas price before london and the base fee
+// plus the capped tip after
+func EffectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+
+	tip, err := tx.EffectiveGasTip(baseFee)
+
+	if err != nil {
+		return tx.GasPrice()
+	}
+
+	return tip.Add(tip, baseFee)
+}
+
+// FormatETH formats an amount of wei as an exact ether decimal (e.g. 1500000000000000 -> 0.0015)
+func FormatETH(wei *big.Int) string {
+	if wei == nil {
+		return ""
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(WeiPerETHDecimals), nil)
+
+	abs := new(big.Int).Abs(wei)
+	whole, frac := new(big.Int).QuoRem(abs, unit, new(big.Int))
+
+	sign := ""
+
+	if wei.Sign() < 0 {
+		sign = "-"
+	}
+
+	if frac.Sign() == 0 {
+		return sign + whole.String()
+	}
+
+	decimals := frac.String()
+	decimals = strings.Repeat("0", WeiPerETHDecimals-len(decimals)) + decimals
+	decimals = strings.TrimRight(decimals, "0")
+
+	return sign + whole.String() + "." + decimals
+}
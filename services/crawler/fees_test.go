@@ -0,0 +1,192 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestComputeTxFees(t *testing.T) {
+	raw := []byte(`{
+		"type":"0x3",
+		"status":"0x1",
+		"cumulativeGasUsed":"0x5208",
+		"logsBloom":"0x` + zeros(512) + `",
+		"logs":[],
+		"transactionHash":"0x` + zeros(64) + `",
+		"gasUsed":"0x5208",
+		"effectiveGasPrice":"0x3b9aca00",
+		"transactionIndex":"0x0",
+		"blobGasUsed":"0x20000",
+		"blobGasPrice":"0x2"
+	}`)
+
+	receipt, err := DecodeReceipt(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 0.9 gwei base fee, 0.1 gwei tip
+	fees := ComputeTxFees(receipt, nil, big.NewInt(900_000_000))
+
+	expected := map[string]string{
+		"total": "21000000262144",
+		"burnt": "18900000000000",
+		"tip":   "2100000000000",
+		"blob":  "262144",
+	}
+
+	got := map[string]string{
+		"total": fees.Total.String(),
+		"burnt": fees.Burnt.String(),
+		"tip":   fees.Tip.String(),
+		"blob":  fees.Blob.String(),
+	}
+
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("%s expected: %s, got: %s", k, v, got[k])
+		}
+	}
+
+	legacy := ComputeTxFees(receipt, nil, nil)
+
+	if legacy.Burnt.Sign() != 0 || legacy.Tip.String() != "21000000000000" {
+		t.Errorf("unexpected pre-london fees: burnt=%s tip=%s", legacy.Burnt, legacy.Tip)
+	}
+
+	// without an effective gas price the transaction prices the gas
+	receipt.EffectiveGasPrice = nil
+
+	tx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(2_000_000_000), Gas: 21000})
+	unpriced := ComputeTxFees(receipt, tx, nil)
+
+	if unpriced.Total.String() != "42000000262144" {
+		t.Errorf("expected: %s, got: %s", "42000000262144", unpriced.Total)
+	}
+
+	dynamic := types.NewTx(&types.DynamicFeeTx{GasFeeCap: big.NewInt(2_000_000_000), GasTipCap: big.NewInt(100_000_000), Gas: 21000})
+
+	if price := EffectiveGasPrice(dynamic, big.NewInt(900_000_000)); price.String() != "1000000000" {
+		t.Errorf("expected: %s, got: %s", "1000000000", price)
+	}
+}
+
+// type-3 transaction and receipt as served by go-ethereum (internal/ethapi testdata of v1.13.15)
+func TestBlobTransactionFees(t *testing.T) {
+	rawTx := []byte(`{
+		"type":"0x3",
+		"chainId":"0x1",
+		"nonce":"0x5",
+		"to":"0x0d3ab14bbad3d99f4203bd7a11acb94882050e7e",
+		"gas":"0x5208",
+		"maxPriorityFeePerGas":"0x1",
+		"maxFeePerGas":"0x1b09d82e",
+		"maxFeePerBlobGas":"0x1",
+		"value":"0x0",
+		"input":"0x",
+		"accessList":[],
+		"blobVersionedHashes":["0x0100000000000000000000000000000000000000000000000000000000000000"],
+		"v":"0x1",
+		"r":"0x38bb9fd000a5c38eab56c1b8ae96556fd58b417d2c8e175d22aadacbdea85d69",
+		"s":"0x2d50cc6ec19ce8d0736554e740ed7d451ac5e72488c186f87402d28bf301f0a3",
+		"yParity":"0x1",
+		"hash":"0xb51ee3d2a89ba5d5623c73133c8d7a6ba9fb41194c17f4302c21b30994a1180f"
+	}`)
+
+	rawReceipt := []byte(`{
+		"blobGasPrice":"0x1",
+		"blobGasUsed":"0x20000",
+		"blockHash":"0xd1392771155ce83f6403c6af275efd22bed567030c21168fcc9dbad5004eb245",
+		"blockNumber":"0x6",
+		"contractAddress":null,
+		"cumulativeGasUsed":"0x5208",
+		"effectiveGasPrice":"0x1b09d63b",
+		"from":"0x703c4b2bd70c169f5717101caee543299fc946c7",
+		"gasUsed":"0x5208",
+		"logs":[],
+		"logsBloom":"0x` + zeros(512) + `",
+		"status":"0x1",
+		"to":"0x0d3ab14bbad3d99f4203bd7a11acb94882050e7e",
+		"transactionHash":"0xb51ee3d2a89ba5d5623c73133c8d7a6ba9fb41194c17f4302c21b30994a1180f",
+		"transactionIndex":"0x0",
+		"type":"0x3"
+	}`)
+
+	var tx types.Transaction
+
+	err := tx.UnmarshalJSON(rawTx)
+
+	if err != nil {
+		t.Fatalf("failed to decode blob transaction: %s", err.Error())
+	}
+
+	receipt, err := DecodeReceipt(rawReceipt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Type() != types.BlobTxType || receipt.Type != types.BlobTxType {
+		t.Fatalf("expected: %v, got: %v %v", types.BlobTxType, tx.Type(), receipt.Type)
+	}
+
+	if tx.Hash() != receipt.TxHash {
+		t.Fatalf("expected: %v, got: %v", receipt.TxHash, tx.Hash())
+	}
+
+	if len(tx.BlobHashes()) != 1 || tx.BlobGasFeeCap().Int64() != 1 {
+		t.Errorf("unexpected blob fields: hashes=%d fee cap=%s", len(tx.BlobHashes()), tx.BlobGasFeeCap())
+	}
+
+	fees := ComputeTxFees(receipt, &tx, big.NewInt(453629498))
+
+	expected := map[string]string{
+		"total": "9526219610072",
+		"burnt": "9526219458000",
+		"tip":   "21000",
+		"blob":  "131072",
+	}
+
+	got := map[string]string{
+		"total": fees.Total.String(),
+		"burnt": fees.Burnt.String(),
+		"tip":   fees.Tip.String(),
+		"blob":  fees.Blob.String(),
+	}
+
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("%s expected: %s, got: %s", k, v, got[k])
+		}
+	}
+}
+
+func TestFormatETH(t *testing.T) {
+	cases := map[string]string{
+		"0":                     "0",
+		"1500000000000000":      "0.0015",
+		"21000000262144":        "0.000021000000262144",
+		"2000000000000000000":   "2",
+		"-1000000000000000001":  "-1.000000000000000001",
+		"123456789012345678901": "123.456789012345678901",
+	}
+
+	for wei, eth := range cases {
+		v, _ := new(big.Int).SetString(wei, 10)
+
+		if FormatETH(v) != eth {
+			t.Errorf("expected: %s, got: %s", eth, FormatETH(v))
+		}
+	}
+}
+
+func zeros(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '0'
+	}
+	return string(b)
+}
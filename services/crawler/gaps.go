@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultCheckpointDir = "data/checkpoints"
+)
+
+type GapSource string
+
+const (
+	// heights are read from the event partition keys in s3
+	S3GapSource GapSource = "s3"
+	// heights are read from the local checkpoint store
+	CheckpointGapSource GapSource = "checkpoint"
+)
+
+// BlockRange is an inclusive range of block heights
+type BlockRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+func (r BlockRange) String() string {
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// Len returns the number of blocks in the range
+func (r BlockRange) Len() uint64 {
+	return r.To - r.From + 1
+}
+
+// Split splits the range into batches of at most size blocks
+func (r BlockRange) Split(size uint64) []BlockRange {
+	if size == 0 {
+		return []BlockRange{r}
+	}
+
+	var batches []BlockRange
+
+	for start := r.From; start <= r.To; start += size {
+		end := start + size - 1
+
+		if end > r.To || end < start {
+			end = r.To
+		}
+
+		batches = append(batches, BlockRange{From: start, To: end})
+
+		if end == r.To {
+			break
+		}
+	}
+
+	return batches
+}
+
+// CompactRanges collapses heights into sorted ranges of consecutive heights, duplicates are ignored
+func CompactRanges(heights []uint64) []BlockRange {
+	sorted := make([]uint64, len(heights))
+	copy(sorted, heights)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var ranges []BlockRange
+
+	for _, height := range sorted {
+		last := len(ranges) - 1
+
+		if last >= 0 && height <= ranges[last].To+1 {
+			if height > ranges[last].To {
+				ranges[last].To = height
+			}
+			continue
+		}
+
+		ranges = append(ranges, BlockRange{From: height, To: height})
+	}
+
+	return ranges
+}
+
+// MergeRanges returns the sorted union of the ranges with adjacent and overlapping ranges merged
+func MergeRanges(ranges []BlockRange) []BlockRange {
+	sorted := make([]BlockRange, len(ranges))
+	copy(sorted, ranges)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].From < sorted[j].From
+	})
+
+	var merged []BlockRange
+
+	for _, r := range sorted {
+		last := len(merged) - 1
+
+		if last >= 0 && r.From <= merged[last].To+1 {
+			if r.To > merged[last].To {
+				merged[last].To = r.To
+			}
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// MissingRanges returns the ranges between from and to not covered by done
+func MissingRanges(done []BlockRange, from, to uint64) []BlockRange {
+	var missing []BlockRange
+
+	next := from
+
+	for _, r := range MergeRanges(done) {
+		if r.To < next {
+			continue
+		}
+
+		if r.From > to {
+			break
+		}
+
+		if r.From > next {
+			missing = append(missing, BlockRange{From: next, To: r.From - 1})
+		}
+
+		if r.To >= to {
+			return missing
+		}
+
+		next = r.To + 1
+	}
+
+	if next <= to {
+		missing = append(missing, BlockRange{From: next, To: to})
+	}
+
+	return missing
+}
+
+// CheckpointStore records the crawled heights of each network as compact ranges,
+// one json file per network (e.g. ethereum-goerli.json)
+type CheckpointStore struct {
+	Dir    string
+	mu     sync.Mutex
+	ranges map[NetworkType][]BlockRange
+	dirty  map[NetworkType]bool
+}
+
+func NewCheckpointStore(dir string) (*CheckpointStore, error) {
+	if dir == "" {
+		return nil, errors.New("checkpoint store directory is required")
+	}
+
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CheckpointStore{
+		Dir:    dir,
+		ranges: make(map[NetworkType][]BlockRange),
+		dirty:  make(map[NetworkType]bool),
+	}, nil
+}
+
+// Mark records a crawled height
+func (s *CheckpointStore) Mark(network NetworkType, height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ranges, err := s.load(network)
+
+	if err != nil {
+		return err
+	}
+
+	s.ranges[network] = MergeRanges(append(ranges, BlockRange{From: height, To: height}))
+	s.dirty[network] = true
+	return nil
+}
+
+// Done returns the crawled ranges of a network
+func (s *CheckpointStore) Done(network NetworkType) ([]BlockRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ranges, err := s.load(network)
+
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]BlockRange, len(ranges))
+	copy(done, ranges)
+
+	return done, nil
+}
+
+// Flush writes the ranges of every network marked since the last flush, each file is replaced atomically
+func (s *CheckpointStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for network := range s.dirty {
+		err := SaveJSON(s.file(network), s.ranges[network])
+
+		if err != nil {
+			return fmt.Errorf("failed to write checkpoints of network=%s: %s", network, err.Error())
+		}
+
+		delete(s.dirty, network)
+	}
+
+	return nil
+}
+
+func (s *CheckpointStore) file(network NetworkType) string {
+	return path.Join(s.Dir, fmt.Sprintf("%s-%s.json", Ethereum, network))
+}
+
+func (s *CheckpointStore) load(network NetworkType) ([]BlockRange, error) {
+	if ranges, ok := s.ranges[network]; ok {
+		return ranges, nil
+	}
+
+	var ranges []BlockRange
+
+	data, err := os.ReadFile(s.file(network))
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &ranges)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode checkpoints of network=%s: %s", network, err.Error())
+		}
+	}
+
+	s.ranges[network] = ranges
+	return ranges, nil
+}
+
+// FindGaps returns the ranges between from and to that haven't been uploaded according to the source
+func (c *EthereumCrawler) FindGaps(from, to uint64, source GapSource) ([]BlockRange, error) {
+	var done []BlockRange
+
+	switch source {
+	case S3GapSource:
+		heights, err := c.S3.AlreadyConsumed(c.Glue.EventMeta.Bucket, fmt.Sprintf("chain=%s/network=%s/", Ethereum, c.Config.Network))
+
+		if err != nil {
+			return nil, err
+		}
+
+		done = CompactRanges(heights)
+	case CheckpointGapSource:
+		if c.Checkpoints == nil {
+			return nil, errors.New("checkpoint store not configured")
+		}
+
+		checkpoints, err := c.Checkpoints.Done(c.Config.Network)
+
+		if err != nil {
+			return nil, err
+		}
+
+		done = checkpoints
+	default:
+		return nil, fmt.Errorf("unknown gap source: %s", source)
+	}
+
+	return MissingRanges(done, from, to), nil
+}
+
+// CrawlRanges processes only the given ranges, split into batches of the configured batch size
+func (c *EthereumCrawler) CrawlRanges(ranges []BlockRange) {
+	defer c.Wg.Wait()
+	l := c.Logger.Sugar()
+
+	for _, r := range ranges {
+		for _, batch := range r.Split(c.Config.BatchSize) {
+			c.Wg.Add(1)
+			go func(batch BlockRange) {
+				c.Sema <- struct{}{}
+
+				defer func() {
+					<-c.Sema
+					c.Wg.Done()
+					l.Infof("completed batch=%s", batch)
+				}()
+
+				err := c.ProcessBatch(batch.From, batch.To)
+
+				if err != nil {
+					l.Info(err.Error())
+				}
+			}(batch)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCompactRanges(t *testing.T) {
+	ranges := CompactRanges([]uint64{7, 3, 4, 5, 5, 10, 8, 1})
+	expected := "[1-1 3-5 7-8 10-10]"
+
+	if fmt.Sprint(ranges) != expected {
+		t.Errorf("expected: %v, got: %v", expected, ranges)
+	}
+
+	if len(CompactRanges(nil)) != 0 {
+		t.Errorf("expected no ranges, got: %v", CompactRanges(nil))
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	done := []BlockRange{{From: 10, To: 19}, {From: 0, To: 4}, {From: 15, To: 25}, {From: 40, To: 60}}
+
+	cases := []struct {
+		from, to uint64
+		expected string
+	}{
+		{0, 50, "[5-9 26-39]"},
+		{0, 70, "[5-9 26-39 61-70]"},
+		{12, 22, "[]"},
+		{3, 12, "[5-9]"},
+		{61, 61, "[61-61]"},
+	}
+
+	for _, c := range cases {
+		missing := MissingRanges(done, c.from, c.to)
+
+		if fmt.Sprint(missing) != c.expected {
+			t.Errorf("expected: %v, got: %v (from=%d to=%d)", c.expected, missing, c.from, c.to)
+		}
+	}
+}
+
+func TestBlockRangeSplit(t *testing.T) {
+	batches := BlockRange{From: 10, To: 34}.Split(10)
+	expected := "[10-19 20-29 30-34]"
+
+	if fmt.Sprint(batches) != expected {
+		t.Errorf("expected: %v, got: %v", expected, batches)
+	}
+}
+
+func TestCheckpointStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewCheckpointStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, height := range []uint64{5, 3, 4, 9} {
+		err = store.Mark(EthereumGoerli, height)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = store.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil || len(entries) != 1 || entries[0].Name() != "ethereum-goerli.json" {
+		t.Fatalf("expected only the renamed checkpoint file, got: %v (%v)", entries, err)
+	}
+
+	reopened, err := NewCheckpointStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := reopened.Done(EthereumGoerli)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(done) != "[3-5 9-9]" {
+		t.Errorf("expected: %v, got: %v", "[3-5 9-9]", done)
+	}
+
+	if fmt.Sprint(MissingRanges(done, 0, 10)) != "[0-2 6-8 10-10]" {
+		t.Errorf("expected: %v, got: %v", "[0-2 6-8 10-10]", MissingRanges(done, 0, 10))
+	}
+
+	other, err := reopened.Done(EthereumMainnet)
+
+	if err != nil || len(other) != 0 {
+		t.Errorf("expected no checkpoints on mainnet, got: %v (%v)", other, err)
+	}
+}
@@ -23,15 +23,27 @@ type Table struct {
 	Version  int
 	Bucket   string
 	SerDe    string
+	// set when the table is declared as holding compressed objects
+	Compressed bool
 }
 
 type GlueService struct {
-	Client          *glue.Client
-	Databases       []types.Database
-	Tables          []types.Table
-	EventMeta       Table
-	ActionMeta      Table
-	ResourceVersion int
+	Client       *glue.Client
+	Databases    []types.Database
+	Tables       []types.Table
+	EventMeta    Table
+	ActionMeta   Table
+	SnapshotMeta Table
+	RewardsMeta  Table
+	PoolMeta     Table
+	// decoded contract logs, matched before events since the table name contains both
+	ContractEventMeta Table
+	// logs decoded with the configured abis
+	DecodedEventMeta Table
+	ValidatorMeta    Table
+	// actions indexed by address prefix
+	AddressIndexMeta Table
+	ResourceVersion  int
 }
 
 type Partition struct {
@@ -112,6 +124,39 @@ func (g *GlueService) LoadTables(databaseName string) error {
 	return nil
 }
 
+// NewSinkServices returns the introspected glue tables and an s3 client scoped to the environment and namespace,
+// for commands that read or maintain the sink without an rpc node
+func NewSinkServices(config Config) (*GlueService, *S3Service, error) {
+	awsConfig, err := LoadDefaultAWSConfig()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load aws default config: %s", err.Error())
+	}
+
+	glue, err := NewGlueService(awsConfig)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = glue.Introspect(config.Env)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s3c, err := NewS3Service(awsConfig)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s3c.Env = config.Env
+	s3c.Namespace = config.Namespace
+
+	return glue, s3c, nil
+}
+
 func (g *GlueService) Introspect(env Env) error {
 	db := CasimirAnalyticsDatabaseDev
 
@@ -135,6 +180,22 @@ func (g *GlueService) Introspect(env Env) error {
 		return nil
 	}
 
+	// tables are matched by the first name fragment they contain, decoded and contract event tables before the event table
+	metas := []struct {
+		fragment string
+		meta     *Table
+	}{
+		{"address", &g.AddressIndexMeta},
+		{"decoded", &g.DecodedEventMeta},
+		{"contract", &g.ContractEventMeta},
+		{"event", &g.EventMeta},
+		{"action", &g.ActionMeta},
+		{"snapshot", &g.SnapshotMeta},
+		{"reward", &g.RewardsMeta},
+		{"validator", &g.ValidatorMeta},
+		{"pool", &g.PoolMeta},
+	}
+
 	for _, t := range g.Tables {
 		table := *t.Name
 		serde := t.StorageDescriptor.SerdeInfo.SerializationLibrary
@@ -143,43 +204,38 @@ func (g *GlueService) Introspect(env Env) error {
 		cleanedBucket := strings.TrimPrefix(*bucket, "s3://")
 		cleanedBucket = strings.TrimSuffix(cleanedBucket, "/")
 
-		switch {
-		case strings.Contains(table, "event"):
-			lastWord := table[len(table)-1]
+		var meta *Table
 
-			resourceVersion, err := strconv.Atoi(string(lastWord))
-
-			if err != nil {
-				return err
+		for _, m := range metas {
+			if strings.Contains(table, m.fragment) {
+				meta = m.meta
+				break
 			}
+		}
 
-			g.EventMeta = Table{
-				Name:     table,
-				Database: db,
-				Version:  resourceVersion,
-				Bucket:   cleanedBucket,
-				SerDe:    strings.Split(*serde, ".")[3],
-			}
+		if meta == nil {
+			return fmt.Errorf("unknown table: %s", table)
+		}
 
-			g.ResourceVersion = resourceVersion
-		case strings.Contains(table, "action"):
-			lastWord := table[len(table)-1]
+		lastWord := table[len(table)-1]
 
-			resourceVersion, err := strconv.Atoi(string(lastWord))
+		resourceVersion, err := strconv.Atoi(string(lastWord))
 
-			if err != nil {
-				return err
-			}
+		if err != nil {
+			return err
+		}
 
-			g.ActionMeta = Table{
-				Name:     table,
-				Database: db,
-				Version:  resourceVersion,
-				Bucket:   cleanedBucket,
-				SerDe:    strings.Split(*serde, ".")[3],
-			}
-		default:
-			return fmt.Errorf("unknown table: %s", table)
+		*meta = Table{
+			Name:       table,
+			Database:   db,
+			Version:    resourceVersion,
+			Bucket:     cleanedBucket,
+			SerDe:      strings.Split(*serde, ".")[3],
+			Compressed: t.StorageDescriptor.Compressed,
+		}
+
+		if meta == &g.EventMeta {
+			g.ResourceVersion = resourceVersion
 		}
 	}
 
@@ -190,6 +246,20 @@ func (g *GlueService) Introspect(env Env) error {
 	return nil
 }
 
+// PartitionTables returns the introspected tables that receive block partitions in the configured compression,
+// the address index is always written uncompressed
+func (g *GlueService) PartitionTables() []Table {
+	var tables []Table
+
+	for _, table := range []Table{g.EventMeta, g.ActionMeta, g.SnapshotMeta, g.RewardsMeta, g.PoolMeta, g.ContractEventMeta, g.DecodedEventMeta, g.ValidatorMeta} {
+		if table.Name != "" {
+			tables = append(tables, table)
+		}
+	}
+
+	return tables
+}
+
 func (g *GlueService) Parition(s3v *S3Service, parts []string) error {
 	return nil
 }
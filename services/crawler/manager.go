@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// bump when the snapshot row changes shape
+	ManagerSnapshotVersion = 1
+	// ~1 day of mainnet blocks
+	DefaultSnapshotInterval = 7200
+)
+
+// ManagerSnapshot is the state of the CasimirManager view functions at a block
+type ManagerSnapshot struct {
+	Chain                      ChainType   `json:"chain"`
+	Network                    NetworkType `json:"network"`
+	Contract                   string      `json:"contract"`
+	Version                    int         `json:"version"`
+	Height                     uint64      `json:"height"`
+	Block                      string      `json:"block"`
+	ReceivedAt                 uint64      `json:"received_at"`
+	TotalStake                 string      `json:"total_stake"`
+	BufferedBalance            string      `json:"buffered_balance"`
+	ReadyBalance               string      `json:"ready_balance"`
+	WithdrawableBalance        string      `json:"withdrawable_balance"`
+	LatestBeaconBalance        string      `json:"latest_beacon_balance"`
+	ReservedFeeBalance         string      `json:"reserved_fee_balance"`
+	UpkeepBalance              string      `json:"upkeep_balance"`
+	RequestedWithdrawalBalance string      `json:"requested_withdrawal_balance"`
+	PendingPoolIds             []uint32    `json:"pending_pool_ids"`
+	ReadyPoolIds               []uint32    `json:"ready_pool_ids"`
+	StakedPoolIds              []uint32    `json:"staked_pool_ids"`
+}
+
+// SnapshotManager reads every manager view function at the given block
+func SnapshotManager(manager *MainCaller, block *big.Int) (ManagerSnapshot, error) {
+	snapshot := ManagerSnapshot{
+		Version: ManagerSnapshotVersion,
+		Height:  block.Uint64(),
+	}
+
+	opt := &bind.CallOpts{BlockNumber: block, Context: context.Background()}
+
+	balances := []struct {
+		name string
+		call func(*bind.CallOpts) (*big.Int, error)
+		dest *string
+	}{
+		{"GetTotalStake", manager.GetTotalStake, &snapshot.TotalStake},
+		{"GetBufferedBalance", manager.GetBufferedBalance, &snapshot.BufferedBalance},
+		{"GetReadyBalance", manager.GetReadyBalance, &snapshot.ReadyBalance},
+		{"GetWithdrawableBalance", manager.GetWithdrawableBalance, &snapshot.WithdrawableBalance},
+		{"LatestBeaconBalance", manager.LatestBeaconBalance, &snapshot.LatestBeaconBalance},
+		{"GetReservedFeeBalance", manager.GetReservedFeeBalance, &snapshot.ReservedFeeBalance},
+		{"GetUpkeepBalance", manager.GetUpkeepBalance, &snapshot.UpkeepBalance},
+		{"RequestedWithdrawalBalance", manager.RequestedWithdrawalBalance, &snapshot.RequestedWithdrawalBalance},
+	}
+
+	for _, b := range balances {
+		value, err := b.call(opt)
+
+		if err != nil {
+			return snapshot, fmt.Errorf("failed to call %s at block=%d: %s", b.name, block.Uint64(), err.Error())
+		}
+
+		*b.dest = value.String()
+	}
+
+	pools := []struct {
+		name string
+		call func(*bind.CallOpts) ([]uint32, error)
+		dest *[]uint32
+	}{
+		{"GetPendingPoolIds", manager.GetPendingPoolIds, &snapshot.PendingPoolIds},
+		{"GetReadyPoolIds", manager.GetReadyPoolIds, &snapshot.ReadyPoolIds},
+		{"GetStakedPoolIds", manager.GetStakedPoolIds, &snapshot.StakedPoolIds},
+	}
+
+	for _, p := range pools {
+		ids, err := p.call(opt)
+
+		if err != nil {
+			return snapshot, fmt.Errorf("failed to call %s at block=%d: %s", p.name, block.Uint64(), err.Error())
+		}
+
+		// keep empty lists as [] instead of null
+		*p.dest = append([]uint32{}, ids...)
+	}
+
+	return snapshot, nil
+}
+
+// SnapshotBlocks returns the blocks between from and to that fall on the interval
+func SnapshotBlocks(from, to, interval uint64) ([]uint64, error) {
+	if interval == 0 {
+		return nil, errors.New("snapshot interval must be greater than 0")
+	}
+
+	if to < from {
+		return nil, fmt.Errorf("invalid snapshot range: from=%d to=%d", from, to)
+	}
+
+	var blocks []uint64
+
+	start := ((from + interval - 1) / interval) * interval
+
+	for b := start; b <= to; b += interval {
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
+
+// Manager returns the manager address, commands reading the manager fail on networks without one
+func (c *EthereumCrawler) Manager() (common.Address, error) {
+	if c.Config.ManagerAddress == "" {
+		return common.Address{}, fmt.Errorf("%w for network=%s, set %s or --manager", ErrNoManagerAddress, c.Config.Network, ETHEREUM_MANAGER_ADDRESS)
+	}
+
+	return common.HexToAddress(c.Config.ManagerAddress), nil
+}
+
+// SnapshotManagerRange snapshots the manager at every interval between from and to and uploads each snapshot to the snapshot table
+func (c *EthereumCrawler) SnapshotManagerRange(from, to, interval uint64) error {
+	l := c.Logger.Sugar()
+
+	if c.Glue.SnapshotMeta.Bucket == "" {
+		return errors.New("manager snapshot table not found")
+	}
+
+	address, err := c.Manager()
+
+	if err != nil {
+		return err
+	}
+
+	manager, err := NewMainCaller(address, c.Client)
+
+	if err != nil {
+		return err
+	}
+
+	blocks, err := SnapshotBlocks(from, to, interval)
+
+	if err != nil {
+		return err
+	}
+
+	l.Infof("taking %d manager snapshots contract=%s from=%d to=%d interval=%d", len(blocks), address.Hex(), from, to, interval)
+
+	for _, b := range blocks {
+		header, err := c.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(b))
+
+		if err != nil {
+			return fmt.Errorf("failed to get header=%d: %s", b, err.Error())
+		}
+
+		snapshot, err := SnapshotManager(manager, header.Number)
+
+		if err != nil {
+			return err
+		}
+
+		snapshot.Chain = Ethereum
+		snapshot.Network = c.Config.Network
+		snapshot.Contract = address.Hex()
+		snapshot.Block = header.Hash().Hex()
+		snapshot.ReceivedAt = header.Time
+
+		encoded, err := EncodePartition([]ManagerSnapshot{snapshot}, c.Config.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		tt := time.Unix(int64(header.Time), 0)
+
+		partition := Partition{
+			Chain:   Ethereum,
+			Network: c.Config.Network,
+			Year:    fmt.Sprintf("%04d", tt.Year()),
+			Month:   fmt.Sprintf("%02d", tt.Month()),
+			Block:   b,
+		}
+
+		key := c.Config.Compression.PartitionKey(partition)
+
+		err = c.UploadPartition(c.Glue.SnapshotMeta.Bucket, key, encoded, snapshot.Block)
+
+		if err != nil {
+			return err
+		}
+
+		l.Infof("uploaded manager snapshot block=%d to partition=%s", b, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// managerCaller answers CasimirManager view calls with canned outputs keyed by method name
+type managerCaller struct {
+	abi     *abi.ABI
+	outputs map[string][]interface{}
+}
+
+func newManagerCaller(t *testing.T, outputs map[string][]interface{}) *managerCaller {
+	parsed, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &managerCaller{abi: parsed, outputs: outputs}
+}
+
+func (m *managerCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (m *managerCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	method, err := m.abi.MethodById(call.Data[:4])
+
+	if err != nil {
+		return nil, err
+	}
+
+	out, ok := m.outputs[method.Name]
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected call: %s", method.Name)
+	}
+
+	return method.Outputs.Pack(out...)
+}
+
+func TestSnapshotManager(t *testing.T) {
+	outputs := map[string][]interface{}{
+		"getPendingPoolIds": {[]uint32{4}},
+		"getReadyPoolIds":   {[]uint32{}},
+		"getStakedPoolIds":  {[]uint32{1, 2, 3}},
+	}
+
+	for i, name := range []string{"getTotalStake", "getBufferedBalance", "getReadyBalance", "getWithdrawableBalance", "latestBeaconBalance", "getReservedFeeBalance", "getUpkeepBalance", "requestedWithdrawalBalance"} {
+		outputs[name] = []interface{}{big.NewInt(int64(i + 1))}
+	}
+
+	manager, err := NewMainCaller(common.HexToAddress(ManagerAddresses[EthereumGoerli]), newManagerCaller(t, outputs))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := SnapshotManager(manager, big.NewInt(100))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.TotalStake != "1" || snapshot.RequestedWithdrawalBalance != "8" || snapshot.Version != ManagerSnapshotVersion {
+		t.Errorf("unexpected snapshot: %+v", snapshot)
+	}
+
+	if len(snapshot.StakedPoolIds) != 3 || snapshot.ReadyPoolIds == nil {
+		t.Errorf("unexpected pool ids: %+v", snapshot)
+	}
+
+	blocks, err := SnapshotBlocks(95, 320, 100)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(blocks) != "[100 200 300]" {
+		t.Errorf("expected: %s, got: %v", "[100 200 300]", blocks)
+	}
+}
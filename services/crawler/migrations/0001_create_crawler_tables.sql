@@ -0,0 +1,61 @@
+-- rows are keyed by (network, block_hash, tx_hash, log_index), tx_hash is empty for block events and
+-- log_index is the position of the row among the rows of its transaction for events and actions
+
+CREATE TABLE IF NOT EXISTS crawler_events (
+    network TEXT NOT NULL,
+    block_hash TEXT NOT NULL,
+    tx_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    chain TEXT NOT NULL,
+    type TEXT NOT NULL,
+    height BIGINT NOT NULL,
+    received_at BIGINT NOT NULL,
+    sender TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    gas_fee TEXT NOT NULL,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (network, block_hash, tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS crawler_events_height_idx ON crawler_events (network, height);
+
+CREATE TABLE IF NOT EXISTS crawler_actions (
+    network TEXT NOT NULL,
+    block_hash TEXT NOT NULL,
+    tx_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    chain TEXT NOT NULL,
+    type TEXT NOT NULL,
+    action TEXT NOT NULL,
+    address TEXT NOT NULL,
+    height BIGINT NOT NULL,
+    amount TEXT NOT NULL,
+    balance TEXT NOT NULL,
+    gas TEXT NOT NULL,
+    received_at BIGINT NOT NULL,
+    token_address TEXT NOT NULL,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (network, block_hash, tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS crawler_actions_address_idx ON crawler_actions (network, address, height DESC);
+
+CREATE TABLE IF NOT EXISTS crawler_contract_events (
+    network TEXT NOT NULL,
+    block_hash TEXT NOT NULL,
+    tx_hash TEXT NOT NULL,
+    log_index INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    timestamp BIGINT NOT NULL,
+    contract TEXT NOT NULL,
+    event TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (network, block_hash, tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS crawler_contract_events_event_idx ON crawler_contract_events (network, event, block_number DESC);
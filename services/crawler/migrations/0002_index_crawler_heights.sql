@@ -0,0 +1,5 @@
+-- the rows of a block are replaced by height and contract events of a reorged block are deleted by block number
+
+CREATE INDEX IF NOT EXISTS crawler_actions_height_idx ON crawler_actions (network, height);
+
+CREATE INDEX IF NOT EXISTS crawler_contract_events_block_idx ON crawler_contract_events (network, block_number);
@@ -0,0 +1,4 @@
+-- token transfers and contract actions keep the log_index of their log, other actions are numbered below zero.
+-- The sent and received actions of a transfer share the log, so the action is part of the key
+
+ALTER TABLE crawler_actions DROP CONSTRAINT crawler_actions_pkey, ADD PRIMARY KEY (network, block_hash, tx_hash, log_index, action);
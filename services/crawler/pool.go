@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// bump when the pool history row changes shape
+	PoolHistoryVersion = 1
+)
+
+type PoolStatus string
+
+const (
+	// initiation requested, waiting for the validator deposit
+	PoolRequested PoolStatus = "requested"
+	// deposited, waiting for the validator to activate
+	PoolPending PoolStatus = "pending"
+	PoolActive  PoolStatus = "active"
+	PoolExiting PoolStatus = "exiting"
+	// exit completed and balance returned to the manager
+	PoolWithdrawn PoolStatus = "withdrawn"
+)
+
+// manager events that drive the pool state machine
+const (
+	InitiationRequestedEvent = "InitiationRequested"
+	PoolInitiatedEvent       = "PoolInitiated"
+	PoolActivatedEvent       = "PoolActivated"
+	ExitRequestedEvent       = "ExitRequested"
+	ExitCompletedEvent       = "ExitCompleted"
+	ResharesRequestedEvent   = "ResharesRequested"
+	ReshareCompletedEvent    = "ReshareCompleted"
+)
+
+// PoolTransitions maps each event to the statuses it's valid from and the status it moves the pool to,
+// a pool first seen mid-life (e.g. the range started after its initiation) accepts any event
+var PoolTransitions = map[string]struct {
+	From []PoolStatus
+	To   PoolStatus
+}{
+	InitiationRequestedEvent: {nil, PoolRequested},
+	PoolInitiatedEvent:       {[]PoolStatus{PoolRequested}, PoolPending},
+	PoolActivatedEvent:       {[]PoolStatus{PoolPending}, PoolActive},
+	ReshareCompletedEvent:    {[]PoolStatus{PoolPending, PoolActive}, ""},
+	ExitRequestedEvent:       {[]PoolStatus{PoolActive}, PoolExiting},
+	// forced exits complete without an exit request
+	ExitCompletedEvent: {[]PoolStatus{PoolActive, PoolExiting}, PoolWithdrawn},
+}
+
+// PoolLog is a pool lifecycle log emitted by the CasimirManager, reshare requests are per operator and have no pool id
+type PoolLog struct {
+	Event      string
+	PoolId     uint32
+	OperatorId uint64
+	Height     uint64
+	Block      common.Hash
+	TxHash     common.Hash
+	LogIndex   uint
+}
+
+// PoolTransition is a row of the pool history table
+type PoolTransition struct {
+	Chain       ChainType   `json:"chain"`
+	Network     NetworkType `json:"network"`
+	Contract    string      `json:"contract"`
+	Version     int         `json:"version"`
+	Event       string      `json:"event"`
+	PoolId      uint32      `json:"pool_id"`
+	PoolAddress string      `json:"pool_address"`
+	// set on reshare requests, the operator being reshared out of its pools
+	OperatorId uint64     `json:"operator_id,omitempty"`
+	FromStatus PoolStatus `json:"from_status"`
+	ToStatus   PoolStatus `json:"to_status"`
+	// seconds spent in from_status, 0 when the pool was first seen in this range
+	Duration   uint64 `json:"duration"`
+	Reshares   int    `json:"reshares"`
+	Height     uint64 `json:"height"`
+	Block      string `json:"block"`
+	Hash       string `json:"hash"`
+	ReceivedAt uint64 `json:"received_at"`
+}
+
+// PoolTracker is the pool state machine, it must be fed logs in block order
+type PoolTracker struct {
+	Pools map[uint32]*PoolState `json:"pools"`
+}
+
+type PoolState struct {
+	Status PoolStatus `json:"status"`
+	// timestamp of the block the pool entered its status
+	Since    uint64 `json:"since"`
+	Address  string `json:"address"`
+	Reshares int    `json:"reshares"`
+}
+
+// PoolsState is the pool tracker after a block, saved between syncs so a sync continues the pool statuses
+// instead of seeing every pool mid-life
+type PoolsState struct {
+	Contract string `json:"contract"`
+	// last block whose pool logs are applied
+	Height  uint64       `json:"height"`
+	Synced  bool         `json:"synced"`
+	Tracker *PoolTracker `json:"tracker"`
+}
+
+func NewPoolTracker() *PoolTracker {
+	return &PoolTracker{Pools: make(map[uint32]*PoolState)}
+}
+
+// Apply moves the pool of a log to its next status, receivedAt is the timestamp of the log's block
+func (p *PoolTracker) Apply(log PoolLog, receivedAt uint64) (PoolTransition, error) {
+	transition := PoolTransition{
+		Version:    PoolHistoryVersion,
+		Event:      log.Event,
+		PoolId:     log.PoolId,
+		OperatorId: log.OperatorId,
+		Height:     log.Height,
+		Block:      log.Block.Hex(),
+		Hash:       log.TxHash.Hex(),
+		ReceivedAt: receivedAt,
+	}
+
+	if log.Event == ResharesRequestedEvent {
+		return transition, nil
+	}
+
+	rule, ok := PoolTransitions[log.Event]
+
+	if !ok {
+		return transition, fmt.Errorf("unknown pool event: %s", log.Event)
+	}
+
+	state, seen := p.Pools[log.PoolId]
+
+	if !seen {
+		state = &PoolState{}
+		p.Pools[log.PoolId] = state
+	}
+
+	if seen && !validFrom(state.Status, rule.From) {
+		return transition, fmt.Errorf("invalid pool transition pool=%d status=%s event=%s block=%d", log.PoolId, state.Status, log.Event, log.Height)
+	}
+
+	to := rule.To
+
+	if log.Event == ReshareCompletedEvent {
+		state.Reshares++
+		to = state.Status
+	}
+
+	transition.FromStatus = state.Status
+	transition.ToStatus = to
+	transition.Reshares = state.Reshares
+
+	if seen && receivedAt >= state.Since {
+		transition.Duration = receivedAt - state.Since
+	}
+
+	if to != state.Status || !seen {
+		state.Since = receivedAt
+	}
+
+	state.Status = to
+
+	return transition, nil
+}
+
+// SetAddress records the pool contract address so later transitions carry it
+func (p *PoolTracker) SetAddress(poolId uint32, address string) {
+	if state, ok := p.Pools[poolId]; ok {
+		state.Address = address
+	}
+}
+
+// Address returns the recorded pool contract address
+func (p *PoolTracker) Address(poolId uint32) string {
+	if state, ok := p.Pools[poolId]; ok {
+		return state.Address
+	}
+
+	return ""
+}
+
+// PoolsStateFile returns the file of the saved pool tracker of a network
+func PoolsStateFile(dir string, network NetworkType) string {
+	return path.Join(dir, fmt.Sprintf("%s-%s-pools.json", Ethereum, network))
+}
+
+// LoadPoolsState reads the saved pool tracker of the contract, a missing file or a state of another
+// contract starts over
+func LoadPoolsState(file string, contract string) (*PoolsState, error) {
+	state := &PoolsState{Contract: contract, Tracker: NewPoolTracker()}
+
+	data, err := os.ReadFile(file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var saved PoolsState
+
+	err = json.Unmarshal(data, &saved)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pools state=%s: %s", file, err.Error())
+	}
+
+	if saved.Contract != contract {
+		return state, nil
+	}
+
+	if saved.Tracker == nil || saved.Tracker.Pools == nil {
+		saved.Tracker = NewPoolTracker()
+	}
+
+	return &saved, nil
+}
+
+// Save writes the state to a temporary file and renames it so a crash never leaves a partial state
+func (p *PoolsState) Save(file string) error {
+	return SaveJSON(file, p)
+}
+
+func validFrom(status PoolStatus, from []PoolStatus) bool {
+	if from == nil {
+		return status == ""
+	}
+
+	for _, s := range from {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FetchPoolLogs returns every pool lifecycle log between from and to ordered by height and log index,
+// the range is read in windows the provider accepts
+func FetchPoolLogs(ctx context.Context, scanner *LogScanner, filterer *MainFilterer, from, to uint64) ([]PoolLog, error) {
+	parsed, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[common.Hash]string)
+
+	for _, name := range []string{InitiationRequestedEvent, PoolInitiatedEvent, PoolActivatedEvent, ExitRequestedEvent, ExitCompletedEvent, ResharesRequestedEvent, ReshareCompletedEvent} {
+		events[parsed.Events[name].ID] = name
+	}
+
+	var logs []PoolLog
+
+	err = scanner.Scan(ctx, from, to, func(raw []types.Log, _, _ uint64) error {
+		for _, log := range raw {
+			if len(log.Topics) == 0 || log.Removed {
+				continue
+			}
+
+			name, ok := events[log.Topics[0]]
+
+			if !ok {
+				continue
+			}
+
+			poolLog := PoolLog{Event: name, Height: log.BlockNumber, Block: log.BlockHash, TxHash: log.TxHash, LogIndex: log.Index}
+
+			switch name {
+			case InitiationRequestedEvent:
+				e, err := filterer.ParseInitiationRequested(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			case PoolInitiatedEvent:
+				e, err := filterer.ParsePoolInitiated(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			case PoolActivatedEvent:
+				e, err := filterer.ParsePoolActivated(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			case ExitRequestedEvent:
+				e, err := filterer.ParseExitRequested(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			case ExitCompletedEvent:
+				e, err := filterer.ParseExitCompleted(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			case ResharesRequestedEvent:
+				e, err := filterer.ParseResharesRequested(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.OperatorId = e.OperatorId
+			case ReshareCompletedEvent:
+				e, err := filterer.ParseReshareCompleted(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %s", name, err.Error())
+				}
+
+				poolLog.PoolId = e.PoolId
+			}
+
+			logs = append(logs, poolLog)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].Height != logs[j].Height {
+			return logs[i].Height < logs[j].Height
+		}
+		return logs[i].LogIndex < logs[j].LogIndex
+	})
+
+	return logs, nil
+}
+
+// SyncPools replays the pool lifecycle logs between from and to and uploads each transition to the pool history table.
+// The tracker is saved in the checkpoint dir, so a sync continues after the last synced block with the pool statuses
+func (c *EthereumCrawler) SyncPools(from, to uint64) error {
+	l := c.Logger.Sugar()
+
+	if c.Glue.PoolMeta.Bucket == "" {
+		return errors.New("pool history table not found")
+	}
+
+	address, err := c.Manager()
+
+	if err != nil {
+		return err
+	}
+
+	manager, err := NewMain(address, c.Client)
+
+	if err != nil {
+		return err
+	}
+
+	file := ""
+	state := &PoolsState{Contract: address.Hex(), Tracker: NewPoolTracker()}
+
+	if c.Config.CheckpointDir != "" {
+		file = PoolsStateFile(c.Config.CheckpointDir, c.Config.Network)
+
+		state, err = LoadPoolsState(file, address.Hex())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if state.Synced {
+		if from > state.Height+1 {
+			return fmt.Errorf("pools are synced to block=%d, syncing from=%d would skip pool logs", state.Height, from)
+		}
+
+		from = state.Height + 1
+	}
+
+	if from > to {
+		l.Infof("pools are synced to block=%d contract=%s", state.Height, address.Hex())
+		return nil
+	}
+
+	scanner := NewLogScanner(c.Client, DefaultLogWindow, func() []common.Address { return []common.Address{address} })
+
+	logs, err := FetchPoolLogs(context.Background(), scanner, &manager.MainFilterer, from, to)
+
+	if err != nil {
+		return err
+	}
+
+	l.Infof("found %d pool logs contract=%s from=%d to=%d", len(logs), address.Hex(), from, to)
+
+	tracker := state.Tracker
+	byHeight := make(map[uint64][]PoolTransition)
+	var heights []uint64
+	times := make(map[uint64]uint64)
+	blocks := make(map[uint64]string)
+
+	for _, log := range logs {
+		receivedAt, ok := times[log.Height]
+
+		if !ok {
+			header, err := c.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(log.Height))
+
+			if err != nil {
+				return fmt.Errorf("failed to get header=%d: %s", log.Height, err.Error())
+			}
+
+			receivedAt = header.Time
+			times[log.Height] = receivedAt
+		}
+
+		transition, err := tracker.Apply(log, receivedAt)
+
+		if err != nil {
+			// keep going, a missed log shouldn't stop the rest of the history
+			l.Warnf("skipping pool log: %s", err.Error())
+			continue
+		}
+
+		if log.Event != ResharesRequestedEvent && tracker.Address(log.PoolId) == "" {
+			poolAddress, err := manager.GetPoolAddress(&bind.CallOpts{BlockNumber: new(big.Int).SetUint64(log.Height), Context: context.Background()}, log.PoolId)
+
+			if err != nil {
+				l.Warnf("failed to get pool address pool=%d block=%d: %s", log.PoolId, log.Height, err.Error())
+			} else if poolAddress != (common.Address{}) {
+				tracker.SetAddress(log.PoolId, poolAddress.Hex())
+			}
+		}
+
+		transition.Chain = Ethereum
+		transition.Network = c.Config.Network
+		transition.Contract = address.Hex()
+		transition.PoolAddress = tracker.Address(log.PoolId)
+
+		// heights whose logs are all skipped have no partition
+		if _, ok := byHeight[log.Height]; !ok {
+			heights = append(heights, log.Height)
+			blocks[log.Height] = log.Block.Hex()
+		}
+
+		byHeight[log.Height] = append(byHeight[log.Height], transition)
+	}
+
+	for _, height := range heights {
+		encoded, err := EncodePartition(byHeight[height], c.Config.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		tt := time.Unix(int64(times[height]), 0)
+
+		partition := Partition{
+			Chain:   Ethereum,
+			Network: c.Config.Network,
+			Year:    fmt.Sprintf("%04d", tt.Year()),
+			Month:   fmt.Sprintf("%02d", tt.Month()),
+			Block:   height,
+		}
+
+		key := c.Config.Compression.PartitionKey(partition)
+
+		err = c.UploadPartition(c.Glue.PoolMeta.Bucket, key, encoded, blocks[height])
+
+		if err != nil {
+			return err
+		}
+
+		l.Infof("uploaded %d pool transitions block=%d to partition=%s", len(byHeight[height]), height, key)
+	}
+
+	state.Height = to
+	state.Synced = true
+
+	if file != "" {
+		err = state.Save(file)
+
+		if err != nil {
+			return fmt.Errorf("failed to save pools state: %s", err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestPoolTracker(t *testing.T) {
+	tracker := NewPoolTracker()
+
+	logs := []struct {
+		log        PoolLog
+		receivedAt uint64
+		from       PoolStatus
+		to         PoolStatus
+		duration   uint64
+	}{
+		{PoolLog{Event: InitiationRequestedEvent, PoolId: 1, Height: 10}, 1000, "", PoolRequested, 0},
+		{PoolLog{Event: PoolInitiatedEvent, PoolId: 1, Height: 12}, 1024, PoolRequested, PoolPending, 24},
+		{PoolLog{Event: PoolActivatedEvent, PoolId: 1, Height: 100}, 2000, PoolPending, PoolActive, 976},
+		{PoolLog{Event: ResharesRequestedEvent, OperatorId: 7, Height: 150}, 2600, "", "", 0},
+		{PoolLog{Event: ReshareCompletedEvent, PoolId: 1, Height: 160}, 2720, PoolActive, PoolActive, 720},
+		{PoolLog{Event: ExitCompletedEvent, PoolId: 1, Height: 200}, 3200, PoolActive, PoolWithdrawn, 1200},
+		// pool first seen mid-life
+		{PoolLog{Event: ExitRequestedEvent, PoolId: 2, Height: 210}, 3320, "", PoolExiting, 0},
+	}
+
+	for _, l := range logs {
+		transition, err := tracker.Apply(l.log, l.receivedAt)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if transition.FromStatus != l.from || transition.ToStatus != l.to || transition.Duration != l.duration {
+			t.Errorf("expected: %s->%s (%d), got: %s->%s (%d)", l.from, l.to, l.duration, transition.FromStatus, transition.ToStatus, transition.Duration)
+		}
+	}
+
+	transition, err := tracker.Apply(PoolLog{Event: PoolActivatedEvent, PoolId: 1, Height: 300}, 4400)
+
+	if err == nil {
+		t.Errorf("expected an invalid transition error, got: %+v", transition)
+	}
+}
+
+func TestPoolsState(t *testing.T) {
+	file := path.Join(t.TempDir(), "pools.json")
+
+	state, err := LoadPoolsState(file, "0xmanager")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.Tracker.Apply(PoolLog{Event: InitiationRequestedEvent, PoolId: 1, Height: 10}, 1000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state.Tracker.SetAddress(1, "0xpool")
+	state.Height = 20
+	state.Synced = true
+
+	err = state.Save(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next sync continues the pool from its saved status
+	resumed, err := LoadPoolsState(file, "0xmanager")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transition, err := resumed.Tracker.Apply(PoolLog{Event: PoolInitiatedEvent, PoolId: 1, Height: 30}, 1300)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if transition.FromStatus != PoolRequested || transition.Duration != 300 || resumed.Tracker.Address(1) != "0xpool" || resumed.Height != 20 {
+		t.Errorf("unexpected transition after resuming: %+v", transition)
+	}
+
+	other, err := LoadPoolsState(file, "0xother")
+
+	if err != nil || other.Synced || len(other.Tracker.Pools) != 0 {
+		t.Errorf("expected the state of another contract to start over, got: %+v (%v)", other, err)
+	}
+}
+
+func poolLog(t *testing.T, event string, height uint64, index uint, id uint64) types.Log {
+	parsed, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return types.Log{Topics: []common.Hash{parsed.Events[event].ID, common.BigToHash(new(big.Int).SetUint64(id))}, BlockNumber: height, Index: index}
+}
+
+func TestFetchPoolLogs(t *testing.T) {
+	filterer := &ledgerFilterer{
+		limit: 5,
+		logs: []types.Log{
+			poolLog(t, InitiationRequestedEvent, 3, 0, 1),
+			poolLog(t, PoolInitiatedEvent, 12, 1, 1),
+			poolLog(t, ResharesRequestedEvent, 12, 0, 7),
+			poolLog(t, ExitCompletedEvent, 40, 0, 1),
+			// not a pool lifecycle event
+			managerLog(t, "RewardsDeposited", 20, 0, nil, 30),
+		},
+	}
+
+	manager, err := NewMainFilterer(common.Address{}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := NewLogScanner(filterer, 100, func() []common.Address { return nil })
+
+	logs, err := FetchPoolLogs(context.Background(), scanner, manager, 0, 50)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PoolLog{
+		{Event: InitiationRequestedEvent, PoolId: 1, Height: 3},
+		{Event: ResharesRequestedEvent, OperatorId: 7, Height: 12},
+		{Event: PoolInitiatedEvent, PoolId: 1, Height: 12, LogIndex: 1},
+		{Event: ExitCompletedEvent, PoolId: 1, Height: 40},
+	}
+
+	if len(logs) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, logs)
+	}
+
+	for i := range expected {
+		if logs[i] != expected[i] {
+			t.Errorf("expected: %+v, got: %+v", expected[i], logs[i])
+		}
+	}
+}
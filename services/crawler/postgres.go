@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// rows copied per statement, larger blocks are split
+	DefaultPostgresBatchSize = 5000
+	// serializes concurrent migrations of the crawler tables
+	migrationLockID = 7_301_955
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type Sink string
+
+const (
+	S3Sink       Sink = "s3"
+	PostgresSink Sink = "postgres"
+)
+
+var Sinks = []Sink{S3Sink, PostgresSink}
+
+// ParseSinks parses the sinks blocks are written to, s3 when none are given
+func ParseSinks(names []string) ([]Sink, error) {
+	if len(names) == 0 {
+		return []Sink{S3Sink}, nil
+	}
+
+	var sinks []Sink
+
+	for _, name := range names {
+		found := false
+
+		for _, sink := range Sinks {
+			if string(sink) == strings.TrimSpace(name) {
+				sinks = append(sinks, sink)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown sink: %s", name)
+		}
+	}
+
+	return sinks, nil
+}
+
+// PGTable is a crawler table, rows are upserted on the key columns
+type PGTable struct {
+	Name    string
+	Columns []string
+	Keys    []string
+	// column of the block height
+	Height string
+}
+
+var (
+	EventsTable = PGTable{
+		Name:    "crawler_events",
+		Columns: []string{"network", "block_hash", "tx_hash", "log_index", "chain", "type", "height", "received_at", "sender", "recipient", "amount", "gas_fee", "data"},
+		Keys:    []string{"network", "block_hash", "tx_hash", "log_index"},
+		Height:  "height",
+	}
+	ActionsTable = PGTable{
+		Name:    "crawler_actions",
+		Columns: []string{"network", "block_hash", "tx_hash", "log_index", "chain", "type", "action", "address", "height", "amount", "balance", "gas", "received_at", "token_address", "data"},
+		// the sent and received actions of a transfer share its log
+		Keys:   []string{"network", "block_hash", "tx_hash", "log_index", "action"},
+		Height: "height",
+	}
+	ContractEventsTable = PGTable{
+		Name:    "crawler_contract_events",
+		Columns: []string{"network", "block_hash", "tx_hash", "log_index", "block_number", "timestamp", "contract", "event", "sender", "amount"},
+		Keys:    []string{"network", "block_hash", "tx_hash", "log_index"},
+		Height:  "block_number",
+	}
+)
+
+// UpsertSQL moves the rows copied into the stage table into the table, rows already stored with the same
+// values are left untouched so replaying a block doesn't rewrite it
+func (t PGTable) UpsertSQL(stage string) string {
+	var updates, current, excluded []string
+
+	for _, column := range t.Columns {
+		if t.isKey(column) {
+			continue
+		}
+
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		current = append(current, fmt.Sprintf("%s.%s", t.Name, column))
+		excluded = append(excluded, fmt.Sprintf("EXCLUDED.%s", column))
+	}
+
+	columns := strings.Join(t.Columns, ", ")
+	keys := strings.Join(t.Keys, ", ")
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s ON CONFLICT (%s) DO UPDATE SET %s, updated_at = now() WHERE (%s) IS DISTINCT FROM (%s)",
+		t.Name, columns, keys, columns, stage, keys, keys, strings.Join(updates, ", "), strings.Join(current, ", "), strings.Join(excluded, ", "),
+	)
+}
+
+// DeleteBlockSQL deletes the rows of a height ($1 network, $2 height) whatever their block hash, so a block is
+// replaced as a whole and the rows of a reorged block don't outlive it
+func (t PGTable) DeleteBlockSQL() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE network = $1 AND %s = $2", t.Name, t.Height)
+}
+
+// DeleteOrphansSQL deletes the rows of the heights ($2) stored under another block hash than the one
+// written now ($3), rows of other blocks are left alone
+func (t PGTable) DeleteOrphansSQL() string {
+	return fmt.Sprintf(
+		"DELETE FROM %s USING unnest($2::bigint[], $3::text[]) AS blocks (height, block_hash) WHERE %s.network = $1 AND %s.%s = blocks.height AND %s.block_hash <> blocks.block_hash",
+		t.Name, t.Name, t.Name, t.Height, t.Name,
+	)
+}
+
+func (t PGTable) isKey(column string) bool {
+	for _, key := range t.Keys {
+		if key == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rowIndexes numbers the rows of each transaction in order, the number is the log index of the row key.
+// Events and actions without a log have no log index of their own, the number only identifies a row within one write of the block
+type rowIndexes map[string]int
+
+func (r rowIndexes) next(tx string) int {
+	index := r[tx]
+	r[tx] = index + 1
+	return index
+}
+
+// EventRows returns the rows of the block and transaction events of a block
+func EventRows(result *BlockEventsResult) ([][]interface{}, error) {
+	blockHash := resultBlockHash(result)
+	indexes := make(rowIndexes)
+
+	rows := make([][]interface{}, 0, len(result.Events))
+
+	for _, event := range result.Events {
+		data, err := json.Marshal(event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, []interface{}{
+			string(event.Network), blockHash, event.Transaction, indexes.next(event.Transaction),
+			string(event.Chain), string(event.Type), int64(event.Height), int64(event.ReceivedAt),
+			event.Sender, event.Recipient, event.Amount, event.GasFee, data,
+		})
+	}
+
+	return rows, nil
+}
+
+// ActionRows returns the rows of the wallet actions of a block
+func ActionRows(result *BlockEventsResult) ([][]interface{}, error) {
+	blockHash := resultBlockHash(result)
+	indexes := make(rowIndexes)
+
+	rows := make([][]interface{}, 0, len(result.Action))
+
+	for _, action := range result.Action {
+		data, err := json.Marshal(action)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// actions without a log are numbered below zero so they never take the index of a log of the transaction
+		logIndex := -indexes.next(action.Hash) - 1
+
+		if action.LogIndex != nil {
+			logIndex = int(*action.LogIndex)
+		}
+
+		rows = append(rows, []interface{}{
+			string(action.Network), blockHash, action.Hash, logIndex,
+			string(action.Chain), string(action.Type), string(action.Action), strings.ToLower(action.Address),
+			int64(result.ActionPartitionKey.Block), action.Amount, action.Balance, action.Gas,
+			int64(action.ReceivedAt), action.TokenAddress, data,
+		})
+	}
+
+	return rows, nil
+}
+
+// ContractEventRows returns the rows of decoded contract logs, keyed by their log index
+func ContractEventRows(records []ContractEventRecord) [][]interface{} {
+	rows := make([][]interface{}, 0, len(records))
+
+	for _, record := range records {
+		rows = append(rows, []interface{}{
+			string(record.Network), record.BlockHash, record.TxHash, int(record.LogIndex),
+			int64(record.BlockNumber), int64(record.Timestamp), record.Contract, record.Event, record.Sender, record.Amount,
+		})
+	}
+
+	return rows
+}
+
+func resultBlockHash(result *BlockEventsResult) string {
+	for _, event := range result.Events {
+		if event.Type == Block {
+			return event.Block
+		}
+	}
+
+	return ""
+}
+
+// PostgresStore upserts crawled rows into postgres alongside the s3 partitions
+type PostgresStore struct {
+	*Logger
+	Pool      *pgxpool.Pool
+	BatchSize int
+}
+
+func NewPostgresStore(ctx context.Context, logger *Logger, url string) (*PostgresStore, error) {
+	if url == "" {
+		return nil, fmt.Errorf("missing env var: %s", POSTGRES_URL)
+	}
+
+	pool, err := pgxpool.New(ctx, url)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %s", err.Error())
+	}
+
+	err = pool.Ping(ctx)
+
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %s", err.Error())
+	}
+
+	return &PostgresStore{
+		Logger:    logger,
+		Pool:      pool,
+		BatchSize: DefaultPostgresBatchSize,
+	}, nil
+}
+
+// Migrate applies the migrations not recorded in crawler_migrations in order
+func (p *PostgresStore) Migrate(ctx context.Context) error {
+	l := p.Logger.Sugar()
+
+	_, err := p.Pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS crawler_migrations (version TEXT PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())")
+
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %s", err.Error())
+	}
+
+	files, err := migrations.ReadDir("migrations")
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	for _, file := range files {
+		version := strings.TrimSuffix(file.Name(), ".sql")
+
+		statements, err := migrations.ReadFile(path.Join("migrations", file.Name()))
+
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, p.Pool, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID)
+
+			if err != nil {
+				return err
+			}
+
+			var applied bool
+
+			err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM crawler_migrations WHERE version = $1)", version).Scan(&applied)
+
+			if err != nil || applied {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, string(statements))
+
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, "INSERT INTO crawler_migrations (version) VALUES ($1)", version)
+
+			if err != nil {
+				return err
+			}
+
+			l.Infof("applied migration=%s", version)
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to apply migration=%s: %s", version, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// WriteBlock replaces the events and actions of a block in one transaction, the rows of the height are deleted
+// first since their keys are row positions and the block may have been reorged since it was written
+func (p *PostgresStore) WriteBlock(ctx context.Context, result *BlockEventsResult) error {
+	events, err := EventRows(result)
+
+	if err != nil {
+		return err
+	}
+
+	actions, err := ActionRows(result)
+
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, p.Pool, func(tx pgx.Tx) error {
+		err := p.replace(ctx, tx, EventsTable, result.EventsPartitionKey, events)
+
+		if err != nil {
+			return err
+		}
+
+		return p.replace(ctx, tx, ActionsTable, result.ActionPartitionKey, actions)
+	})
+}
+
+// WriteContractEvents upserts decoded contract logs in one transaction, the logs stored for their heights under
+// another block hash are deleted first
+func (p *PostgresStore) WriteContractEvents(ctx context.Context, records []ContractEventRecord) error {
+	blocks := make(map[NetworkType]map[uint64]string)
+
+	for _, record := range records {
+		if blocks[record.Network] == nil {
+			blocks[record.Network] = make(map[uint64]string)
+		}
+
+		blocks[record.Network][record.BlockNumber] = record.BlockHash
+	}
+
+	return pgx.BeginFunc(ctx, p.Pool, func(tx pgx.Tx) error {
+		for network, hashes := range blocks {
+			heights := make([]int64, 0, len(hashes))
+			blockHashes := make([]string, 0, len(hashes))
+
+			for height, hash := range hashes {
+				heights = append(heights, int64(height))
+				blockHashes = append(blockHashes, hash)
+			}
+
+			_, err := tx.Exec(ctx, ContractEventsTable.DeleteOrphansSQL(), string(network), heights, blockHashes)
+
+			if err != nil {
+				return fmt.Errorf("failed to delete orphaned rows of %s: %s", ContractEventsTable.Name, err.Error())
+			}
+		}
+
+		return p.upsert(ctx, tx, ContractEventsTable, ContractEventRows(records))
+	})
+}
+
+func (p *PostgresStore) Close() {
+	p.Pool.Close()
+}
+
+// replace deletes the rows of the block of the partition and writes the rows of the block
+func (p *PostgresStore) replace(ctx context.Context, tx pgx.Tx, table PGTable, partition Partition, rows [][]interface{}) error {
+	_, err := tx.Exec(ctx, table.DeleteBlockSQL(), string(partition.Network), int64(partition.Block))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete block=%d rows of %s: %s", partition.Block, table.Name, err.Error())
+	}
+
+	return p.upsert(ctx, tx, table, rows)
+}
+
+// upsert copies the rows into a stage table in batches and moves them into the table
+func (p *PostgresStore) upsert(ctx context.Context, tx pgx.Tx, table PGTable, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	stage := table.Name + "_stage"
+
+	_, err := tx.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", stage, table.Name))
+
+	if err != nil {
+		return fmt.Errorf("failed to create stage table of %s: %s", table.Name, err.Error())
+	}
+
+	size := p.BatchSize
+
+	if size <= 0 {
+		size = DefaultPostgresBatchSize
+	}
+
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{stage}, table.Columns, pgx.CopyFromRows(rows[start:end]))
+
+		if err != nil {
+			return fmt.Errorf("failed to copy rows into %s: %s", table.Name, err.Error())
+		}
+
+		_, err = tx.Exec(ctx, table.UpsertSQL(stage))
+
+		if err != nil {
+			return fmt.Errorf("failed to upsert rows into %s: %s", table.Name, err.Error())
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf("TRUNCATE %s", stage))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// relative price dirs are resolved against the module dir
+	DefaultPriceDir = "data/prices"
+	// day files kept in memory, the least recently used day is written and dropped past it
+	DefaultMaxPriceDays = 32
+	// a day file is written after this many new prices so a crash loses at most this many fetches
+	DefaultPriceFlushEvery = 60
+)
+
+var ErrPriceNotCached = errors.New("price not found in cache")
+
+// PriceStore is a flat file price cache keyed by coin, currency and minute.
+// Prices are stored as one csv file per pair and day (e.g. ETH-USD/2023-07-22.csv)
+// with rows of minute,price,source sorted by minute. The directory is created on the first write.
+type PriceStore struct {
+	Dir        string
+	MaxDays    int
+	FlushEvery int
+	mu         sync.Mutex
+	days       map[string]map[int64]ExchangePrice
+	// loaded day files, least recently used first
+	used []string
+	// prices put since the day file was last written
+	dirty map[string]int
+	last  string
+}
+
+// CachedExchange serves historical prices from a PriceStore and only asks the upstream
+// exchange on a cache miss, in offline mode a miss is an error
+type CachedExchange struct {
+	Upstream Exchange
+	Store    *PriceStore
+	Offline  bool
+}
+
+func NewPriceStore(dir string) (*PriceStore, error) {
+	if dir == "" {
+		return nil, errors.New("price store directory is required")
+	}
+
+	return &PriceStore{
+		Dir:        dir,
+		MaxDays:    DefaultMaxPriceDays,
+		FlushEvery: DefaultPriceFlushEvery,
+		days:       make(map[string]map[int64]ExchangePrice),
+		dirty:      make(map[string]int),
+	}, nil
+}
+
+// ResolvePriceDir returns the price dir, relative dirs are resolved against the module dir
+func ResolvePriceDir(dir string) (string, error) {
+	if dir == "" || path.IsAbs(dir) {
+		return dir, nil
+	}
+
+	root, err := ModuleDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(root, dir), nil
+}
+
+func (p *PriceStore) Get(coin ChainType, currency Currency, t time.Time) (ExchangePrice, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := p.file(coin, currency, t)
+
+	if err != nil {
+		return ExchangePrice{}, false, err
+	}
+
+	day, err := p.load(file)
+
+	if err != nil {
+		return ExchangePrice{}, false, err
+	}
+
+	price, ok := day[MinuteKey(t)]
+
+	if !ok {
+		return ExchangePrice{}, false, nil
+	}
+
+	price.Coin = coin.Short()
+	price.Currency = currency.String()
+	return price, true, nil
+}
+
+// Put stores the price for the minute containing t. The day file is written once it has FlushEvery new prices,
+// and the previous day file is written when prices move to another day or pair.
+func (p *PriceStore) Put(coin ChainType, currency Currency, t time.Time, price ExchangePrice) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := p.file(coin, currency, t)
+
+	if err != nil {
+		return err
+	}
+
+	day, err := p.load(file)
+
+	if err != nil {
+		return err
+	}
+
+	key := MinuteKey(t)
+
+	day[key] = ExchangePrice{
+		Value:  price.Value,
+		Time:   time.Unix(key, 0).UTC(),
+		Source: price.Source,
+	}
+
+	p.dirty[file]++
+
+	if p.last != "" && p.last != file && p.dirty[p.last] > 0 {
+		err = p.flush(p.last)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	p.last = file
+
+	if p.FlushEvery > 0 && p.dirty[file] >= p.FlushEvery {
+		return p.flush(file)
+	}
+
+	return nil
+}
+
+// Flush writes every modified day file back to disk
+func (p *PriceStore) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	files := make([]string, 0, len(p.dirty))
+
+	for file := range p.dirty {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		err := p.flush(file)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PriceStore) flush(file string) error {
+	err := p.write(file, p.days[file])
+
+	if err != nil {
+		return fmt.Errorf("failed to write price file=%s: %s", file, err.Error())
+	}
+
+	delete(p.dirty, file)
+	return nil
+}
+
+// touch marks the day file as most recently used and drops the least recently used days past MaxDays
+func (p *PriceStore) touch(file string) error {
+	for i, used := range p.used {
+		if used == file {
+			p.used = append(p.used[:i], p.used[i+1:]...)
+			break
+		}
+	}
+
+	p.used = append(p.used, file)
+
+	for p.MaxDays > 0 && len(p.used) > p.MaxDays {
+		oldest := p.used[0]
+
+		if p.dirty[oldest] > 0 {
+			err := p.flush(oldest)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		delete(p.days, oldest)
+		p.used = p.used[1:]
+	}
+
+	return nil
+}
+
+func (p *PriceStore) file(coin ChainType, currency Currency, t time.Time) (string, error) {
+	instrument, err := Instrument(coin, currency)
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(p.Dir, instrument, fmt.Sprintf("%s.csv", t.UTC().Format("2006-01-02"))), nil
+}
+
+func (p *PriceStore) load(file string) (map[int64]ExchangePrice, error) {
+	if day, ok := p.days[file]; ok {
+		return day, p.touch(file)
+	}
+
+	day := make(map[int64]ExchangePrice)
+
+	f, err := os.Open(file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		p.days[file] = day
+		return day, p.touch(file)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 3
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read price file=%s: %s", file, err.Error())
+		}
+
+		minute, err := strconv.ParseInt(record[0], 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid minute in price file=%s: %s", file, err.Error())
+		}
+
+		value, err := strconv.ParseFloat(record[1], 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid price in price file=%s: %s", file, err.Error())
+		}
+
+		day[minute] = ExchangePrice{
+			Value:  value,
+			Time:   time.Unix(minute, 0).UTC(),
+			Source: record[2],
+		}
+	}
+
+	p.days[file] = day
+	return day, p.touch(file)
+}
+
+func (p *PriceStore) write(file string, day map[int64]ExchangePrice) error {
+	err := os.MkdirAll(path.Dir(file), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	minutes := make([]int64, 0, len(day))
+
+	for minute := range day {
+		minutes = append(minutes, minute)
+	}
+
+	sort.Slice(minutes, func(i, j int) bool {
+		return minutes[i] < minutes[j]
+	})
+
+	tmp := file + ".tmp"
+
+	f, err := os.Create(tmp)
+
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(f)
+
+	for _, minute := range minutes {
+		price := day[minute]
+
+		err = writer.Write([]string{
+			strconv.FormatInt(minute, 10),
+			strconv.FormatFloat(price.Value, 'f', -1, 64),
+			price.Source,
+		})
+
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// MinuteKey returns the unix timestamp of the minute containing t
+func MinuteKey(t time.Time) int64 {
+	return t.UTC().Truncate(time.Minute).Unix()
+}
+
+// SyncPrices prefetches every minute between from and to into the store and returns the number of minutes stored
+func SyncPrices(store *PriceStore, exchange Exchange, coin ChainType, currency Currency, from, to time.Time) (int, error) {
+	if to.Before(from) {
+		return 0, fmt.Errorf("invalid range: from=%s is after to=%s", from, to)
+	}
+
+	synced := 0
+
+	if ranged, ok := exchange.(RangeExchange); ok {
+		prices, step, err := ranged.HistoricalRange(coin, currency, from, to)
+
+		if err != nil {
+			return 0, err
+		}
+
+		// expand coarser candles so every minute resolves the same way HistoricalPrice would
+		for _, price := range prices {
+			for t := price.Time; t.Before(price.Time.Add(step)); t = t.Add(time.Minute) {
+				if t.Before(from.Truncate(time.Minute)) || t.After(to) {
+					continue
+				}
+
+				err = store.Put(coin, currency, t, price)
+
+				if err != nil {
+					return synced, err
+				}
+
+				synced++
+			}
+		}
+
+		return synced, store.Flush()
+	}
+
+	for t := from.UTC().Truncate(time.Minute); !t.After(to); t = t.Add(time.Minute) {
+		_, ok, err := store.Get(coin, currency, t)
+
+		if err != nil {
+			return synced, err
+		}
+
+		if ok {
+			continue
+		}
+
+		price, err := exchange.HistoricalPrice(coin, currency, t)
+
+		if err != nil {
+			return synced, err
+		}
+
+		err = store.Put(coin, currency, t, price)
+
+		if err != nil {
+			return synced, err
+		}
+
+		synced++
+	}
+
+	return synced, store.Flush()
+}
+
+// NewEnrichmentExchange returns the exchange used to price events, backed by the price store when a price dir is configured
+func NewEnrichmentExchange(logger *Logger, config Config, eths *EthereumService) (Exchange, *PriceStore, error) {
+	if config.PriceDir == "" {
+		if config.PriceOffline {
+			return nil, nil, errors.New("offline prices require a price directory")
+		}
+
+		exchange, err := NewPriceExchange(logger, config, eths)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return exchange, nil, nil
+	}
+
+	store, err := NewPriceStore(config.PriceDir)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var upstream Exchange
+
+	if !config.PriceOffline {
+		upstream, err = NewPriceExchange(logger, config, eths)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	exchange, err := NewCachedExchange(upstream, store, config.PriceOffline)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return exchange, store, nil
+}
+
+func NewCachedExchange(upstream Exchange, store *PriceStore, offline bool) (Exchange, error) {
+	if store == nil {
+		return nil, errors.New("price store is required")
+	}
+
+	if upstream == nil && !offline {
+		return nil, errors.New("upstream exchange is required when not offline")
+	}
+
+	return CachedExchange{
+		Upstream: upstream,
+		Store:    store,
+		Offline:  offline,
+	}, nil
+}
+
+func (c CachedExchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	if c.Offline {
+		return ExchangePrice{}, errors.New("current price is not available in offline mode")
+	}
+
+	return c.Upstream.CurrentPrice(coin, currency)
+}
+
+func (c CachedExchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	price, ok, err := c.Store.Get(coin, currency, received)
+
+	if err != nil {
+		return price, err
+	}
+
+	if ok {
+		return price, nil
+	}
+
+	if c.Offline {
+		return price, fmt.Errorf("%w: coin=%s currency=%s minute=%d", ErrPriceNotCached, coin.Short(), currency, MinuteKey(received))
+	}
+
+	price, err = c.Upstream.HistoricalPrice(coin, currency, received)
+
+	if err != nil {
+		return price, err
+	}
+
+	err = c.Store.Put(coin, currency, received, price)
+
+	if err != nil {
+		return price, err
+	}
+
+	return price, nil
+}
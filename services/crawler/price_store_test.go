@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+type rangeExchange struct {
+	staticExchange
+	prices []ExchangePrice
+	step   time.Duration
+}
+
+func (r rangeExchange) HistoricalRange(coin ChainType, currency Currency, from, to time.Time) ([]ExchangePrice, time.Duration, error) {
+	return r.prices, r.step, nil
+}
+
+func TestPriceStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewPriceStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := time.Unix(1690000025, 0)
+
+	err = store.Put(Ethereum, USD, received, ExchangePrice{Value: 1870.25, Source: CoinbaseSource})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewPriceStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, ok, err := reloaded.Get(Ethereum, USD, received.Add(20*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || price.Value != 1870.25 || price.Source != CoinbaseSource {
+		t.Errorf("unexpected cached price: %+v", price)
+	}
+
+	file := path.Join(dir, "ETH-USD", "2023-07-22.csv")
+
+	content, err := os.ReadFile(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "1690000020,1870.25,coinbase\n" {
+		t.Errorf("unexpected price file: %q", string(content))
+	}
+}
+
+func TestCachedExchange_Offline(t *testing.T) {
+	store, err := NewPriceStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange, err := NewCachedExchange(nil, store, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = exchange.HistoricalPrice(Ethereum, USD, time.Unix(1690000000, 0))
+
+	if !errors.Is(err, ErrPriceNotCached) {
+		t.Errorf("expected: %v, got: %v", ErrPriceNotCached, err)
+	}
+}
+
+func TestSyncPrices(t *testing.T) {
+	store, err := NewPriceStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hour := time.Unix(1689998400, 0).UTC()
+
+	exchange := rangeExchange{
+		prices: []ExchangePrice{{Value: 1810, Time: hour, Source: CryptoCompareSource}},
+		step:   time.Hour,
+	}
+
+	synced, err := SyncPrices(store, exchange, Ethereum, USD, hour, hour.Add(59*time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if synced != 60 {
+		t.Errorf("expected: %d, got: %d", 60, synced)
+	}
+
+	cached, err := NewCachedExchange(nil, store, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, err := cached.HistoricalPrice(Ethereum, USD, hour.Add(42*time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price.Value != 1810 {
+		t.Errorf("expected: %f, got: %f", 1810.0, price.Value)
+	}
+}
+
+func TestPriceStore_FlushAndEvict(t *testing.T) {
+	dir := path.Join(t.TempDir(), "prices")
+
+	store, err := NewPriceStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the price dir to be created on the first write, got: %v", err)
+	}
+
+	store.MaxDays = 1
+	first := time.Date(2023, 7, 22, 0, 0, 0, 0, time.UTC)
+
+	err = store.Put(Ethereum, USD, first, ExchangePrice{Value: 1, Source: CoinbaseSource})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// moving to the next day writes and drops the first one without a flush
+	err = store.Put(Ethereum, USD, first.Add(24*time.Hour), ExchangePrice{Value: 2, Source: CoinbaseSource})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path.Join(dir, "ETH-USD", "2023-07-22.csv")); err != nil {
+		t.Errorf("expected the first day to be written: %v", err)
+	}
+
+	if len(store.days) != 1 {
+		t.Errorf("expected: %d, got: %d", 1, len(store.days))
+	}
+
+	price, ok, err := store.Get(Ethereum, USD, first)
+
+	if err != nil || !ok || price.Value != 1 {
+		t.Errorf("expected the evicted day to be reloaded, got: %+v (%v)", price, err)
+	}
+
+	store.FlushEvery = 2
+
+	for i := 0; i < 2; i++ {
+		err = store.Put(Ethereum, USD, first.Add(time.Duration(i+1)*time.Minute), ExchangePrice{Value: 3, Source: CoinbaseSource})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if store.dirty[path.Join(dir, "ETH-USD", "2023-07-22.csv")] != 0 {
+		t.Errorf("expected the day to be written after %d prices", store.FlushEvery)
+	}
+}
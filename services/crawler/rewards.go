@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// bump when the user reward row changes shape
+	UserRewardVersion = 1
+)
+
+// LedgerEntryType is a manager log that changes a user's stake
+type LedgerEntryType string
+
+const (
+	// user deposit, the amount is after fees
+	LedgerDeposit LedgerEntryType = "deposit"
+	// user withdrawal request, the stake is debited when requested
+	LedgerWithdrawal LedgerEntryType = "withdrawal"
+	// beacon balance report, the amount is after fees
+	LedgerRebalance LedgerEntryType = "rebalance"
+	// execution rewards distributed to stakers, the amount is after fees
+	LedgerRewards LedgerEntryType = "rewards"
+)
+
+// LedgerEntry is a single stake changing log emitted by the CasimirManager
+type LedgerEntry struct {
+	Type     LedgerEntryType
+	Address  common.Address
+	Amount   *big.Int
+	Height   uint64
+	Block    common.Hash
+	LogIndex uint
+}
+
+// StakeReader is the subset of the manager caller used to compute rewards
+type StakeReader interface {
+	GetUserStake(opts *bind.CallOpts, userAddress common.Address) (*big.Int, error)
+	FeePercent(opts *bind.CallOpts) (uint32, error)
+}
+
+// UserReward is a user's stake and cumulative rewards at a rebalance or rewards checkpoint
+type UserReward struct {
+	Chain          ChainType   `json:"chain"`
+	Network        NetworkType `json:"network"`
+	Contract       string      `json:"contract"`
+	Version        int         `json:"version"`
+	Address        string      `json:"address"`
+	Height         uint64      `json:"height"`
+	Block          string      `json:"block"`
+	ReceivedAt     uint64      `json:"received_at"`
+	Stake          string      `json:"stake"`
+	Deposits       string      `json:"deposits"`
+	Withdrawals    string      `json:"withdrawals"`
+	RewardsAllTime string      `json:"rewards_all_time"`
+	StakingFees    string      `json:"staking_fees"`
+}
+
+// RewardsIndex answers the latest rewards of a user at a height
+type RewardsIndex struct {
+	mu    sync.RWMutex
+	users map[common.Address][]UserReward
+}
+
+// UserLedger is the running total of a user's deposits, withdrawals, fees and rewards and the latest stake read
+type UserLedger struct {
+	Address     common.Address `json:"address"`
+	Deposits    *big.Int       `json:"deposits"`
+	Withdrawals *big.Int       `json:"withdrawals"`
+	Fees        *big.Int       `json:"fees"`
+	Rewards     *big.Int       `json:"rewards"`
+	// stake at the latest checkpoint, nil before the first one
+	Stake  *big.Int `json:"stake"`
+	Height uint64   `json:"height"`
+	Block  string   `json:"block"`
+	// set by a deposit after the latest checkpoint, a user without stake is only read again once it deposits
+	Stale bool `json:"stale"`
+}
+
+// Latest returns the user's rewards at the latest checkpoint
+func (l *UserLedger) Latest() (UserReward, bool) {
+	if l.Stake == nil {
+		return UserReward{}, false
+	}
+
+	return UserReward{
+		Version:        UserRewardVersion,
+		Address:        l.Address.Hex(),
+		Height:         l.Height,
+		Block:          l.Block,
+		Stake:          l.Stake.String(),
+		Deposits:       l.Deposits.String(),
+		Withdrawals:    l.Withdrawals.String(),
+		RewardsAllTime: l.Rewards.String(),
+		StakingFees:    l.Fees.String(),
+	}, true
+}
+
+// RewardsState is the rewards computed up to a block, saved between syncs so a sync only reads the
+// ledger and user stakes after it. Only the latest rewards of each user are kept, the history is in the
+// rewards table
+type RewardsState struct {
+	Contract string `json:"contract"`
+	// last block whose ledger entries are applied
+	Height  uint64        `json:"height"`
+	Synced  bool          `json:"synced"`
+	Ledgers []*UserLedger `json:"ledgers"`
+}
+
+// Latest returns the rewards of every user at its latest checkpoint
+func (r *RewardsState) Latest() []UserReward {
+	var rewards []UserReward
+
+	for _, ledger := range r.Ledgers {
+		if reward, ok := ledger.Latest(); ok {
+			rewards = append(rewards, reward)
+		}
+	}
+
+	return rewards
+}
+
+// FetchLedger returns every stake changing manager log between from and to ordered by height and log index,
+// the range is read in windows the provider accepts
+func FetchLedger(ctx context.Context, scanner *LogScanner, filterer *MainFilterer, from, to uint64) ([]LedgerEntry, error) {
+	parsed, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LedgerEntry
+
+	err = scanner.Scan(ctx, from, to, func(logs []types.Log, _, _ uint64) error {
+		for _, log := range logs {
+			if len(log.Topics) == 0 {
+				continue
+			}
+
+			var entry *LedgerEntry
+
+			switch log.Topics[0] {
+			case parsed.Events["StakeDeposited"].ID:
+				e, err := filterer.ParseStakeDeposited(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse StakeDeposited: %s", err.Error())
+				}
+
+				entry = &LedgerEntry{LedgerDeposit, e.Sender, e.Amount, log.BlockNumber, log.BlockHash, log.Index}
+			// WithdrawalInitiated follows a request for the same amount, only the request moves stake
+			case parsed.Events["WithdrawalRequested"].ID:
+				e, err := filterer.ParseWithdrawalRequested(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse WithdrawalRequested: %s", err.Error())
+				}
+
+				entry = &LedgerEntry{LedgerWithdrawal, e.Sender, e.Amount, log.BlockNumber, log.BlockHash, log.Index}
+			case parsed.Events["StakeRebalanced"].ID:
+				e, err := filterer.ParseStakeRebalanced(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse StakeRebalanced: %s", err.Error())
+				}
+
+				entry = &LedgerEntry{LedgerRebalance, common.Address{}, e.Amount, log.BlockNumber, log.BlockHash, log.Index}
+			case parsed.Events["RewardsDeposited"].ID:
+				e, err := filterer.ParseRewardsDeposited(log)
+
+				if err != nil {
+					return fmt.Errorf("failed to parse RewardsDeposited: %s", err.Error())
+				}
+
+				entry = &LedgerEntry{LedgerRewards, common.Address{}, e.Amount, log.BlockNumber, log.BlockHash, log.Index}
+			}
+
+			if entry != nil && !log.Removed {
+				entries = append(entries, *entry)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	SortLedger(entries)
+
+	return entries, nil
+}
+
+func SortLedger(entries []LedgerEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Height != entries[j].Height {
+			return entries[i].Height < entries[j].Height
+		}
+		return entries[i].LogIndex < entries[j].LogIndex
+	})
+}
+
+// ComputeUserRewards reads the stake of every user seen so far at the end of each block with a rebalance or
+// rewards log, users left without stake are skipped until they deposit again. Rewards are the stake minus net deposits (deposits - withdrawals), fees are the deposit fees
+// plus the fee share of each reward increase, both derived from the fee percent at the block.
+func ComputeUserRewards(reader StakeReader, entries []LedgerEntry) ([]UserReward, error) {
+	return (&RewardsState{}).Apply(reader, entries)
+}
+
+// Apply computes the rewards of the entries on top of the state's ledgers, the ledgers keep the latest rewards
+func (r *RewardsState) Apply(reader StakeReader, entries []LedgerEntry) ([]UserReward, error) {
+	var results []UserReward
+
+	ledgers := make(map[common.Address]*UserLedger)
+
+	for _, ledger := range r.Ledgers {
+		ledgers[ledger.Address] = ledger
+	}
+
+	checkpoint := false
+
+	for i, entry := range entries {
+		switch entry.Type {
+		case LedgerDeposit, LedgerWithdrawal:
+			ledger, ok := ledgers[entry.Address]
+
+			if !ok {
+				ledger = &UserLedger{Address: entry.Address, Deposits: new(big.Int), Withdrawals: new(big.Int), Fees: new(big.Int), Rewards: new(big.Int)}
+				ledgers[entry.Address] = ledger
+				r.Ledgers = append(r.Ledgers, ledger)
+			}
+
+			if entry.Type == LedgerWithdrawal {
+				ledger.Withdrawals.Add(ledger.Withdrawals, entry.Amount)
+				break
+			}
+
+			fee, err := feePercentAt(reader, entry.Height)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ledger.Deposits.Add(ledger.Deposits, entry.Amount)
+			ledger.Fees.Add(ledger.Fees, FeeOf(entry.Amount, fee))
+			ledger.Stale = true
+		case LedgerRebalance, LedgerRewards:
+			checkpoint = true
+		default:
+			return nil, fmt.Errorf("unknown ledger entry type: %s", entry.Type)
+		}
+
+		// calls at a height read the state at the end of the block, so sample once every log of the block is applied
+		if !checkpoint || (i+1 < len(entries) && entries[i+1].Height == entry.Height) {
+			continue
+		}
+
+		checkpoint = false
+
+		if len(r.Ledgers) == 0 {
+			continue
+		}
+
+		fee, err := feePercentAt(reader, entry.Height)
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts := &bind.CallOpts{BlockNumber: new(big.Int).SetUint64(entry.Height), Context: context.Background()}
+
+		for _, ledger := range r.Ledgers {
+			// rewards are shared by stake, a user without stake doesn't earn until it deposits
+			if ledger.Stake != nil && ledger.Stake.Sign() == 0 && !ledger.Stale {
+				continue
+			}
+
+			stake, err := reader.GetUserStake(opts, ledger.Address)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to get user stake address=%s block=%d: %s", ledger.Address.Hex(), entry.Height, err.Error())
+			}
+
+			rewards := new(big.Int).Sub(stake, ledger.Deposits)
+			rewards.Add(rewards, ledger.Withdrawals)
+
+			gain := new(big.Int).Sub(rewards, ledger.Rewards)
+
+			if gain.Sign() > 0 {
+				ledger.Fees.Add(ledger.Fees, FeeOf(gain, fee))
+			}
+
+			ledger.Rewards = rewards
+			ledger.Stake = stake
+			ledger.Height = entry.Height
+			ledger.Block = entry.Block.Hex()
+			ledger.Stale = false
+
+			reward, _ := ledger.Latest()
+			results = append(results, reward)
+		}
+	}
+
+	return results, nil
+}
+
+// RewardsStateFile returns the file of the saved rewards state of a network
+func RewardsStateFile(dir string, network NetworkType) string {
+	return path.Join(dir, fmt.Sprintf("%s-%s-rewards.json", Ethereum, network))
+}
+
+// LoadRewardsState reads the saved rewards state of the contract, a missing file or a state of another
+// contract starts over
+func LoadRewardsState(file string, contract string) (*RewardsState, error) {
+	state := &RewardsState{Contract: contract}
+
+	data, err := os.ReadFile(file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var saved RewardsState
+
+	err = json.Unmarshal(data, &saved)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rewards state=%s: %s", file, err.Error())
+	}
+
+	if saved.Contract != contract {
+		return state, nil
+	}
+
+	return &saved, nil
+}
+
+// Save writes the state to a temporary file and renames it so a crash never leaves a partial state
+func (r *RewardsState) Save(file string) error {
+	return SaveJSON(file, r)
+}
+
+// SaveJSON writes v to a temporary file next to file and renames it over file
+func SaveJSON(file string, v any) error {
+	err := os.MkdirAll(path.Dir(file), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(file+".tmp", encoded, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file+".tmp", file)
+}
+
+func feePercentAt(reader StakeReader, height uint64) (uint32, error) {
+	fee, err := reader.FeePercent(&bind.CallOpts{BlockNumber: new(big.Int).SetUint64(height), Context: context.Background()})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get fee percent at block=%d: %s", height, err.Error())
+	}
+
+	return fee, nil
+}
+
+// FeeOf returns the fee charged on an amount after fees, the manager keeps amount * 100 / (100 + fee)
+func FeeOf(amountAfterFees *big.Int, feePercent uint32) *big.Int {
+	fee := new(big.Int).Mul(amountAfterFees, big.NewInt(int64(feePercent)))
+	return fee.Div(fee, big.NewInt(100))
+}
+
+func NewRewardsIndex(rewards []UserReward) *RewardsIndex {
+	index := &RewardsIndex{users: make(map[common.Address][]UserReward)}
+
+	for _, r := range rewards {
+		address := common.HexToAddress(r.Address)
+		index.users[address] = append(index.users[address], r)
+	}
+
+	for _, history := range index.users {
+		sort.SliceStable(history, func(i, j int) bool {
+			return history[i].Height < history[j].Height
+		})
+	}
+
+	return index
+}
+
+// At returns the latest rewards of the address at or before the height
+func (r *RewardsIndex) At(address common.Address, height uint64) (UserReward, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := r.users[address]
+
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].Height > height
+	})
+
+	if i == 0 {
+		return UserReward{}, false
+	}
+
+	return history[i-1], true
+}
+
+// Apply fills the rewards fields of an action from the index
+func (r *RewardsIndex) Apply(action *Action, height uint64) {
+	if action.Address == "" || !common.IsHexAddress(action.Address) {
+		return
+	}
+
+	reward, ok := r.At(common.HexToAddress(action.Address), height)
+
+	if !ok {
+		return
+	}
+
+	action.RewardsAllTime = reward.RewardsAllTime
+	action.StakingFees = reward.StakingFees
+}
+
+// SyncRewards computes the rewards of every manager user between from and to, uploads them to the
+// rewards table when it exists and indexes them so crawled actions get their rewards fields. The state is
+// saved in the checkpoint dir, so a sync continues after the last synced block instead of starting over.
+func (c *EthereumCrawler) SyncRewards(from, to uint64) error {
+	l := c.Logger.Sugar()
+
+	address, err := c.Manager()
+
+	if err != nil {
+		return err
+	}
+
+	manager, err := NewMain(address, c.Client)
+
+	if err != nil {
+		return err
+	}
+
+	file := ""
+	state := &RewardsState{Contract: address.Hex()}
+
+	if c.Config.CheckpointDir != "" {
+		file = RewardsStateFile(c.Config.CheckpointDir, c.Config.Network)
+
+		state, err = LoadRewardsState(file, address.Hex())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if state.Synced {
+		if from > state.Height+1 {
+			return fmt.Errorf("rewards are synced to block=%d, syncing from=%d would skip ledger entries", state.Height, from)
+		}
+
+		from = state.Height + 1
+	}
+
+	if from > to {
+		l.Infof("rewards are synced to block=%d contract=%s", state.Height, address.Hex())
+		c.Rewards = NewRewardsIndex(state.Latest())
+		return nil
+	}
+
+	scanner := NewLogScanner(c.Client, DefaultLogWindow, func() []common.Address { return []common.Address{address} })
+
+	entries, err := FetchLedger(context.Background(), scanner, &manager.MainFilterer, from, to)
+
+	if err != nil {
+		return err
+	}
+
+	l.Infof("found %d manager ledger entries contract=%s from=%d to=%d", len(entries), address.Hex(), from, to)
+
+	// crawled heights before this sync get the latest rewards of the state, the history is in the rewards table
+	previous := state.Latest()
+
+	rewards, err := state.Apply(&manager.MainCaller, entries)
+
+	if err != nil {
+		return err
+	}
+
+	upload := c.Glue.RewardsMeta.Bucket != ""
+
+	if !upload {
+		l.Warnf("user rewards table not found, rewards will be indexed but not uploaded")
+	}
+
+	byHeight := make(map[uint64][]UserReward)
+	var heights []uint64
+
+	for _, r := range rewards {
+		if _, ok := byHeight[r.Height]; !ok {
+			heights = append(heights, r.Height)
+		}
+		byHeight[r.Height] = append(byHeight[r.Height], r)
+	}
+
+	for _, height := range heights {
+		header, err := c.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(height))
+
+		if err != nil {
+			return fmt.Errorf("failed to get header=%d: %s", height, err.Error())
+		}
+
+		rows := byHeight[height]
+
+		for i := range rows {
+			rows[i].Chain = Ethereum
+			rows[i].Network = c.Config.Network
+			rows[i].Contract = address.Hex()
+			rows[i].ReceivedAt = header.Time
+		}
+
+		if !upload {
+			continue
+		}
+
+		encoded, err := EncodePartition(rows, c.Config.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		tt := time.Unix(int64(header.Time), 0)
+
+		partition := Partition{
+			Chain:   Ethereum,
+			Network: c.Config.Network,
+			Year:    fmt.Sprintf("%04d", tt.Year()),
+			Month:   fmt.Sprintf("%02d", tt.Month()),
+			Block:   height,
+		}
+
+		key := c.Config.Compression.PartitionKey(partition)
+
+		err = c.UploadPartition(c.Glue.RewardsMeta.Bucket, key, encoded, header.Hash().Hex())
+
+		if err != nil {
+			return err
+		}
+
+		l.Infof("uploaded %d user rewards block=%d to partition=%s", len(rows), height, key)
+	}
+
+	state.Height = to
+	state.Synced = true
+
+	if file != "" {
+		err = state.Save(file)
+
+		if err != nil {
+			return fmt.Errorf("failed to save rewards state: %s", err.Error())
+		}
+	}
+
+	c.Rewards = NewRewardsIndex(append(previous, rewards...))
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// stakeReader returns canned user stakes keyed by block and a fixed fee percent
+type stakeReader struct {
+	fee    uint32
+	stakes map[uint64]map[common.Address]int64
+	calls  *int
+}
+
+func (s stakeReader) GetUserStake(opts *bind.CallOpts, user common.Address) (*big.Int, error) {
+	if s.calls != nil {
+		*s.calls++
+	}
+
+	stake, ok := s.stakes[opts.BlockNumber.Uint64()][user]
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected stake call block=%d address=%s", opts.BlockNumber.Uint64(), user.Hex())
+	}
+
+	return big.NewInt(stake), nil
+}
+
+func (s stakeReader) FeePercent(opts *bind.CallOpts) (uint32, error) {
+	return s.fee, nil
+}
+
+func TestComputeUserRewards(t *testing.T) {
+	alice := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+	entries := []LedgerEntry{
+		{Type: LedgerRebalance, Amount: big.NewInt(10), Height: 20, LogIndex: 0},
+		{Type: LedgerDeposit, Address: alice, Amount: big.NewInt(1000), Height: 10, LogIndex: 0},
+		// bob deposits after the rebalance in the same block, the stake read includes his deposit
+		{Type: LedgerDeposit, Address: bob, Amount: big.NewInt(500), Height: 20, LogIndex: 1},
+		{Type: LedgerWithdrawal, Address: alice, Amount: big.NewInt(200), Height: 25, LogIndex: 0},
+		{Type: LedgerRewards, Amount: big.NewInt(30), Height: 30, LogIndex: 0},
+	}
+
+	SortLedger(entries)
+
+	reader := stakeReader{
+		fee: 5,
+		stakes: map[uint64]map[common.Address]int64{
+			20: {alice: 1100, bob: 500},
+			30: {alice: 920, bob: 510},
+		},
+	}
+
+	rewards, err := ComputeUserRewards(reader, entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rewards) != 4 {
+		t.Fatalf("expected: %d, got: %d", 4, len(rewards))
+	}
+
+	expected := []struct {
+		address common.Address
+		height  uint64
+		rewards string
+		fees    string
+	}{
+		// 50 deposit fee + 5% of 100
+		{alice, 20, "100", "55"},
+		{bob, 20, "0", "25"},
+		// 920 - 1000 + 200, 20 more rewards
+		{alice, 30, "120", "56"},
+		{bob, 30, "10", "25"},
+	}
+
+	for i, e := range expected {
+		r := rewards[i]
+
+		if r.Address != e.address.Hex() || r.Height != e.height || r.RewardsAllTime != e.rewards || r.StakingFees != e.fees {
+			t.Errorf("expected: %+v, got: %+v", e, r)
+		}
+	}
+
+	index := NewRewardsIndex(rewards)
+
+	action := Action{Address: alice.Hex()}
+	index.Apply(&action, 29)
+
+	if action.RewardsAllTime != "100" || action.StakingFees != "55" {
+		t.Errorf("unexpected action rewards: %+v", action)
+	}
+
+	before := Action{Address: alice.Hex()}
+	index.Apply(&before, 19)
+
+	if before.RewardsAllTime != "" {
+		t.Errorf("expected no rewards before the first checkpoint, got: %s", before.RewardsAllTime)
+	}
+}
+
+func TestComputeUserRewardsSkipsEmptyStakes(t *testing.T) {
+	alice := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	entries := []LedgerEntry{
+		{Type: LedgerDeposit, Address: alice, Amount: big.NewInt(1000), Height: 10},
+		{Type: LedgerWithdrawal, Address: alice, Amount: big.NewInt(1000), Height: 15},
+		{Type: LedgerRebalance, Amount: big.NewInt(10), Height: 20},
+		// alice has no stake, the checkpoint doesn't read it again
+		{Type: LedgerRewards, Amount: big.NewInt(10), Height: 30},
+		{Type: LedgerDeposit, Address: alice, Amount: big.NewInt(500), Height: 35},
+		{Type: LedgerRewards, Amount: big.NewInt(10), Height: 40},
+	}
+
+	calls := 0
+
+	reader := stakeReader{
+		calls: &calls,
+		stakes: map[uint64]map[common.Address]int64{
+			20: {alice: 0},
+			40: {alice: 505},
+		},
+	}
+
+	rewards, err := ComputeUserRewards(reader, entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rewards) != 2 || calls != 2 {
+		t.Fatalf("expected 2 rewards from 2 stake calls, got: %d rewards, %d calls", len(rewards), calls)
+	}
+
+	if rewards[1].Height != 40 || rewards[1].RewardsAllTime != "5" {
+		t.Errorf("unexpected rewards after the new deposit: %+v", rewards[1])
+	}
+}
+
+// ledgerFilterer serves manager logs and rejects ranges wider than limit blocks
+type ledgerFilterer struct {
+	limit uint64
+	logs  []types.Log
+}
+
+func (f *ledgerFilterer) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+
+	if to-from+1 > f.limit {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	var logs []types.Log
+
+	for _, log := range f.logs {
+		if log.BlockNumber >= from && log.BlockNumber <= to {
+			logs = append(logs, log)
+		}
+	}
+
+	return logs, nil
+}
+
+func (f *ledgerFilterer) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not implemented")
+}
+
+func managerLog(t *testing.T, event string, height uint64, index uint, sender *common.Address, amount int64) types.Log {
+	parsed, err := MainMetaData.GetAbi()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := parsed.Events[event].Inputs.NonIndexed().Pack(big.NewInt(amount))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topics := []common.Hash{parsed.Events[event].ID}
+
+	if sender != nil {
+		topics = append(topics, common.BytesToHash(sender.Bytes()))
+	}
+
+	return types.Log{Topics: topics, Data: data, BlockNumber: height, Index: index}
+}
+
+func TestRewardsState(t *testing.T) {
+	alice := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+	filterer := &ledgerFilterer{
+		limit: 8,
+		logs: []types.Log{
+			managerLog(t, "StakeDeposited", 10, 0, &alice, 1000),
+			managerLog(t, "StakeRebalanced", 20, 0, nil, 10),
+			managerLog(t, "StakeDeposited", 20, 1, &bob, 500),
+			managerLog(t, "WithdrawalRequested", 25, 0, &alice, 200),
+			managerLog(t, "RewardsDeposited", 30, 0, nil, 30),
+		},
+	}
+
+	manager, err := NewMainFilterer(common.Address{}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+
+	reader := stakeReader{
+		fee:   5,
+		calls: &calls,
+		stakes: map[uint64]map[common.Address]int64{
+			20: {alice: 1100, bob: 500},
+			30: {alice: 920, bob: 510},
+		},
+	}
+
+	scanner := NewLogScanner(filterer, 100, func() []common.Address { return nil })
+	file := path.Join(t.TempDir(), "rewards.json")
+
+	// the first sync stops before the rewards log, the second continues from the saved state
+	for _, r := range []BlockRange{{From: 0, To: 27}, {From: 28, To: 40}} {
+		state, err := LoadRewardsState(file, "0xmanager")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := FetchLedger(context.Background(), scanner, manager, r.From, r.To)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rewards, err := state.Apply(reader, entries)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rewards) != 2 {
+			t.Fatalf("expected: %d, got: %d", 2, len(rewards))
+		}
+
+		state.Height = r.To
+		state.Synced = true
+
+		err = state.Save(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state, err := LoadRewardsState(file, "0xmanager")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := state.Latest()
+
+	if len(latest) != 2 || calls != 4 || state.Height != 40 {
+		t.Fatalf("expected the latest rewards of 2 users from 4 stake calls up to block 40, got: %d rewards, %d calls, height=%d", len(latest), calls, state.Height)
+	}
+
+	last := latest[0]
+
+	if last.Address != alice.Hex() || last.Height != 30 || last.RewardsAllTime != "120" || last.StakingFees != "56" {
+		t.Errorf("unexpected rewards after resuming: %+v", last)
+	}
+
+	other, err := LoadRewardsState(file, "0xother")
+
+	if err != nil || other.Synced || len(other.Ledgers) != 0 {
+		t.Errorf("expected the state of another contract to start over, got: %+v (%v)", other, err)
+	}
+}
@@ -3,27 +3,95 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// parts smaller than 5 MiB are rejected by s3
+	MinUploadPartSize        = manager.MinUploadPartSize
+	DefaultUploadPartSize    = 16 * 1024 * 1024
+	DefaultUploadConcurrency = manager.DefaultUploadConcurrency
 )
 
 type S3Service struct {
 	Client *s3.Client
+	// multipart uploads of objects larger than a part, incomplete uploads are aborted on failure
+	Uploader *manager.Uploader
+	// tagged on every uploaded object
+	Env Env
+	// when set every key is prefixed with user=<namespace>/ so developers don't overwrite each other's data
+	Namespace string
 }
 
 func NewS3Service(config *aws.Config) (*S3Service, error) {
 	client := s3.NewFromConfig(*config)
 
 	return &S3Service{
-		Client: client,
+		Client:   client,
+		Uploader: NewUploader(client, DefaultUploadPartSize, DefaultUploadConcurrency),
 	}, nil
 }
 
+// NewUploader returns an s3 upload manager splitting objects into parts of partSize bytes uploaded concurrency at a time
+func NewUploader(client manager.UploadAPIClient, partSize int64, concurrency int) *manager.Uploader {
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+		u.LeavePartsOnError = false
+	})
+}
+
+// ConfigureUploads sets the part size and concurrency of multipart uploads
+func (s *S3Service) ConfigureUploads(partSize int64, concurrency int) error {
+	if partSize < MinUploadPartSize {
+		return fmt.Errorf("upload part size must be at least %d bytes, got: %d", MinUploadPartSize, partSize)
+	}
+
+	if concurrency < 1 {
+		return fmt.Errorf("upload concurrency must be at least 1, got: %d", concurrency)
+	}
+
+	s.Uploader = NewUploader(s.Client, partSize, concurrency)
+	return nil
+}
+
+func (s *S3Service) key(key string) string {
+	if s.Namespace == "" {
+		return key
+	}
+	return fmt.Sprintf("user=%s/%s", s.Namespace, key)
+}
+
+// tagging returns the object tags of uploads, nil when the service has no environment
+func (s *S3Service) tagging() *string {
+	if s.Env == "" {
+		return nil
+	}
+
+	tags := url.Values{}
+	tags.Set("env", string(s.Env))
+
+	if s.Namespace != "" {
+		tags.Set("user", s.Namespace)
+	}
+
+	return aws.String(tags.Encode())
+}
+
 func (s *S3Service) UploadFile(bucket string, key string, fpath string) error {
 	var err error
 
@@ -36,9 +104,10 @@ func (s *S3Service) UploadFile(bucket string, key string, fpath string) error {
 	defer file.Close()
 
 	opt := &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   file,
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(s.key(key)),
+		Body:    file,
+		Tagging: s.tagging(),
 	}
 
 	_, err = s.Client.PutObject(context.Background(), opt)
@@ -49,23 +118,242 @@ func (s *S3Service) UploadFile(bucket string, key string, fpath string) error {
 	return nil
 }
 
-func (s *S3Service) UploadBytes(bucket string, key string, data *bytes.Buffer) error {
+// MultipartUploadFile streams a file to s3 in parts, the file's sha256 is recorded as metadata
+func (s *S3Service) MultipartUploadFile(bucket, key, fpath string) error {
+	file, err := os.Open(fpath)
+
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %v", fpath, err)
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+
+	if err != nil {
+		return fmt.Errorf("failed to hash file %q: %v", fpath, err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	meta := ObjectMeta{
+		SHA256:         hex.EncodeToString(hash.Sum(nil)),
+		CrawlerVersion: CrawlerVersion,
+		SchemaVersion:  SchemaVersion,
+	}
+
+	return s.Upload(bucket, key, file, meta)
+}
+
+// Upload streams the reader to s3, objects larger than the part size are uploaded in parts and
+// the parts of a failed upload are aborted. The sha256 of a streamed object is usually unknown upfront
+// and can be left empty.
+func (s *S3Service) Upload(bucket, key string, body io.Reader, meta ObjectMeta) error {
 	opt := &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   bytes.NewReader(data.Bytes()),
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(s.key(key)),
+		Body:              body,
+		Metadata:          meta.Map(),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		Tagging:           s.tagging(),
+	}
+
+	if meta.ContentEncoding != "" {
+		opt.ContentEncoding = aws.String(meta.ContentEncoding)
 	}
 
-	_, err := s.Client.PutObject(context.Background(), opt)
+	_, err := s.Uploader.Upload(context.Background(), opt)
+
+	var multipart manager.MultiUploadFailure
+
+	if errors.As(err, &multipart) {
+		return fmt.Errorf("failed multipart upload id=%s key=%s, parts were aborted: %v", multipart.UploadID(), key, err)
+	}
 
 	if err != nil {
-		return fmt.Errorf("failed to put object: %v", err)
+		return fmt.Errorf("failed to upload object: %v", err)
 	}
+
 	return nil
 }
 
-func (s *S3Service) MultipartUploadFile(bucket, key, fpath string) error {
-	return s.UploadFile(bucket, key, fpath)
+// UploadStream uploads what write writes without buffering the object, e.g. rows encoded straight into a compressor
+func (s *S3Service) UploadStream(bucket, key string, meta ObjectMeta, write func(w io.Writer) error) error {
+	reader, writer := io.Pipe()
+
+	go func() {
+		// the upload fails with the write error when the writer fails
+		writer.CloseWithError(write(writer))
+	}()
+
+	err := s.Upload(bucket, key, reader, meta)
+
+	// unblocks the writer when the upload stopped reading early
+	reader.CloseWithError(io.ErrClosedPipe)
+
+	return err
+}
+
+const (
+	// user metadata keys attached to every uploaded object
+	SHA256MetaKey         = "sha256"
+	CrawlerVersionMetaKey = "crawler-version"
+	SchemaVersionMetaKey  = "schema-version"
+	BlockHashMetaKey      = "block-hash"
+)
+
+type UploadStatus string
+
+const (
+	// the object didn't exist or its content changed
+	Uploaded UploadStatus = "uploaded"
+	// the object already has identical content
+	Unchanged UploadStatus = "unchanged"
+	// the object was overwritten with the content of a different block at the same height
+	Reorged UploadStatus = "reorged"
+)
+
+// ObjectMeta is the metadata recorded on an uploaded object, the block hash is empty for objects not tied to a block
+type ObjectMeta struct {
+	SHA256         string
+	CrawlerVersion string
+	SchemaVersion  string
+	BlockHash      string
+	// set on compressed objects, not recorded as user metadata
+	ContentEncoding string
+}
+
+// NewObjectMeta hashes the content of an object about to be uploaded
+func NewObjectMeta(data []byte, blockHash string) ObjectMeta {
+	sum := sha256.Sum256(data)
+
+	return ObjectMeta{
+		SHA256:         hex.EncodeToString(sum[:]),
+		CrawlerVersion: CrawlerVersion,
+		SchemaVersion:  SchemaVersion,
+		BlockHash:      blockHash,
+	}
+}
+
+// Map returns the metadata as s3 user metadata
+func (m ObjectMeta) Map() map[string]string {
+	meta := map[string]string{
+		CrawlerVersionMetaKey: m.CrawlerVersion,
+		SchemaVersionMetaKey:  m.SchemaVersion,
+	}
+
+	if m.SHA256 != "" {
+		meta[SHA256MetaKey] = m.SHA256
+	}
+
+	if m.BlockHash != "" {
+		meta[BlockHashMetaKey] = m.BlockHash
+	}
+
+	return meta
+}
+
+// CompareUpload decides how to upload an object given the metadata of the existing object (nil when there is none),
+// identical content is skipped and a different recorded block hash means the height was reorged since the last upload
+func CompareUpload(existing map[string]string, meta ObjectMeta) UploadStatus {
+	if existing == nil {
+		return Uploaded
+	}
+
+	if meta.SHA256 != "" && existing[SHA256MetaKey] == meta.SHA256 {
+		return Unchanged
+	}
+
+	if existing[BlockHashMetaKey] != "" && meta.BlockHash != "" && existing[BlockHashMetaKey] != meta.BlockHash {
+		return Reorged
+	}
+
+	return Uploaded
+}
+
+// UploadBytes uploads the data unless the object already holds identical content
+func (s *S3Service) UploadBytes(bucket string, key string, data *bytes.Buffer) error {
+	_, err := s.UploadObject(bucket, key, data, NewObjectMeta(data.Bytes(), ""))
+	return err
+}
+
+// UploadObject uploads the data with its metadata and a sha256 checksum s3 verifies on write, the upload is skipped
+// when the existing object has the same content hash
+func (s *S3Service) UploadObject(bucket string, key string, data *bytes.Buffer, meta ObjectMeta) (UploadStatus, error) {
+	existing, err := s.HeadMetadata(bucket, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	status := CompareUpload(existing, meta)
+
+	if status == Unchanged {
+		return status, nil
+	}
+
+	sum, err := hex.DecodeString(meta.SHA256)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid sha256 for key=%s: %v", key, err)
+	}
+
+	opt := &s3.PutObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(s.key(key)),
+		Body:              bytes.NewReader(data.Bytes()),
+		Metadata:          meta.Map(),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(base64.StdEncoding.EncodeToString(sum)),
+		Tagging:           s.tagging(),
+	}
+
+	if meta.ContentEncoding != "" {
+		opt.ContentEncoding = aws.String(meta.ContentEncoding)
+	}
+
+	if int64(data.Len()) >= s.Uploader.PartSize {
+		// the whole object checksum only applies to single part uploads, parts are checksummed on their own
+		err = s.Upload(bucket, key, bytes.NewReader(data.Bytes()), meta)
+	} else {
+		_, err = s.Client.PutObject(context.Background(), opt)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to put object: %v", err)
+	}
+
+	return status, nil
+}
+
+// HeadMetadata returns the user metadata of an object, nil when the object doesn't exist
+func (s *S3Service) HeadMetadata(bucket, key string) (map[string]string, error) {
+	result, err := s.Client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s.key(key)),
+	})
+
+	var notFound *types.NotFound
+
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to head object: %v", err)
+	}
+
+	if result.Metadata == nil {
+		return map[string]string{}, nil
+	}
+
+	return result.Metadata, nil
 }
 
 func (s *S3Service) Get(bucket, key string) (*bytes.Buffer, error) {
@@ -73,7 +361,7 @@ func (s *S3Service) Get(bucket, key string) (*bytes.Buffer, error) {
 
 	opt := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(s.key(key)),
 	}
 
 	result, err := s.Client.GetObject(context.Background(), opt)
@@ -92,15 +380,32 @@ func (s *S3Service) Get(bucket, key string) (*bytes.Buffer, error) {
 }
 
 func (s *S3Service) ListObjects(bucket, key string) (*[]string, error) {
+	objects, err := s.ListPartitionObjects(bucket, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(objects))
+
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+
+	return &keys, nil
+}
+
+// ListPartitionObjects lists the objects under the key with the time they were last written
+func (s *S3Service) ListPartitionObjects(bucket, key string) ([]PartitionObject, error) {
 	if bucket == "" {
 		return nil, fmt.Errorf("bucket name is empty")
 	}
 
-	var objects []string
+	var objects []PartitionObject
 
 	opt := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
-		Prefix: aws.String(key),
+		Prefix: aws.String(s.key(key)),
 	}
 
 	paginator := s3.NewListObjectsV2Paginator(s.Client, opt)
@@ -113,35 +418,118 @@ func (s *S3Service) ListObjects(bucket, key string) (*[]string, error) {
 		}
 
 		for _, obj := range page.Contents {
-			objects = append(objects, *obj.Key)
+			// keys are returned relative to the namespace so they can be passed back to the other methods
+			objects = append(objects, PartitionObject{
+				Key:      strings.TrimPrefix(*obj.Key, s.key("")),
+				Modified: aws.ToTime(obj.LastModified),
+			})
 		}
 	}
-	return &objects, nil
+	return objects, nil
 }
 
-func (s *S3Service) AlreadyConsumed(bucket, key string) (*[]int64, error) {
-	files, err := s.ListObjects(bucket, key)
+const (
+	// DeleteObjects accepts at most 1000 keys per request
+	MaxDeleteBatch = 1000
+)
+
+// DeletePrefix deletes every object under the prefix in batches and returns the deleted keys,
+// in dry run mode the keys are only listed
+func (s *S3Service) DeletePrefix(bucket, prefix string, dryRun bool) ([]string, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket name is empty")
+	}
+
+	// an empty prefix would empty the bucket
+	if strings.Trim(prefix, "/") == "" {
+		return nil, fmt.Errorf("refusing to delete an empty prefix in bucket=%s", bucket)
+	}
+
+	keys, err := s.ListObjects(bucket, prefix)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects: %v", err)
+		return nil, err
 	}
 
-	consumed := make([]int64, len(*files))
+	if dryRun {
+		return *keys, nil
+	}
 
-	for _, v := range *files {
-		parts := strings.Split(v, "/")
+	return s.DeleteKeys(bucket, *keys)
+}
 
-		block := strings.Split(parts[len(parts)-1], "=")[1]
+// DeleteKeys deletes the objects in batches and returns the deleted keys
+func (s *S3Service) DeleteKeys(bucket string, keys []string) ([]string, error) {
+	var deleted []string
+
+	for _, batch := range BatchKeys(keys, MaxDeleteBatch) {
+		objects := make([]types.ObjectIdentifier, len(batch))
+
+		for i, key := range batch {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(s.key(key))}
+		}
 
-		num, err := strconv.Atoi(strings.Split(block, ".")[0])
+		result, err := s.Client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: true},
+		})
 
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert string to int: %v", err)
+			return deleted, fmt.Errorf("failed to delete objects: %v", err)
 		}
 
-		consumed = append(consumed, int64(num))
+		if len(result.Errors) > 0 {
+			failed := result.Errors[0]
+			return deleted, fmt.Errorf("failed to delete %d objects, key=%s: %s", len(result.Errors), aws.ToString(failed.Key), aws.ToString(failed.Message))
+		}
+
+		deleted = append(deleted, batch...)
 	}
-	return &consumed, nil
+
+	return deleted, nil
+}
+
+// BatchKeys splits keys into batches of at most size keys
+func BatchKeys(keys []string, size int) [][]string {
+	var batches [][]string
+
+	for len(keys) > size {
+		batches = append(batches, keys[:size])
+		keys = keys[size:]
+	}
+
+	if len(keys) > 0 {
+		batches = append(batches, keys)
+	}
+
+	return batches
+}
+
+// AlreadyConsumed returns the sorted block heights of the partitions under the key, keys that aren't block partitions are skipped
+func (s *S3Service) AlreadyConsumed(bucket, key string) ([]uint64, error) {
+	files, err := s.ListObjects(bucket, key)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	consumed := make([]uint64, 0, len(*files))
+
+	for _, v := range *files {
+		height, ok := PartitionHeight(v)
+
+		if !ok {
+			continue
+		}
+
+		consumed = append(consumed, height)
+	}
+
+	sort.Slice(consumed, func(i, j int) bool {
+		return consumed[i] < consumed[j]
+	})
+
+	return consumed, nil
 }
 
 func (s *S3Service) CreatePartition(glues *GlueService, config Config) error {
@@ -163,7 +551,7 @@ func (s *S3Service) CreatePartition(glues *GlueService, config Config) error {
 
 			_, err := s.Client.PutObject(context.Background(), &s3.PutObjectInput{
 				Bucket: aws.String(glues.EventMeta.Bucket),
-				Key:    aws.String(part),
+				Key:    aws.String(s.key(part)),
 			})
 
 			if err != nil {
@@ -172,7 +560,7 @@ func (s *S3Service) CreatePartition(glues *GlueService, config Config) error {
 
 			_, err = s.Client.PutObject(context.Background(), &s3.PutObjectInput{
 				Bucket: aws.String(glues.ActionMeta.Bucket),
-				Key:    aws.String(part),
+				Key:    aws.String(s.key(part)),
 			})
 
 			if err != nil {
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 func TestNewS3Client(t *testing.T) {
@@ -101,6 +109,223 @@ func TestAlreadyConsumed(t *testing.T) {
 	fmt.Printf("# of consumed: %d\n", len(consumed))
 }
 
+func TestNewObjectMeta(t *testing.T) {
+	meta := NewObjectMeta([]byte("hello"), "0xabc")
+
+	// sha256 of "hello"
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	if meta.SHA256 != expected {
+		t.Errorf("expected: %s, got: %s", expected, meta.SHA256)
+	}
+
+	if meta.Map()[BlockHashMetaKey] != "0xabc" || meta.Map()[CrawlerVersionMetaKey] != CrawlerVersion || meta.Map()[SchemaVersionMetaKey] != SchemaVersion {
+		t.Errorf("unexpected metadata: %v", meta.Map())
+	}
+
+	if _, ok := NewObjectMeta([]byte("hello"), "").Map()[BlockHashMetaKey]; ok {
+		t.Errorf("expected no block hash metadata")
+	}
+}
+
+func TestCompareUpload(t *testing.T) {
+	meta := NewObjectMeta([]byte("block"), "0xa")
+
+	cases := []struct {
+		name     string
+		existing map[string]string
+		meta     ObjectMeta
+		expected UploadStatus
+	}{
+		{"missing object", nil, meta, Uploaded},
+		{"identical content", meta.Map(), meta, Unchanged},
+		{"changed content same block", NewObjectMeta([]byte("old"), "0xa").Map(), meta, Uploaded},
+		{"changed block", NewObjectMeta([]byte("old"), "0xb").Map(), meta, Reorged},
+		{"legacy object without metadata", map[string]string{}, meta, Uploaded},
+		{"object not tied to a block", NewObjectMeta([]byte("old"), "0xb").Map(), NewObjectMeta([]byte("new"), ""), Uploaded},
+	}
+
+	for _, c := range cases {
+		status := CompareUpload(c.existing, c.meta)
+
+		if status != c.expected {
+			t.Errorf("%s: expected: %s, got: %s", c.name, c.expected, status)
+		}
+	}
+}
+
+// uploadClient records the requests of the s3 upload manager, failPart makes that part number fail
+type uploadClient struct {
+	mu       sync.Mutex
+	puts     int
+	parts    map[int32]int
+	metadata map[string]string
+	aborted  bool
+	failPart int32
+}
+
+func (c *uploadClient) PutObject(ctx context.Context, in *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.puts++
+	c.metadata = in.Metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *uploadClient) UploadPart(ctx context.Context, in *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(in.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if in.PartNumber == c.failPart {
+		return nil, errors.New("part failed")
+	}
+
+	c.parts[in.PartNumber] = len(data)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprint(in.PartNumber))}, nil
+}
+
+func (c *uploadClient) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metadata = in.Metadata
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (c *uploadClient) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *uploadClient) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, opts ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestUploadStream(t *testing.T) {
+	client := &uploadClient{parts: make(map[int32]int)}
+	s3c := &S3Service{Uploader: NewUploader(client, MinUploadPartSize, 2)}
+
+	size := int(MinUploadPartSize)*2 + 1024
+
+	err := s3c.UploadStream("bucket", "key", ObjectMeta{CrawlerVersion: CrawlerVersion}, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(make([]byte, size)))
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.parts) != 3 || client.parts[3] != 1024 {
+		t.Errorf("expected: %d parts, got: %v", 3, client.parts)
+	}
+
+	if client.metadata[CrawlerVersionMetaKey] != CrawlerVersion {
+		t.Errorf("expected: %s, got: %v", CrawlerVersion, client.metadata)
+	}
+
+	small := &uploadClient{parts: make(map[int32]int)}
+	s3c.Uploader = NewUploader(small, MinUploadPartSize, 2)
+
+	err = s3c.Upload("bucket", "key", strings.NewReader("row\n"), ObjectMeta{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if small.puts != 1 || len(small.parts) != 0 {
+		t.Errorf("expected a single put, got: puts=%d parts=%v", small.puts, small.parts)
+	}
+}
+
+func TestUploadAbortsFailedParts(t *testing.T) {
+	client := &uploadClient{parts: make(map[int32]int), failPart: 2}
+	s3c := &S3Service{Uploader: NewUploader(client, MinUploadPartSize, 1)}
+
+	err := s3c.UploadStream("bucket", "key", ObjectMeta{}, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(make([]byte, int(MinUploadPartSize)*3)))
+		return err
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "upload-1") {
+		t.Errorf("expected a multipart failure, got: %v", err)
+	}
+
+	if !client.aborted {
+		t.Errorf("expected the multipart upload to be aborted")
+	}
+
+	failing := &uploadClient{parts: make(map[int32]int)}
+	s3c.Uploader = NewUploader(failing, MinUploadPartSize, 1)
+
+	err = s3c.UploadStream("bucket", "key", ObjectMeta{}, func(w io.Writer) error {
+		return errors.New("encoder failed")
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "encoder failed") {
+		t.Errorf("expected the encoder error, got: %v", err)
+	}
+}
+
+func TestBatchKeys(t *testing.T) {
+	keys := make([]string, 2500)
+
+	for i := range keys {
+		keys[i] = fmt.Sprintf("ethereum/hardhat/contracts/%d.ndjson", i)
+	}
+
+	batches := BatchKeys(keys, MaxDeleteBatch)
+
+	if len(batches) != 3 || len(batches[0]) != 1000 || len(batches[2]) != 500 || batches[2][499] != keys[2499] {
+		t.Errorf("expected: batches of 1000, 1000 and 500 keys, got: %d batches", len(batches))
+	}
+
+	if len(BatchKeys(nil, MaxDeleteBatch)) != 0 {
+		t.Errorf("expected no batches")
+	}
+}
+
+func TestDeletePrefixRefusesEmptyPrefix(t *testing.T) {
+	s3c := &S3Service{}
+
+	for _, prefix := range []string{"", "/", "//"} {
+		_, err := s3c.DeletePrefix("bucket", prefix, false)
+
+		if err == nil {
+			t.Errorf("expected an error for prefix=%q", prefix)
+		}
+	}
+}
+
+func TestS3ServiceNamespace(t *testing.T) {
+	s3c := &S3Service{}
+
+	if s3c.key("chain=ethereum/block=1.ndjson") != "chain=ethereum/block=1.ndjson" || s3c.tagging() != nil {
+		t.Errorf("expected plain keys and no tags without an env")
+	}
+
+	s3c.Env = Dev
+	s3c.Namespace = "jane"
+
+	if s3c.key("chain=ethereum/block=1.ndjson") != "user=jane/chain=ethereum/block=1.ndjson" {
+		t.Errorf("expected: %s, got: %s", "user=jane/chain=ethereum/block=1.ndjson", s3c.key("chain=ethereum/block=1.ndjson"))
+	}
+
+	if *s3c.tagging() != "env=development&user=jane" {
+		t.Errorf("expected: %s, got: %s", "env=development&user=jane", *s3c.tagging())
+	}
+}
+
 func check(t *testing.T, err error) {
 	if err != nil {
 		t.Errorf(err.Error())
@@ -20,6 +20,12 @@ type EthereumStreamer struct {
 	Fork      bool
 	Env       Env
 	StartFrom uint64
+	// the network of the connected chain
+	Network NetworkType
+	// only list the stale fork data instead of deleting it
+	DryRun bool
+	// required to delete stale fork data outside of dev
+	ConfirmDelete bool
 }
 
 func NewEthereumStreamer(scnfg Config) (*EthereumStreamer, error) {
@@ -31,6 +37,20 @@ func NewEthereumStreamer(scnfg Config) (*EthereumStreamer, error) {
 
 	l := logger.Sugar()
 
+	eths, err := ConnectNetwork(&scnfg)
+
+	if err != nil {
+		l.Infof("FailedToCreateEthereumClient: %s", err.Error())
+		return nil, err
+	}
+
+	err = ValidateEnvironment(scnfg)
+
+	if err != nil {
+		l.Infof("RefusingToStream: %s", err.Error())
+		return nil, err
+	}
+
 	config, err := LoadDefaultAWSConfig()
 
 	if err != nil {
@@ -59,14 +79,19 @@ func NewEthereumStreamer(scnfg Config) (*EthereumStreamer, error) {
 		return nil, err
 	}
 
+	s3.Env = scnfg.Env
+	s3.Namespace = scnfg.Namespace
+
 	srvc := &EthereumStreamer{
-		Logger: logger,
-		Glue:   glue,
-		Wg:     &sync.WaitGroup{},
-		S3:     s3,
-		Begin:  time.Now(),
-		Fork:   scnfg.Fork,
-		Env:    scnfg.Env,
+		Logger:          logger,
+		EthereumService: eths,
+		Glue:            glue,
+		Wg:              &sync.WaitGroup{},
+		S3:              s3,
+		Begin:           time.Now(),
+		Fork:            scnfg.Fork,
+		Env:             scnfg.Env,
+		Network:         scnfg.Network,
 	}
 
 	// if dev then use localhost fork
@@ -117,13 +142,19 @@ func NewEthereumStreamer(scnfg Config) (*EthereumStreamer, error) {
 	return srvc, nil
 }
 
+// ContractsPrefix returns the prefix of the contract data written by a fork, the trailing slash keeps the delete
+// from matching siblings such as contracts-archive
+func ContractsPrefix(network NetworkType) string {
+	return fmt.Sprintf("%s/%s/%s/", Ethereum, network, "contracts")
+}
+
 func (s *EthereumStreamer) Stream() error {
 	l := s.Logger.Sugar()
 
 	if s.Fork {
 		l.Infof("Streaming Forked Ethereum Network from %d", s.Head)
 
-		key := fmt.Sprintf("%s/%s/%s", Ethereum, s.Network, "contracts")
+		key := ContractsPrefix(s.Network)
 
 		objs, err := s.S3.ListObjects(s.Glue.EventMeta.Bucket, key)
 
@@ -132,12 +163,35 @@ func (s *EthereumStreamer) Stream() error {
 			return err
 		}
 
-		if len(*objs) != 0 {
-			l.Infof("Found stale contract data from bucket, removing all previous contract data from %s", fmt.Sprintf("s3://%s/%s", s.Glue.EventMeta.Bucket, key))
-			// TODO: remove previous contract data from s3
-		} else {
+		if len(*objs) == 0 {
 			l.Infof("No stale contract data found in bucket (fresh run)")
+			return nil
 		}
+
+		location := fmt.Sprintf("s3://%s/%s", s.Glue.EventMeta.Bucket, key)
+
+		if s.Env != Dev && !s.ConfirmDelete && !s.DryRun {
+			return fmt.Errorf("refusing to delete %d objects from %s in env=%s without confirmation", len(*objs), location, s.Env)
+		}
+
+		l.Infof("Found stale contract data from bucket, removing all previous contract data from %s", location)
+
+		deleted, err := s.S3.DeletePrefix(s.Glue.EventMeta.Bucket, key, s.DryRun)
+
+		if err != nil {
+			l.Infof("FailedToDeleteObjects: %s", err.Error())
+			return err
+		}
+
+		if s.DryRun {
+			for _, obj := range deleted {
+				l.Infof("would delete s3://%s/%s", s.Glue.EventMeta.Bucket, obj)
+			}
+			l.Infof("dry run, %d objects left in %s", len(deleted), location)
+			return nil
+		}
+
+		l.Infof("removed %d objects from %s", len(deleted), location)
 		return nil
 	}
 
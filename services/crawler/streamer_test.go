@@ -1,5 +1,22 @@
 package main
 
+import (
+	"strings"
+	"testing"
+)
+
+func TestContractsPrefix(t *testing.T) {
+	prefix := ContractsPrefix(EthereumHardhat)
+
+	if prefix != "ethereum/hardhat/contracts/" {
+		t.Errorf("expected: %s, got: %s", "ethereum/hardhat/contracts/", prefix)
+	}
+
+	if strings.HasPrefix("ethereum/hardhat/contracts-archive/block=1.ndjson", prefix) {
+		t.Errorf("expected the prefix to exclude sibling keys")
+	}
+}
+
 // func TestNewEthereumStreamer(t *testing.T) {
 // 	streamer, err := New()
 
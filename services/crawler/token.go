@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// json-rpc code of a call that reverted
+	ExecutionRevertedCode = 3
+	ERC20MetadataABI      = `[{"inputs":[],"name":"symbol","outputs":[{"type":"string"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"decimals","outputs":[{"type":"uint8"}],"stateMutability":"view","type":"function"}]`
+)
+
+// keccak256("Transfer(address,address,uint256)")
+var TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+type Token struct {
+	Address  common.Address
+	Symbol   string
+	Decimals uint8
+}
+
+// TokenTransfer is a decoded ERC-20 Transfer log, value is in the token's base units
+type TokenTransfer struct {
+	Token    common.Address
+	From     common.Address
+	To       common.Address
+	Value    *big.Int
+	TxHash   common.Hash
+	LogIndex uint
+}
+
+// TokenRegistry resolves token metadata once and caches it for the lifetime of the crawler
+type TokenRegistry struct {
+	Client bind.ContractCaller
+	mu     sync.RWMutex
+	tokens map[common.Address]Token
+	abi    abi.ABI
+}
+
+// TokenFilter decides which tokens get indexed, an empty allowlist allows every token not in the denylist
+type TokenFilter struct {
+	Allow map[common.Address]bool
+	Deny  map[common.Address]bool
+}
+
+func NewTokenRegistry(client bind.ContractCaller) (*TokenRegistry, error) {
+	parsed, err := abi.JSON(strings.NewReader(ERC20MetadataABI))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenRegistry{
+		Client: client,
+		tokens: make(map[common.Address]Token),
+		abi:    parsed,
+	}, nil
+}
+
+// Token returns the cached metadata of a token. Tokens that don't implement the optional metadata methods (the call
+// reverts or returns nothing) are cached with an empty symbol and zero decimals, other call errors aren't cached.
+func (r *TokenRegistry) Token(ctx context.Context, address common.Address) (Token, error) {
+	r.mu.RLock()
+	token, ok := r.tokens[address]
+	r.mu.RUnlock()
+
+	if ok {
+		return token, nil
+	}
+
+	token = Token{Address: address}
+
+	symbol, err := r.call(ctx, address, "symbol")
+
+	if err != nil && !IsCallReverted(err) {
+		return token, fmt.Errorf("failed to get symbol of token=%s: %s", address.Hex(), err.Error())
+	}
+
+	if err == nil {
+		token.Symbol = DecodeTokenSymbol(symbol)
+	}
+
+	decimals, err := r.call(ctx, address, "decimals")
+
+	if err != nil && !IsCallReverted(err) {
+		return token, fmt.Errorf("failed to get decimals of token=%s: %s", address.Hex(), err.Error())
+	}
+
+	if err == nil && len(decimals) >= 32 {
+		token.Decimals = uint8(new(big.Int).SetBytes(decimals[:32]).Uint64())
+	}
+
+	r.mu.Lock()
+	r.tokens[address] = token
+	r.mu.Unlock()
+
+	return token, nil
+}
+
+// IsCallReverted returns true when a call failed because the contract reverted, a definitive answer unlike
+// transport or node errors
+func IsCallReverted(err error) bool {
+	var rpcErr rpc.Error
+
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == ExecutionRevertedCode {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "execution reverted") || strings.Contains(msg, "invalid opcode")
+}
+
+func (r *TokenRegistry) call(ctx context.Context, address common.Address, method string) ([]byte, error) {
+	data, err := r.abi.Pack(method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+}
+
+// DecodeTokenSymbol decodes a symbol returned as an abi string or, for older tokens (e.g. MKR), as bytes32
+func DecodeTokenSymbol(raw []byte) string {
+	if len(raw) == 32 {
+		return string(bytes.TrimRight(raw, "\x00"))
+	}
+
+	values, err := abi.Arguments{{Type: mustType("string")}}.Unpack(raw)
+
+	if err != nil || len(values) == 0 {
+		return ""
+	}
+
+	symbol, _ := values[0].(string)
+	return symbol
+}
+
+// DecodeERC20Transfers returns the ERC-20 transfers in a receipt's logs, ERC-721 transfers (indexed token id) are ignored
+func DecodeERC20Transfers(logs []*types.Log) []TokenTransfer {
+	var transfers []TokenTransfer
+
+	for _, log := range logs {
+		if len(log.Topics) != 3 || log.Topics[0] != TransferTopic || len(log.Data) != 32 {
+			continue
+		}
+
+		transfers = append(transfers, TokenTransfer{
+			Token:    log.Address,
+			From:     common.BytesToAddress(log.Topics[1].Bytes()),
+			To:       common.BytesToAddress(log.Topics[2].Bytes()),
+			Value:    new(big.Int).SetBytes(log.Data),
+			TxHash:   log.TxHash,
+			LogIndex: log.Index,
+		})
+	}
+
+	return transfers
+}
+
+func NewTokenFilter(allow, deny []string) (TokenFilter, error) {
+	filter := TokenFilter{
+		Allow: make(map[common.Address]bool),
+		Deny:  make(map[common.Address]bool),
+	}
+
+	for _, list := range []struct {
+		values []string
+		set    map[common.Address]bool
+	}{{allow, filter.Allow}, {deny, filter.Deny}} {
+		for _, v := range list.values {
+			if !common.IsHexAddress(v) {
+				return filter, fmt.Errorf("invalid token address: %s", v)
+			}
+			list.set[common.HexToAddress(v)] = true
+		}
+	}
+
+	for address := range filter.Allow {
+		if filter.Deny[address] {
+			return filter, errors.New("token can't be in both the allowlist and denylist: " + address.Hex())
+		}
+	}
+
+	return filter, nil
+}
+
+func (f TokenFilter) Indexes(token common.Address) bool {
+	if f.Deny[token] {
+		return false
+	}
+
+	if len(f.Allow) == 0 {
+		return true
+	}
+
+	return f.Allow[token]
+}
+
+func mustType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return typ
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type tokenCaller struct {
+	calls int
+	err   error
+}
+
+func (c *tokenCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c *tokenCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	parsed, _ := abi.JSON(strings.NewReader(ERC20MetadataABI))
+
+	if common.Bytes2Hex(call.Data) == common.Bytes2Hex(parsed.Methods["symbol"].ID) {
+		return parsed.Methods["symbol"].Outputs.Pack("SSV")
+	}
+
+	return parsed.Methods["decimals"].Outputs.Pack(uint8(18))
+}
+
+func TestTokenRegistry(t *testing.T) {
+	caller := &tokenCaller{}
+
+	registry, err := NewTokenRegistry(caller)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := common.HexToAddress("0x9D65fF81a3c488d585bBfb0Bfe3c7707c7917f54")
+
+	for i := 0; i < 3; i++ {
+		token, err := registry.Token(context.Background(), address)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Symbol != "SSV" || token.Decimals != 18 {
+			t.Errorf("unexpected token: %+v", token)
+		}
+	}
+
+	if caller.calls != 2 {
+		t.Errorf("expected metadata to be resolved once, got %d calls", caller.calls)
+	}
+
+	// a transient failure isn't cached, a revert is
+	caller.err = errors.New("429 too many requests")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+
+	if _, err := registry.Token(context.Background(), usdc); err == nil {
+		t.Error("expected the call error to be returned")
+	}
+
+	caller.err = nil
+
+	token, err := registry.Token(context.Background(), usdc)
+
+	if err != nil || token.Symbol != "SSV" || token.Decimals != 18 {
+		t.Errorf("expected the metadata after the failure, got: %+v (%v)", token, err)
+	}
+
+	caller.err = errors.New("execution reverted")
+	calls := caller.calls
+	nft := common.HexToAddress("0x3")
+
+	for i := 0; i < 2; i++ {
+		token, err = registry.Token(context.Background(), nft)
+
+		if err != nil || token.Symbol != "" || token.Decimals != 0 {
+			t.Errorf("expected empty metadata for a reverted call, got: %+v (%v)", token, err)
+		}
+	}
+
+	if caller.calls-calls != 2 {
+		t.Errorf("expected: %d, got: %d", 2, caller.calls-calls)
+	}
+
+	mkr := common.RightPadBytes([]byte("MKR"), 32)
+
+	if DecodeTokenSymbol(mkr) != "MKR" {
+		t.Errorf("expected: %s, got: %s", "MKR", DecodeTokenSymbol(mkr))
+	}
+}
+
+func TestDecodeERC20Transfers(t *testing.T) {
+	token := common.HexToAddress("0x514910771AF9Ca656af840dff83E8264EcF986CA")
+	from := common.HexToAddress("0x1")
+	to := common.HexToAddress("0x2")
+
+	logs := []*types.Log{
+		{
+			Address: token,
+			Topics:  []common.Hash{TransferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+			Data:    common.LeftPadBytes(big.NewInt(500).Bytes(), 32),
+		},
+		// erc-721 transfer with an indexed token id
+		{
+			Address: token,
+			Topics:  []common.Hash{TransferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), common.BigToHash(big.NewInt(1))},
+		},
+	}
+
+	transfers := DecodeERC20Transfers(logs)
+
+	if len(transfers) != 1 {
+		t.Fatalf("expected: %d, got: %d", 1, len(transfers))
+	}
+
+	if transfers[0].From != from || transfers[0].To != to || transfers[0].Value.Int64() != 500 {
+		t.Errorf("unexpected transfer: %+v", transfers[0])
+	}
+
+	filter, err := NewTokenFilter(nil, []string{token.Hex()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filter.Indexes(token) || !filter.Indexes(from) {
+		t.Error("unexpected denylist result")
+	}
+
+	filter, err = NewTokenFilter([]string{token.Hex()}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.Indexes(token) || filter.Indexes(from) {
+		t.Error("unexpected allowlist result")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// json-rpc code for an unknown method
+	MethodNotFoundCode = -32601
+)
+
+var ErrTracingUnavailable = errors.New("debug tracing is not available on the node")
+
+// CallFrame is a single frame of the geth callTracer output
+type CallFrame struct {
+	Type  string       `json:"type"`
+	From  string       `json:"from"`
+	To    string       `json:"to"`
+	Value *hexutil.Big `json:"value"`
+	Error string       `json:"error"`
+	Calls []CallFrame  `json:"calls"`
+}
+
+// TxTrace is the trace of a transaction returned by debug_traceBlockByNumber
+type TxTrace struct {
+	TxHash string    `json:"txHash"`
+	Result CallFrame `json:"result"`
+	Error  string    `json:"error"`
+}
+
+// InternalTransfer is ether moved by a contract inside a transaction
+type InternalTransfer struct {
+	TxHash common.Hash
+	Type   string
+	From   common.Address
+	To     common.Address
+	Value  *big.Int
+	// index of each call from the top level frame (e.g. 0.2.1)
+	Path string
+}
+
+// TraceBlock returns the callTracer trace of every transaction in a block, in block order
+func (e *EthereumService) TraceBlock(ctx context.Context, number *big.Int) ([]TxTrace, error) {
+	var traces []TxTrace
+
+	config := map[string]interface{}{
+		"tracer": "callTracer",
+	}
+
+	err := e.Client.Client().CallContext(ctx, &traces, "debug_traceBlockByNumber", hexutil.EncodeBig(number), config)
+
+	if err != nil {
+		if IsMethodUnavailable(err) {
+			return nil, fmt.Errorf("%w: %s", ErrTracingUnavailable, err.Error())
+		}
+		return nil, err
+	}
+
+	return traces, nil
+}
+
+// IsMethodUnavailable returns true when the node doesn't expose the called rpc method. Only the json-rpc method
+// not found code and its messages match, other errors (e.g. pruned state) fail the block instead of disabling tracing.
+func IsMethodUnavailable(err error) bool {
+	var rpcErr rpc.Error
+
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == MethodNotFoundCode {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "method not found") || methodNotExistPattern.MatchString(msg)
+}
+
+var methodNotExistPattern = regexp.MustCompile(`the method \S+ does not exist`)
+
+// InternalTransfers extracts the value transfers made below the top level call of each transaction,
+// frames that reverted are skipped along with all their children
+func InternalTransfers(traces []TxTrace, txs types.Transactions) ([]InternalTransfer, error) {
+	if len(traces) != len(txs) {
+		return nil, fmt.Errorf("trace count=%d does not match transaction count=%d", len(traces), len(txs))
+	}
+
+	var transfers []InternalTransfer
+
+	for i, trace := range traces {
+		hash := txs[i].Hash()
+
+		if trace.TxHash != "" && common.HexToHash(trace.TxHash) != hash {
+			return nil, fmt.Errorf("trace for tx=%s found at index of tx=%s", trace.TxHash, hash.Hex())
+		}
+
+		if trace.Error != "" || trace.Result.Error != "" {
+			continue
+		}
+
+		for j, call := range trace.Result.Calls {
+			transfers = walkCallFrame(transfers, hash, call, fmt.Sprintf("%d", j))
+		}
+	}
+
+	return transfers, nil
+}
+
+func walkCallFrame(transfers []InternalTransfer, hash common.Hash, frame CallFrame, path string) []InternalTransfer {
+	if frame.Error != "" {
+		return transfers
+	}
+
+	switch strings.ToUpper(frame.Type) {
+	// delegatecall and staticcall carry the caller's value without moving it
+	case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+		if frame.Value != nil && frame.Value.ToInt().Sign() > 0 {
+			transfers = append(transfers, InternalTransfer{
+				TxHash: hash,
+				Type:   strings.ToLower(frame.Type),
+				From:   common.HexToAddress(frame.From),
+				To:     common.HexToAddress(frame.To),
+				Value:  new(big.Int).Set(frame.Value.ToInt()),
+				Path:   path,
+			})
+		}
+	}
+
+	for i, call := range frame.Calls {
+		transfers = walkCallFrame(transfers, hash, call, fmt.Sprintf("%s.%d", path, i))
+	}
+
+	return transfers
+}
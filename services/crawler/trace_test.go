@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestInternalTransfers(t *testing.T) {
+	manager := common.HexToAddress("0x5d35a44Db8a390aCfa997C9a9Ba3a2F878595630")
+
+	tx := types.NewTx(&types.LegacyTx{To: &manager, Value: big.NewInt(0), Gas: 100000, GasPrice: big.NewInt(1)})
+
+	raw := `[{"txHash":"` + tx.Hash().Hex() + `","result":{
+		"type":"CALL","from":"0x1","to":"0x5d35a44db8a390acfa997c9a9ba3a2f878595630","value":"0x0",
+		"calls":[
+			{"type":"STATICCALL","from":"0x5d35a44db8a390acfa997c9a9ba3a2f878595630","to":"0x2"},
+			{"type":"CALL","from":"0x5d35a44db8a390acfa997c9a9ba3a2f878595630","to":"0x3","value":"0xde0b6b3a7640000",
+				"calls":[{"type":"CALL","from":"0x3","to":"0x4","value":"0x1"}]},
+			{"type":"CALL","from":"0x5d35a44db8a390acfa997c9a9ba3a2f878595630","to":"0x5","value":"0x1","error":"execution reverted",
+				"calls":[{"type":"CALL","from":"0x5","to":"0x6","value":"0x1"}]},
+			{"type":"DELEGATECALL","from":"0x5d35a44db8a390acfa997c9a9ba3a2f878595630","to":"0x7","value":"0x5"}
+		]}}]`
+
+	var traces []TxTrace
+
+	err := json.Unmarshal([]byte(raw), &traces)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := InternalTransfers(traces, types.Transactions{tx})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transfers) != 2 {
+		t.Fatalf("expected: %d, got: %d", 2, len(transfers))
+	}
+
+	if transfers[0].Path != "1" || transfers[0].From != manager || transfers[0].Value.String() != "1000000000000000000" {
+		t.Errorf("unexpected transfer: %+v", transfers[0])
+	}
+
+	if transfers[1].Path != "1.0" || transfers[1].To != common.HexToAddress("0x4") {
+		t.Errorf("unexpected transfer: %+v", transfers[1])
+	}
+
+	_, err = InternalTransfers(traces, types.Transactions{})
+
+	if err == nil {
+		t.Error("expected error for mismatched trace count")
+	}
+}
+
+func TestIsMethodUnavailable(t *testing.T) {
+	if !IsMethodUnavailable(errors.New("the method debug_traceBlockByNumber does not exist/is not available")) {
+		t.Error("expected missing debug namespace to be detected")
+	}
+
+	if !IsMethodUnavailable(errors.New("Method not found")) {
+		t.Error("expected method not found to be detected")
+	}
+
+	for _, msg := range []string{"request timed out", "missing trie node 1f2e (path ) state 0x1f2e is not available", "historical state not available in path scheme yet"} {
+		if IsMethodUnavailable(errors.New(msg)) {
+			t.Errorf("unexpected method unavailable for: %s", msg)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	UniswapSource = "uniswap"
+
+	// USDC/WETH 0.05% pool on mainnet
+	UniswapV3USDCWETHPool = "0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640"
+
+	UniswapV3ObserveABI = `[{"inputs":[{"internalType":"uint32[]","name":"secondsAgos","type":"uint32[]"}],"name":"observe","outputs":[{"internalType":"int56[]","name":"tickCumulatives","type":"int56[]"},{"internalType":"uint160[]","name":"secondsPerLiquidityCumulativeX128s","type":"uint160[]"}],"stateMutability":"view","type":"function"}]`
+)
+
+// ChainReader is the subset of the ethereum client needed for on-chain price reads
+type ChainReader interface {
+	bind.ContractCaller
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// UniswapV3Exchange reads a time weighted average price from a Uniswap V3 pool
+type UniswapV3Exchange struct {
+	Client   ChainReader
+	Pool     common.Address
+	Coin     ChainType
+	Currency Currency
+	// decimals of the pool tokens (e.g. USDC=6 and WETH=18)
+	Token0Decimals int
+	Token1Decimals int
+	// true when the currency is token0 and the coin is token1 (e.g. USDC/WETH)
+	QuoteIsToken0 bool
+	// the twap window ending at the requested time
+	Window time.Duration
+	// block timestamps shared with the crawler, historical prices resolve their block from it
+	Times *BlockTimes
+	abi   abi.ABI
+}
+
+// NewUniswapV3Exchange returns an ETH/USD twap exchange over the mainnet USDC/WETH pool, the client must point to an archive node for historical prices
+func NewUniswapV3Exchange(client ChainReader, times *BlockTimes) (Exchange, error) {
+	if client == nil {
+		return nil, errors.New("ethereum client is required")
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(UniswapV3ObserveABI))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return UniswapV3Exchange{
+		Client:         client,
+		Pool:           common.HexToAddress(UniswapV3USDCWETHPool),
+		Coin:           Ethereum,
+		Currency:       USD,
+		Token0Decimals: 6,
+		Token1Decimals: 18,
+		QuoteIsToken0:  true,
+		Window:         10 * time.Minute,
+		Times:          times,
+		abi:            parsed,
+	}, nil
+}
+
+func (u UniswapV3Exchange) CurrentPrice(coin ChainType, currency Currency) (ExchangePrice, error) {
+	return u.twap(coin, currency, nil, time.Now())
+}
+
+func (u UniswapV3Exchange) HistoricalPrice(coin ChainType, currency Currency, received time.Time) (ExchangePrice, error) {
+	block, err := BlockAtTime(context.Background(), u.Client, u.Times, received)
+
+	if err != nil {
+		return ExchangePrice{}, err
+	}
+
+	return u.twap(coin, currency, block, received)
+}
+
+func (u UniswapV3Exchange) twap(coin ChainType, currency Currency, block *big.Int, received time.Time) (ExchangePrice, error) {
+	price := ExchangePrice{
+		Coin:     coin.Short(),
+		Currency: currency.String(),
+		Time:     received,
+		Source:   UniswapSource,
+	}
+
+	if coin != u.Coin || currency != u.Currency {
+		return price, fmt.Errorf("unsupported pair for uniswap pool=%s: %s-%s", u.Pool.Hex(), coin.Short(), currency)
+	}
+
+	window := uint32(u.Window.Seconds())
+
+	if window == 0 {
+		return price, errors.New("twap window must be at least one second")
+	}
+
+	data, err := u.abi.Pack("observe", []uint32{window, 0})
+
+	if err != nil {
+		return price, err
+	}
+
+	res, err := u.Client.CallContract(context.Background(), ethereum.CallMsg{To: &u.Pool, Data: data}, block)
+
+	if err != nil {
+		return price, fmt.Errorf("failed to call observe on pool=%s: %s", u.Pool.Hex(), err.Error())
+	}
+
+	out, err := u.abi.Unpack("observe", res)
+
+	if err != nil {
+		return price, err
+	}
+
+	cumulatives, ok := out[0].([]*big.Int)
+
+	if !ok || len(cumulatives) != 2 {
+		return price, fmt.Errorf("unexpected observe result from pool=%s", u.Pool.Hex())
+	}
+
+	tick := AverageTick(cumulatives[0], cumulatives[1], window)
+
+	price.Value = TickToPrice(tick, u.Token0Decimals, u.Token1Decimals, u.QuoteIsToken0)
+	return price, nil
+}
+
+// AverageTick returns the arithmetic mean tick between two tick cumulatives, rounded towards negative infinity
+func AverageTick(start, end *big.Int, window uint32) int64 {
+	delta := new(big.Int).Sub(end, start)
+	w := big.NewInt(int64(window))
+
+	// big.Int.Div is euclidean, which already rounds towards negative infinity for a positive divisor
+	return new(big.Int).Div(delta, w).Int64()
+}
+
+// TickToPrice converts a pool tick to a human readable price
+func TickToPrice(tick int64, token0Decimals, token1Decimals int, quoteIsToken0 bool) float64 {
+	// token1 per token0
+	price := math.Pow(1.0001, float64(tick)) * math.Pow10(token0Decimals-token1Decimals)
+
+	if quoteIsToken0 {
+		if price == 0 {
+			return 0
+		}
+		return 1 / price
+	}
+
+	return price
+}
+
+const (
+	// the cache is reset once it holds more blocks than this
+	MaxBlockTimes = 100_000
+)
+
+// BlockTimes caches the timestamps of known blocks so time lookups only search between the nearest known blocks
+type BlockTimes struct {
+	mu    sync.Mutex
+	times map[uint64]uint64
+}
+
+func NewBlockTimes() *BlockTimes {
+	return &BlockTimes{times: make(map[uint64]uint64)}
+}
+
+// Remember records the timestamp of a block
+func (b *BlockTimes) Remember(height, timestamp uint64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.times) >= MaxBlockTimes {
+		b.times = make(map[uint64]uint64)
+	}
+
+	b.times[height] = timestamp
+}
+
+// Bounds returns the highest known block mined at or before target and the lowest known block mined after it,
+// hi is 0 when no later block is known
+func (b *BlockTimes) Bounds(target uint64) (lo, hi uint64, exact bool) {
+	if b == nil {
+		return 0, 0, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for height, timestamp := range b.times {
+		if timestamp <= target && height >= lo {
+			lo = height
+			// timestamps strictly increase, so no later block can match
+			exact = exact || timestamp == target
+		}
+
+		if timestamp > target && (hi == 0 || height < hi) {
+			hi = height
+		}
+	}
+
+	return lo, hi, exact
+}
+
+// BlockAtTime returns the number of the latest block mined at or before t, known block times narrow the search
+// and the headers read are remembered
+func BlockAtTime(ctx context.Context, client ChainReader, times *BlockTimes, t time.Time) (*big.Int, error) {
+	target := uint64(t.Unix())
+
+	lo, after, exact := times.Bounds(target)
+
+	if exact {
+		return new(big.Int).SetUint64(lo), nil
+	}
+
+	hi := after - 1
+
+	if after == 0 {
+		head, err := client.HeaderByNumber(ctx, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		times.Remember(head.Number.Uint64(), head.Time)
+
+		if head.Time <= target {
+			return head.Number, nil
+		}
+
+		hi = head.Number.Uint64()
+	}
+
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(mid))
+
+		if err != nil {
+			return nil, err
+		}
+
+		times.Remember(mid, header.Time)
+
+		if header.Time == target {
+			return new(big.Int).SetUint64(mid), nil
+		}
+
+		if header.Time < target {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return new(big.Int).SetUint64(lo), nil
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type DiscrepancyKind string
+
+const (
+	// no event partition was uploaded for the height
+	MissingBlock DiscrepancyKind = "missing_block"
+	// the partition has no block event
+	MissingBlockEvent DiscrepancyKind = "missing_block_event"
+	// the partition can't be decoded
+	InvalidPartition DiscrepancyKind = "invalid_partition"
+	// the stored block hash isn't the canonical hash, the block was crawled on a fork
+	HashMismatch DiscrepancyKind = "hash_mismatch"
+	// the stored parent hash isn't the parent of the stored block
+	ParentMismatch DiscrepancyKind = "parent_mismatch"
+	// the partition has a different number of transaction events than the block
+	TxCountMismatch DiscrepancyKind = "tx_count_mismatch"
+	// a transaction event has no sent or received wallet action
+	MissingAction DiscrepancyKind = "missing_action"
+)
+
+// StoredBlock is a block read back from its event and action partitions
+type StoredBlock struct {
+	Height  uint64
+	Events  []Event
+	Actions []Action
+	// set when a partition fails to decode
+	Err error
+}
+
+// Discrepancy is a check an uploaded block failed
+type Discrepancy struct {
+	Kind   DiscrepancyKind `json:"kind"`
+	Height uint64          `json:"height"`
+	Tx     string          `json:"tx,omitempty"`
+	Detail string          `json:"detail"`
+}
+
+// VerifyReport is the machine readable result of verifying a block range
+type VerifyReport struct {
+	Chain         ChainType     `json:"chain"`
+	Network       NetworkType   `json:"network"`
+	From          uint64        `json:"from"`
+	To            uint64        `json:"to"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	// heights to crawl again, sorted
+	Retry []uint64 `json:"retry"`
+}
+
+// BlockReader is the part of the ethereum client the verification reads canonical blocks from
+type BlockReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error)
+}
+
+// PartitionHeight parses the block height out of a partition key (e.g. chain=ethereum/.../block=42.ndjson)
+func PartitionHeight(key string) (uint64, bool) {
+	name := key[strings.LastIndex(key, "/")+1:]
+
+	if !strings.HasPrefix(name, "block=") {
+		return 0, false
+	}
+
+	raw, _, _ := strings.Cut(strings.TrimPrefix(name, "block="), ".")
+
+	height, err := strconv.ParseUint(raw, 10, 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return height, true
+}
+
+// BlockHash returns the hash of the stored block event
+func (b *StoredBlock) BlockHash() (string, bool) {
+	for _, event := range b.Events {
+		if event.Type == Block {
+			return event.Block, true
+		}
+	}
+
+	return "", false
+}
+
+// VerifyBlocks checks every height between from and to against the chain, the stored block below from
+// (when given) is only used to check the continuity of the first block
+func VerifyBlocks(ctx context.Context, chain BlockReader, network NetworkType, from, to uint64, stored map[uint64]*StoredBlock) (*VerifyReport, error) {
+	if to < from {
+		return nil, fmt.Errorf("invalid verify range: from=%d to=%d", from, to)
+	}
+
+	report := &VerifyReport{
+		Chain:         Ethereum,
+		Network:       network,
+		From:          from,
+		To:            to,
+		Discrepancies: []Discrepancy{},
+		Retry:         []uint64{},
+	}
+
+	for height := from; height <= to; height++ {
+		block, ok := stored[height]
+
+		if !ok {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: MissingBlock, Height: height, Detail: "no event partition"})
+			continue
+		}
+
+		header, err := chain.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get header=%d: %s", height, err.Error())
+		}
+
+		count, err := chain.TransactionCount(ctx, header.Hash())
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transaction count of block=%d: %s", height, err.Error())
+		}
+
+		report.Discrepancies = append(report.Discrepancies, VerifyBlock(block, stored[height-1], header, int(count))...)
+		report.Checked++
+	}
+
+	retry := make(map[uint64]bool)
+
+	for _, d := range report.Discrepancies {
+		if !retry[d.Height] {
+			retry[d.Height] = true
+			report.Retry = append(report.Retry, d.Height)
+		}
+	}
+
+	sort.Slice(report.Retry, func(i, j int) bool {
+		return report.Retry[i] < report.Retry[j]
+	})
+
+	return report, nil
+}
+
+// VerifyBlock checks a stored block against its canonical header and transaction count,
+// the parent is nil when it wasn't stored
+func VerifyBlock(block, parent *StoredBlock, header *types.Header, txCount int) []Discrepancy {
+	var found []Discrepancy
+
+	if block.Err != nil {
+		return append(found, Discrepancy{Kind: InvalidPartition, Height: block.Height, Detail: block.Err.Error()})
+	}
+
+	hash, ok := block.BlockHash()
+
+	if !ok {
+		return append(found, Discrepancy{Kind: MissingBlockEvent, Height: block.Height, Detail: "no block event in partition"})
+	}
+
+	if hash != header.Hash().Hex() {
+		found = append(found, Discrepancy{Kind: HashMismatch, Height: block.Height, Detail: fmt.Sprintf("stored=%s chain=%s", hash, header.Hash().Hex())})
+	}
+
+	if parent != nil {
+		parentHash, ok := parent.BlockHash()
+
+		if ok && parentHash != header.ParentHash.Hex() {
+			found = append(found, Discrepancy{Kind: ParentMismatch, Height: block.Height, Detail: fmt.Sprintf("stored parent=%s chain parent=%s", parentHash, header.ParentHash.Hex())})
+		}
+	}
+
+	var txs []string
+
+	for _, event := range block.Events {
+		if event.Type == Transaction {
+			txs = append(txs, event.Transaction)
+		}
+	}
+
+	if len(txs) != txCount {
+		found = append(found, Discrepancy{Kind: TxCountMismatch, Height: block.Height, Detail: fmt.Sprintf("stored=%d chain=%d", len(txs), txCount)})
+	}
+
+	sent := make(map[string]bool)
+	received := make(map[string]bool)
+
+	for _, action := range block.Actions {
+		if !action.IsTopLevel() {
+			continue
+		}
+
+		switch action.Action {
+		case Sent:
+			sent[action.Hash] = true
+		case Received:
+			received[action.Hash] = true
+		}
+	}
+
+	for _, tx := range txs {
+		if !sent[tx] {
+			found = append(found, Discrepancy{Kind: MissingAction, Height: block.Height, Tx: tx, Detail: string(Sent)})
+		}
+
+		if !received[tx] {
+			found = append(found, Discrepancy{Kind: MissingAction, Height: block.Height, Tx: tx, Detail: string(Received)})
+		}
+	}
+
+	return found
+}
+
+// LoadStoredBlocks reads the event and action partitions of the heights between from and to back from s3
+func (c *EthereumCrawler) LoadStoredBlocks(from, to uint64) (map[uint64]*StoredBlock, error) {
+	prefix := fmt.Sprintf("chain=%s/network=%s/", Ethereum, c.Config.Network)
+
+	eventKeys, err := c.S3.ListObjects(c.Glue.EventMeta.Bucket, prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	actionKeys, err := c.S3.ListObjects(c.Glue.ActionMeta.Bucket, prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make(map[uint64]string)
+
+	for _, key := range UniquePartitions(*actionKeys) {
+		if height, ok := PartitionHeight(key); ok {
+			actions[height] = key
+		}
+	}
+
+	stored := make(map[uint64]*StoredBlock)
+
+	for _, key := range UniquePartitions(*eventKeys) {
+		height, ok := PartitionHeight(key)
+
+		if !ok || height < from || height > to {
+			continue
+		}
+
+		block := &StoredBlock{Height: height}
+		stored[height] = block
+
+		buf, err := c.S3.Get(c.Glue.EventMeta.Bucket, key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		block.Events, err = ReadPartition[Event](key, buf)
+
+		if err != nil {
+			block.Err = fmt.Errorf("event partition %s: %s", key, err.Error())
+			continue
+		}
+
+		actionKey, ok := actions[height]
+
+		if !ok {
+			continue
+		}
+
+		buf, err = c.S3.Get(c.Glue.ActionMeta.Bucket, actionKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		block.Actions, err = ReadPartition[Action](actionKey, buf)
+
+		if err != nil {
+			block.Err = fmt.Errorf("action partition %s: %s", actionKey, err.Error())
+		}
+	}
+
+	return stored, nil
+}
+
+// Verify reads the uploaded partitions between from and to back from s3 and checks them against the chain
+func (c *EthereumCrawler) Verify(from, to uint64) (*VerifyReport, error) {
+	l := c.Logger.Sugar()
+
+	// the block below the range is read to check the continuity of the first block
+	low := from
+
+	if low > 0 {
+		low--
+	}
+
+	stored, err := c.LoadStoredBlocks(low, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.Infof("verifying blocks=%d-%d stored=%d", from, to, len(stored))
+
+	report, err := VerifyBlocks(context.Background(), c.Client, c.Config.Network, from, to, stored)
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.Infof("verified blocks=%d-%d checked=%d discrepancies=%d retry=%d", from, to, report.Checked, len(report.Discrepancies), len(report.Retry))
+
+	return report, nil
+}
+
+// RetryEntry is a block height queued to be crawled again
+type RetryEntry struct {
+	Network NetworkType     `json:"network"`
+	Height  uint64          `json:"height"`
+	Reason  DiscrepancyKind `json:"reason"`
+}
+
+// RetryQueue is a newline delimited json file of heights to crawl again
+type RetryQueue struct {
+	Path string
+}
+
+// RetryEntries returns one entry per height of the report with the first discrepancy found at it as the reason
+func (r *VerifyReport) RetryEntries() []RetryEntry {
+	reasons := make(map[uint64]DiscrepancyKind)
+
+	for _, d := range r.Discrepancies {
+		if _, ok := reasons[d.Height]; !ok {
+			reasons[d.Height] = d.Kind
+		}
+	}
+
+	entries := make([]RetryEntry, 0, len(r.Retry))
+
+	for _, height := range r.Retry {
+		entries = append(entries, RetryEntry{Network: r.Network, Height: height, Reason: reasons[height]})
+	}
+
+	return entries
+}
+
+// Push appends entries to the queue
+func (q *RetryQueue) Push(entries ...RetryEntry) error {
+	file, err := os.OpenFile(q.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return fmt.Errorf("failed to open retry queue %s: %s", q.Path, err.Error())
+	}
+
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+
+	for _, entry := range entries {
+		err = encoder.Encode(entry)
+
+		if err != nil {
+			return fmt.Errorf("failed to write retry queue %s: %s", q.Path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Drain returns the queued entries and empties the queue
+func (q *RetryQueue) Drain() ([]RetryEntry, error) {
+	data, err := os.ReadFile(q.Path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue %s: %s", q.Path, err.Error())
+	}
+
+	var entries []RetryEntry
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+
+	for decoder.More() {
+		var entry RetryEntry
+
+		err = decoder.Decode(&entry)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode retry queue %s: %s", q.Path, err.Error())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = os.Truncate(q.Path, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to empty retry queue %s: %s", q.Path, err.Error())
+	}
+
+	return entries, nil
+}
+
+// Retry crawls the queued heights of the crawler's network again, heights of other networks
+// and heights that fail again are pushed back onto the queue
+func (c *EthereumCrawler) Retry(queue *RetryQueue) error {
+	l := c.Logger.Sugar()
+
+	entries, err := queue.Drain()
+
+	if err != nil {
+		return err
+	}
+
+	var requeue []RetryEntry
+	done := make(map[uint64]bool)
+
+	for _, entry := range entries {
+		if entry.Network != c.Config.Network {
+			requeue = append(requeue, entry)
+			continue
+		}
+
+		if done[entry.Height] {
+			continue
+		}
+
+		done[entry.Height] = true
+
+		err := c.ProcessBlock(entry.Height)
+
+		if err != nil {
+			l.Warnf("failed to retry block=%d: %s", entry.Height, err.Error())
+			requeue = append(requeue, entry)
+			continue
+		}
+
+		l.Infof("retried block=%d reason=%s", entry.Height, entry.Reason)
+	}
+
+	if len(requeue) > 0 {
+		return queue.Push(requeue...)
+	}
+
+	return nil
+}
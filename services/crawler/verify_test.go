@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockReader serves a chain of headers linked by parent hash
+type blockReader struct {
+	headers  map[uint64]*types.Header
+	txCounts map[common.Hash]uint
+}
+
+func newBlockReader(txCounts []uint) *blockReader {
+	r := &blockReader{headers: make(map[uint64]*types.Header), txCounts: make(map[common.Hash]uint)}
+
+	parent := common.Hash{}
+
+	for i, count := range txCounts {
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Difficulty: big.NewInt(1)}
+		r.headers[uint64(i)] = header
+		r.txCounts[header.Hash()] = count
+		parent = header.Hash()
+	}
+
+	return r
+}
+
+func (r *blockReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, ok := r.headers[number.Uint64()]
+
+	if !ok {
+		return nil, fmt.Errorf("header=%d not found", number.Uint64())
+	}
+
+	return header, nil
+}
+
+func (r *blockReader) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	return r.txCounts[blockHash], nil
+}
+
+// storedBlock builds the partitions the crawler uploads for a block with the given transactions
+func storedBlock(height uint64, hash string, txs ...string) *StoredBlock {
+	block := &StoredBlock{Height: height, Events: []Event{{Type: Block, Height: height, Block: hash}}}
+
+	for _, tx := range txs {
+		block.Events = append(block.Events, Event{Type: Transaction, Height: height, Block: hash, Transaction: tx})
+		block.Actions = append(block.Actions, Action{Type: Wallet, Action: Sent, Hash: tx}, Action{Type: Wallet, Action: Received, Hash: tx})
+	}
+
+	return block
+}
+
+func TestPartitionHeight(t *testing.T) {
+	for key, expected := range map[string]uint64{
+		"chain=ethereum/network=goerli/year=2023/month=07/block=9000000.ndjson": 9000000,
+		"chain=ethereum/network=goerli/year=2023/month=07/block=0.ndjson":       0,
+		"block=42.ndjson": 42,
+	} {
+		height, ok := PartitionHeight(key)
+
+		if !ok || height != expected {
+			t.Errorf("expected: %d, got: %d (%v) for key=%s", expected, height, ok, key)
+		}
+	}
+
+	for _, key := range []string{"chain=ethereum/network=goerli/year=2023/month=07/", "chain=ethereum/block=abc.ndjson"} {
+		if _, ok := PartitionHeight(key); ok {
+			t.Errorf("expected no height for key=%s", key)
+		}
+	}
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	chain := newBlockReader([]uint{0, 1, 2, 1, 1})
+	hash := func(height uint64) string {
+		return chain.headers[height].Hash().Hex()
+	}
+
+	stored := map[uint64]*StoredBlock{
+		0: storedBlock(0, hash(0)),
+		1: storedBlock(1, hash(1), "0xa"),
+		// one transaction event missing
+		2: storedBlock(2, hash(2), "0xb"),
+		// block 3 was never uploaded, block 4 was crawled on a fork
+		4: storedBlock(4, common.HexToHash("0x4").Hex(), "0xd"),
+	}
+
+	// the received action of 0xa is missing
+	stored[1].Actions = stored[1].Actions[:1]
+
+	report, err := VerifyBlocks(context.Background(), chain, EthereumGoerli, 1, 4, stored)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Checked != 3 {
+		t.Errorf("expected: %d, got: %d", 3, report.Checked)
+	}
+
+	expected := []Discrepancy{
+		{Kind: MissingAction, Height: 1, Tx: "0xa", Detail: string(Received)},
+		{Kind: TxCountMismatch, Height: 2, Detail: "stored=1 chain=2"},
+		{Kind: MissingBlock, Height: 3, Detail: "no event partition"},
+		{Kind: HashMismatch, Height: 4, Detail: fmt.Sprintf("stored=%s chain=%s", common.HexToHash("0x4").Hex(), hash(4))},
+	}
+
+	if len(report.Discrepancies) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, report.Discrepancies)
+	}
+
+	for i := range expected {
+		if report.Discrepancies[i] != expected[i] {
+			t.Errorf("expected: %v, got: %v", expected[i], report.Discrepancies[i])
+		}
+	}
+
+	if fmt.Sprint(report.Retry) != "[1 2 3 4]" {
+		t.Errorf("expected: %v, got: %v", "[1 2 3 4]", report.Retry)
+	}
+}
+
+func TestVerifyBlockParentMismatch(t *testing.T) {
+	chain := newBlockReader([]uint{0, 0})
+
+	parent := storedBlock(0, common.HexToHash("0x1").Hex())
+	block := storedBlock(1, chain.headers[1].Hash().Hex())
+
+	found := VerifyBlock(block, parent, chain.headers[1], 0)
+
+	if len(found) != 1 || found[0].Kind != ParentMismatch {
+		t.Errorf("expected: %v, got: %v", ParentMismatch, found)
+	}
+}
+
+func TestRetryQueue(t *testing.T) {
+	queue := &RetryQueue{Path: path.Join(t.TempDir(), "retry.ndjson")}
+
+	entries, err := queue.Drain()
+
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty queue, got: %v (%v)", entries, err)
+	}
+
+	report := &VerifyReport{
+		Network: EthereumGoerli,
+		Discrepancies: []Discrepancy{
+			{Kind: MissingAction, Height: 7, Tx: "0xa", Detail: string(Sent)},
+			{Kind: MissingAction, Height: 7, Tx: "0xa", Detail: string(Received)},
+			{Kind: MissingBlock, Height: 9},
+		},
+		Retry: []uint64{7, 9},
+	}
+
+	err = queue.Push(report.RetryEntries()...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = queue.Drain()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RetryEntry{
+		{Network: EthereumGoerli, Height: 7, Reason: MissingAction},
+		{Network: EthereumGoerli, Height: 9, Reason: MissingBlock},
+	}
+
+	if fmt.Sprint(entries) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, entries)
+	}
+
+	entries, err = queue.Drain()
+
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected a drained queue, got: %v (%v)", entries, err)
+	}
+}